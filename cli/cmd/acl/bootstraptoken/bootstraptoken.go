@@ -0,0 +1,201 @@
+package bootstraptoken
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	flagNameNamespace = "namespace"
+
+	flagNameShow = "show"
+	defaultShow  = false
+
+	flagNameOutput = "output"
+
+	// secretKeyToken is the key in the bootstrap token secret that holds the token.
+	secretKeyToken = "token"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	kubernetes kubernetes.Interface
+
+	set *flag.Sets
+
+	flagNamespace string
+	flagShow      bool
+	flagOutput    string
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+// bootstrapToken is the bootstrap token along with the secret it was read from.
+type bootstrapToken struct {
+	SecretName string `json:"secretName"`
+	Namespace  string `json:"namespace"`
+	Token      string `json:"token"`
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage:   "Namespace of the Consul installation.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameShow,
+		Target:  &c.flagShow,
+		Default: defaultShow,
+		Usage:   "Print the token without asking for confirmation.",
+	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: common.OutputTable,
+		Values:  []string{common.OutputTable, common.OutputJSON},
+		Usage:   "Output format.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to acl-bootstrap-token so log lines would be prefixed with acl-bootstrap-token.
+	c.Log.ResetNamed("acl-bootstrap-token")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) > 0 {
+		c.UI.Output("Should have no non-flag arguments.", terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	token, err := c.readBootstrapToken(c.flagNamespace)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// The bootstrap token has full access to Consul, so make sure printing it is intended.
+	if !c.flagShow {
+		confirmed, err := terminal.Confirm(c.UI, "The bootstrap token grants full access to Consul. Print it to the terminal?", false)
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+		if !confirmed {
+			c.UI.Output("Aborted. Use -%s to print the token without confirmation.", flagNameShow, terminal.WithInfoStyle())
+			return 1
+		}
+	}
+
+	if c.flagOutput == common.OutputJSON {
+		out, err := json.MarshalIndent(token, "", "  ")
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.UI.Output(token.Token)
+	}
+	return 0
+}
+
+// readBootstrapToken reads the ACL bootstrap token from the secret created by the server-acl-init job.
+func (c *Command) readBootstrapToken(namespace string) (bootstrapToken, error) {
+	name := fmt.Sprintf("%s-bootstrap-acl-token", common.DefaultReleaseName)
+	secret, err := c.kubernetes.CoreV1().Secrets(namespace).Get(c.Ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return bootstrapToken{}, fmt.Errorf("error reading secret %q in namespace %q: %s", name, namespace, err)
+	}
+	token, ok := secret.Data[secretKeyToken]
+	if !ok || len(token) == 0 {
+		return bootstrapToken{}, fmt.Errorf("secret %q in namespace %q does not contain a %q key", name, namespace, secretKeyToken)
+	}
+	return bootstrapToken{
+		SecretName: name,
+		Namespace:  namespace,
+		Token:      string(token),
+	}, nil
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.kubernetes == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s acl bootstrap-token [flags]" + "\n" + "Print the ACL bootstrap token of a Consul installation that manages its own ACLs." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Print the ACL bootstrap token."
+}
@@ -0,0 +1,119 @@
+package bootstraptoken
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestReadBootstrapToken creates a fake bootstrap token secret and checks the token read from it.
+func TestReadBootstrapToken(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset()
+
+	// No secret returns an error.
+	_, err := c.readBootstrapToken("consul")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `error reading secret "consul-bootstrap-acl-token"`)
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "consul-bootstrap-acl-token",
+			Namespace: "consul",
+		},
+		Data: map[string][]byte{
+			"token": []byte("b1gs33cr3t"),
+		},
+	}
+	_, err = c.kubernetes.CoreV1().Secrets("consul").Create(context.Background(), secret, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	token, err := c.readBootstrapToken("consul")
+	require.NoError(t, err)
+	require.Equal(t, bootstrapToken{
+		SecretName: "consul-bootstrap-acl-token",
+		Namespace:  "consul",
+		Token:      "b1gs33cr3t",
+	}, token)
+
+	// A secret without the token key returns an error.
+	secret.Namespace = "other"
+	secret.Data = map[string][]byte{}
+	_, err = c.kubernetes.CoreV1().Secrets("other").Create(context.Background(), secret, metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = c.readBootstrapToken("other")
+	require.EqualError(t, err, `secret "consul-bootstrap-acl-token" in namespace "other" does not contain a "token" key`)
+}
+
+// TestRun_Confirmation checks that the token is only printed if the prompt is confirmed.
+func TestRun_Confirmation(t *testing.T) {
+	cases := map[string]struct {
+		answer    string
+		expCode   int
+		expOutput string
+	}{
+		"yes":     {answer: "y", expCode: 0, expOutput: "b1gs33cr3t"},
+		"no":      {answer: "n", expCode: 1, expOutput: "Aborted. Use -show to print the token without confirmation."},
+		"default": {answer: "", expCode: 1, expOutput: "Aborted. Use -show to print the token without confirmation."},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			c.once.Do(func() {})
+			ui := &answerUI{UI: c.UI, answer: tc.answer}
+			c.UI = ui
+			c.kubernetes = fake.NewSimpleClientset(&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: "consul"},
+				Data:       map[string][]byte{"token": []byte("b1gs33cr3t")},
+			})
+
+			require.Equal(t, tc.expCode, c.Run(nil))
+			require.Equal(t, []string{tc.expOutput}, ui.messages)
+		})
+	}
+}
+
+// answerUI answers every prompt with answer and records the messages that are output.
+type answerUI struct {
+	terminal.UI
+	answer   string
+	messages []string
+}
+
+func (u *answerUI) Input(*terminal.Input) (string, error) {
+	return u.answer, nil
+}
+
+func (u *answerUI) Output(msg string, raw ...interface{}) {
+	msg, _, _ = terminal.Interpret(msg, raw...)
+	u.messages = append(u.messages, msg)
+}
+
+// getInitializedCommand sets up a command struct for tests.
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
@@ -0,0 +1,491 @@
+package restart
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	flagNameNamespace = "namespace"
+
+	flagNameParallelism = "parallelism"
+	defaultParallelism  = 1
+
+	flagNameTimeout = "timeout"
+	defaultTimeout  = "5m"
+
+	flagNameSkipDeregistration = "skip-deregistration"
+	defaultSkipDeregistration  = false
+
+	flagNameCordon = "cordon"
+	defaultCordon  = true
+
+	flagNameAutoApprove = "auto-approve"
+	defaultAutoApprove  = false
+
+	// pollInterval is how often the client pods are checked for a ready replacement.
+	pollInterval = 2 * time.Second
+
+	// agentHTTPPort and agentHTTPSPort are the HTTP and HTTPS ports of the Consul client agents. The chart only
+	// exposes the HTTPS port, named https, when TLS is enabled.
+	agentHTTPPort  = "8500"
+	agentHTTPSPort = "8501"
+
+	// secretKeyToken is the key of the ACL token in the bootstrap token secret created by the server-acl-init job.
+	secretKeyToken = "token"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	kubernetes kubernetes.Interface
+
+	// drain takes a client agent out of service before its pod is deleted. It defaults to drainAgent and is
+	// replaced in tests.
+	drain func(ctx context.Context, pod v1.Pod) error
+
+	set *flag.Sets
+
+	flagNamespace          string
+	flagParallelism        int
+	flagTimeout            string
+	flagSkipDeregistration bool
+	flagCordon             bool
+	flagAutoApprove        bool
+
+	timeoutDuration time.Duration
+
+	// aclToken is the ACL token sent to the client agents, if the installation manages its ACLs.
+	aclToken string
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage:   "Namespace of the Consul installation.",
+	})
+	f.IntVar(&flag.IntVar{
+		Name:    flagNameParallelism,
+		Target:  &c.flagParallelism,
+		Default: defaultParallelism,
+		Usage:   "Number of client pods to restart at a time.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameTimeout,
+		Target:  &c.flagTimeout,
+		Default: defaultTimeout,
+		Usage:   "Timeout to wait for the replacement of each client pod to be ready.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameSkipDeregistration,
+		Target:  &c.flagSkipDeregistration,
+		Default: defaultSkipDeregistration,
+		Usage: "Delete the client pods without first putting their agents into maintenance mode and deregistering " +
+			"their services, e.g. if the agents' HTTP API is not reachable.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameCordon,
+		Target:  &c.flagCordon,
+		Default: defaultCordon,
+		Usage: "Cordon the node of each client pod while its agent restarts so that no new pods are scheduled onto " +
+			"it, and uncordon it once the replacement is ready. Nodes that were already cordoned stay cordoned.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameAutoApprove,
+		Target:  &c.flagAutoApprove,
+		Default: defaultAutoApprove,
+		Usage:   "Skip confirmation prompt.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to clients-restart so log lines would be prefixed with clients-restart.
+	c.Log = c.Log.ResetNamed("clients-restart")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if err := c.validateFlags(); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	pods, err := c.clientPods(c.Ctx)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(pods) == 0 {
+		c.UI.Output("No Consul client pods found in namespace %q", c.flagNamespace, terminal.WithErrorStyle())
+		return 1
+	}
+
+	c.UI.Output("Restarting Consul Clients", terminal.WithHeaderStyle())
+	c.UI.Output("%d client pods will be restarted, %d at a time.", len(pods), c.flagParallelism, terminal.WithInfoStyle())
+	if !c.flagAutoApprove {
+		confirmed, err := terminal.Confirm(c.UI, "Proceed with restart?", false)
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+		if !confirmed {
+			c.UI.Output("Restart aborted.", terminal.WithInfoStyle())
+			return 1
+		}
+	}
+
+	if !c.flagSkipDeregistration {
+		token, err := c.readACLToken(c.Ctx)
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+		c.aclToken = token
+	}
+
+	if err := c.restartPods(c.Ctx, pods, pollInterval); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	c.UI.Output("Restarted %d Consul client pods", len(pods), terminal.WithSuccessStyle())
+	return 0
+}
+
+// validateFlags checks the flags and parses -timeout.
+func (c *Command) validateFlags() error {
+	if len(c.set.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	if c.flagParallelism < 1 {
+		return fmt.Errorf("-%s must be at least 1", flagNameParallelism)
+	}
+	duration, err := time.ParseDuration(c.flagTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to parse -%s: %s", flagNameTimeout, err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("-%s must be positive", flagNameTimeout)
+	}
+	c.timeoutDuration = duration
+	return nil
+}
+
+// clientPods returns the Consul client pods, sorted by name.
+func (c *Command) clientPods(ctx context.Context) ([]v1.Pod, error) {
+	selector := fmt.Sprintf("app=%s,component=client", common.DefaultReleaseName)
+	pods, err := c.kubernetes.CoreV1().Pods(c.flagNamespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing client pods: %s", err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	return pods.Items, nil
+}
+
+// restartPods restarts -parallelism of pods at a time. Each pod of a batch is drained and deleted, and the next batch
+// only starts once all pods of the batch have been replaced by a ready pod. It stops at the first pod that fails.
+func (c *Command) restartPods(ctx context.Context, pods []v1.Pod, interval time.Duration) error {
+	drain := c.drain
+	if drain == nil {
+		drain = c.drainAgent
+	}
+	for start := 0; start < len(pods); start += c.flagParallelism {
+		end := start + c.flagParallelism
+		if end > len(pods) {
+			end = len(pods)
+		}
+		if err := c.restartBatch(ctx, pods[start:end], interval, drain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restartBatch restarts the client pods of batch at once and waits for their replacements. If restarting the batch
+// fails, the nodes it cordoned are uncordoned again so that they don't stay unschedulable.
+func (c *Command) restartBatch(ctx context.Context, batch []v1.Pod, interval time.Duration,
+	drain func(context.Context, v1.Pod) error) (err error) {
+	// cordoned is the set of nodes of the batch that were cordoned by this command and not uncordoned yet.
+	cordoned := make(map[string]bool)
+	defer func() {
+		if err == nil {
+			return
+		}
+		for node := range cordoned {
+			if _, uncordonErr := c.setUnschedulable(ctx, node, false); uncordonErr != nil {
+				c.Log.Debug("error uncordoning node", "node", node, "err", uncordonErr)
+			}
+		}
+	}()
+
+	for _, pod := range batch {
+		if c.flagCordon {
+			changed, err := c.setUnschedulable(ctx, pod.Spec.NodeName, true)
+			if err != nil {
+				return fmt.Errorf("error cordoning node %s of client pod %s: %s", pod.Spec.NodeName, pod.Name, err)
+			}
+			if changed {
+				cordoned[pod.Spec.NodeName] = true
+			}
+		}
+		if !c.flagSkipDeregistration {
+			c.UI.Output("Draining client pod %s", pod.Name, terminal.WithInfoStyle())
+			if err := drain(ctx, pod); err != nil {
+				return fmt.Errorf("error draining client pod %s: %s - use -%s to restart it anyway", pod.Name, err,
+					flagNameSkipDeregistration)
+			}
+		}
+		c.Log.Debug("deleting client pod", "pod", pod.Name, "node", pod.Spec.NodeName)
+		if err := c.kubernetes.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+			return fmt.Errorf("error deleting client pod %s: %s", pod.Name, err)
+		}
+	}
+	for _, pod := range batch {
+		replacement, err := c.waitForReplacement(ctx, pod, interval)
+		if err != nil {
+			return err
+		}
+		c.UI.Output("Client pod %s on node %s was replaced by %s", pod.Name, pod.Spec.NodeName, replacement,
+			terminal.WithSuccessStyle())
+		if cordoned[pod.Spec.NodeName] {
+			if _, err := c.setUnschedulable(ctx, pod.Spec.NodeName, false); err != nil {
+				return fmt.Errorf("error uncordoning node %s: %s", pod.Spec.NodeName, err)
+			}
+			delete(cordoned, pod.Spec.NodeName)
+		}
+	}
+	return nil
+}
+
+// setUnschedulable cordons or uncordons node, and returns whether it changed. A node that is already in the requested
+// state is left as is.
+func (c *Command) setUnschedulable(ctx context.Context, node string, unschedulable bool) (bool, error) {
+	n, err := c.kubernetes.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if n.Spec.Unschedulable == unschedulable {
+		return false, nil
+	}
+	c.Log.Debug("setting node unschedulable", "node", node, "unschedulable", unschedulable)
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	if _, err := c.kubernetes.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, []byte(patch),
+		metav1.PatchOptions{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// waitForReplacement polls the client pods every interval until a ready pod other than pod runs on pod's node, and
+// returns its name. It returns an error if -timeout passes first.
+func (c *Command) waitForReplacement(ctx context.Context, pod v1.Pod, interval time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeoutDuration)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pods, err := c.clientPods(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, p := range pods {
+			if p.UID != pod.UID && p.Spec.NodeName == pod.Spec.NodeName && p.DeletionTimestamp == nil && podReady(p) {
+				return p.Name, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("timed out waiting for the replacement of client pod %s on node %s to be ready",
+				pod.Name, pod.Spec.NodeName)
+		case <-ticker.C:
+		}
+	}
+}
+
+// podReady returns whether pod has the Ready condition.
+func podReady(pod v1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// drainAgent takes the client agent of pod out of service through the Kubernetes API server's pod proxy: it enables
+// the agent's node maintenance mode so that its services stop receiving traffic, and deregisters the services
+// registered with it.
+func (c *Command) drainAgent(ctx context.Context, pod v1.Pod) error {
+	if _, err := c.agentRequest(ctx, pod, "PUT", "/v1/agent/maintenance", map[string]string{
+		"enable": "true",
+		"reason": "Restarted by consul-k8s clients restart",
+	}); err != nil {
+		return fmt.Errorf("error enabling maintenance mode: %s", err)
+	}
+
+	body, err := c.agentRequest(ctx, pod, "GET", "/v1/agent/services", nil)
+	if err != nil {
+		return fmt.Errorf("error listing services: %s", err)
+	}
+	var services map[string]json.RawMessage
+	if err := json.Unmarshal(body, &services); err != nil {
+		return fmt.Errorf("error parsing services: %s", err)
+	}
+	ids := make([]string, 0, len(services))
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		c.Log.Debug("deregistering service", "pod", pod.Name, "service", id)
+		if _, err := c.agentRequest(ctx, pod, "PUT", "/v1/agent/service/deregister/"+id, nil); err != nil {
+			return fmt.Errorf("error deregistering service %s: %s", id, err)
+		}
+	}
+	return nil
+}
+
+// agentRequest sends a request to the HTTP API of the client agent of pod through the Kubernetes API server's pod
+// proxy and returns the response body. The request is sent over HTTPS if the pod exposes the HTTPS port, and with the
+// ACL token if the installation manages its ACLs.
+func (c *Command) agentRequest(ctx context.Context, pod v1.Pod, verb, path string, params map[string]string) ([]byte, error) {
+	scheme, port := agentAddress(pod)
+	req := c.kubernetes.CoreV1().RESTClient().Verb(verb).
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(scheme + ":" + pod.Name + ":" + port).
+		SubResource("proxy").
+		Suffix(path)
+	for k, v := range params {
+		req = req.Param(k, v)
+	}
+	if c.aclToken != "" {
+		req = req.SetHeader("X-Consul-Token", c.aclToken)
+	}
+	return req.DoRaw(ctx)
+}
+
+// agentAddress returns the scheme and port of the HTTP API of the client agent of pod.
+func agentAddress(pod v1.Pod) (string, string) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == "https" {
+				return "https", agentHTTPSPort
+			}
+		}
+	}
+	return "http", agentHTTPPort
+}
+
+// readACLToken returns the ACL bootstrap token of the installation, which can deregister any service, or an empty
+// token if the secret does not exist because the installation doesn't manage its ACLs.
+func (c *Command) readACLToken(ctx context.Context) (string, error) {
+	name := fmt.Sprintf("%s-bootstrap-acl-token", common.DefaultReleaseName)
+	secret, err := c.kubernetes.CoreV1().Secrets(c.flagNamespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading secret %q in namespace %q: %s", name, c.flagNamespace, err)
+	}
+	token, ok := secret.Data[secretKeyToken]
+	if !ok || len(token) == 0 {
+		return "", fmt.Errorf("secret %q in namespace %q does not contain a %q key", name, c.flagNamespace, secretKeyToken)
+	}
+	return string(token), nil
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.kubernetes == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s clients restart [flags]" + "\n" + "Restart the Consul client pods, e.g. for node maintenance." + "\n\n" +
+		"The client pods are restarted -parallelism at a time. Before a pod is deleted, its node is cordoned, and its " +
+		"agent is put into maintenance mode and its services are deregistered so that no traffic is sent to them. " +
+		"The agents are reached over HTTPS if TLS is enabled, with the ACL bootstrap token if the installation " +
+		"manages its ACLs. The next pods are only restarted once the replacements are ready and their nodes are " +
+		"uncordoned." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Restart the Consul client pods one at a time."
+}
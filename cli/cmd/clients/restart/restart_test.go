@@ -0,0 +1,291 @@
+package restart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestRestartPods checks that the client pods are cordoned, drained, deleted and replaced -parallelism at a time, and
+// that the next pods are only drained once the replacements of the previous ones are ready and their nodes are
+// uncordoned.
+func TestRestartPods(t *testing.T) {
+	cases := map[string]struct {
+		parallelism int
+		expEvents   []string
+	}{
+		"one at a time": {
+			parallelism: 1,
+			expEvents: []string{
+				"cordon node-a", "drain consul-a", "delete consul-a", "ready consul-a", "uncordon node-a",
+				"cordon node-b", "drain consul-b", "delete consul-b", "ready consul-b", "uncordon node-b",
+				"cordon node-c", "drain consul-c", "delete consul-c", "ready consul-c", "uncordon node-c",
+			},
+		},
+		"two at a time": {
+			parallelism: 2,
+			expEvents: []string{
+				"cordon node-a", "drain consul-a", "delete consul-a", "cordon node-b", "drain consul-b", "delete consul-b",
+				"ready consul-a", "ready consul-b", "uncordon node-a", "uncordon node-b",
+				"cordon node-c", "drain consul-c", "delete consul-c", "ready consul-c", "uncordon node-c",
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			require.NoError(t, c.set.Parse([]string{"-parallelism", fmt.Sprint(tc.parallelism)}))
+			require.NoError(t, c.validateFlags())
+
+			nodes := map[string]string{"consul-a": "node-a", "consul-b": "node-b", "consul-c": "node-c"}
+			client := fake.NewSimpleClientset(
+				clientPod("consul-c", "node-c"), clientPod("consul-a", "node-a"), clientPod("consul-b", "node-b"),
+				node("node-a", false), node("node-b", false), node("node-c", false))
+			c.kubernetes = client
+
+			// The replacement of a deleted pod becomes ready the next time the pods are listed.
+			var events, pending []string
+			client.PrependReactor("patch", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				event := "uncordon "
+				if strings.Contains(string(action.(k8stesting.PatchAction).GetPatch()), "true") {
+					event = "cordon "
+				}
+				events = append(events, event+action.(k8stesting.PatchAction).GetName())
+				return false, nil, nil
+			})
+			client.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				name := action.(k8stesting.DeleteAction).GetName()
+				events = append(events, "delete "+name)
+				pending = append(pending, name)
+				return false, nil, nil
+			})
+			client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				for _, name := range pending {
+					events = append(events, "ready "+name)
+					if err := client.Tracker().Add(clientPod(name+"-new", nodes[name])); err != nil {
+						return true, nil, err
+					}
+				}
+				pending = nil
+				return false, nil, nil
+			})
+			c.drain = func(_ context.Context, pod v1.Pod) error {
+				events = append(events, "drain "+pod.Name)
+				return nil
+			}
+
+			pods, err := c.clientPods(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, c.restartPods(context.Background(), pods, 10*time.Millisecond))
+			require.Equal(t, tc.expEvents, events)
+			for _, name := range []string{"node-a", "node-b", "node-c"} {
+				n, err := client.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+				require.NoError(t, err)
+				require.False(t, n.Spec.Unschedulable)
+			}
+		})
+	}
+}
+
+// TestRestartPods_Cordon checks that a node that was already cordoned stays cordoned, and that no node is cordoned
+// with -cordon=false.
+func TestRestartPods_Cordon(t *testing.T) {
+	cases := map[string]struct {
+		args          []string
+		unschedulable bool
+		expPatched    bool
+	}{
+		"schedulable node":          {expPatched: true},
+		"already cordoned node":     {unschedulable: true},
+		"schedulable -cordon=false": {args: []string{"-cordon=false"}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			require.NoError(t, c.set.Parse(append([]string{"-skip-deregistration"}, tc.args...)))
+			require.NoError(t, c.validateFlags())
+			client := fake.NewSimpleClientset(clientPod("consul-a", "node-a"), node("node-a", tc.unschedulable))
+			c.kubernetes = client
+			client.PrependReactor("delete", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return false, nil, client.Tracker().Add(clientPod("consul-a-new", "node-a"))
+			})
+
+			pods, err := c.clientPods(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, c.restartPods(context.Background(), pods, 10*time.Millisecond))
+			patched := false
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "patch" {
+					patched = true
+				}
+			}
+			require.Equal(t, tc.expPatched, patched)
+			n, err := client.CoreV1().Nodes().Get(context.Background(), "node-a", metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.unschedulable, n.Spec.Unschedulable)
+		})
+	}
+}
+
+// TestRestartPods_DrainFails checks that a pod that can't be drained is not deleted.
+func TestRestartPods_DrainFails(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse(nil))
+	require.NoError(t, c.validateFlags())
+	c.kubernetes = fake.NewSimpleClientset(clientPod("consul-a", "node-a"), node("node-a", false))
+	c.drain = func(context.Context, v1.Pod) error {
+		return errors.New("permission denied")
+	}
+
+	pods, err := c.clientPods(context.Background())
+	require.NoError(t, err)
+	err = c.restartPods(context.Background(), pods, 10*time.Millisecond)
+	require.EqualError(t, err, "error draining client pod consul-a: permission denied - use -skip-deregistration to restart it anyway")
+	_, err = c.kubernetes.CoreV1().Pods(common.DefaultReleaseNamespace).Get(context.Background(), "consul-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	n, err := c.kubernetes.CoreV1().Nodes().Get(context.Background(), "node-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.False(t, n.Spec.Unschedulable)
+}
+
+// TestAgentAddress checks that the agents are reached over HTTPS if their pods expose the HTTPS port.
+func TestAgentAddress(t *testing.T) {
+	pod := clientPod("consul-a", "node-a")
+	pod.Spec.Containers = []v1.Container{{Name: "consul", Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8500}}}}
+	scheme, port := agentAddress(*pod)
+	require.Equal(t, "http", scheme)
+	require.Equal(t, "8500", port)
+
+	pod.Spec.Containers[0].Ports = append(pod.Spec.Containers[0].Ports, v1.ContainerPort{Name: "https", ContainerPort: 8501})
+	scheme, port = agentAddress(*pod)
+	require.Equal(t, "https", scheme)
+	require.Equal(t, "8501", port)
+}
+
+// TestReadACLToken checks that the bootstrap token is read if the installation manages its ACLs.
+func TestReadACLToken(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse(nil))
+	c.kubernetes = fake.NewSimpleClientset()
+	token, err := c.readACLToken(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, token)
+
+	c.kubernetes = fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: common.DefaultReleaseNamespace},
+		Data:       map[string][]byte{"token": []byte("secret-id")},
+	})
+	token, err = c.readACLToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "secret-id", token)
+
+	c.kubernetes = fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: common.DefaultReleaseNamespace},
+	})
+	_, err = c.readACLToken(context.Background())
+	require.EqualError(t, err, `secret "consul-bootstrap-acl-token" in namespace "consul" does not contain a "token" key`)
+}
+
+// TestRestartPods_ReplacementTimeout checks that the node of a client pod whose replacement doesn't become ready is
+// uncordoned again.
+func TestRestartPods_ReplacementTimeout(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse([]string{"-skip-deregistration", "-timeout", "50ms"}))
+	require.NoError(t, c.validateFlags())
+	c.kubernetes = fake.NewSimpleClientset(clientPod("consul-a", "node-a"), node("node-a", false))
+
+	pods, err := c.clientPods(context.Background())
+	require.NoError(t, err)
+	err = c.restartPods(context.Background(), pods, 10*time.Millisecond)
+	require.EqualError(t, err, "timed out waiting for the replacement of client pod consul-a on node node-a to be ready")
+	n, err := c.kubernetes.CoreV1().Nodes().Get(context.Background(), "node-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.False(t, n.Spec.Unschedulable)
+}
+
+// TestWaitForReplacement_Timeout checks that a replacement that doesn't become ready times out.
+func TestWaitForReplacement_Timeout(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse([]string{"-timeout", "50ms"}))
+	require.NoError(t, c.validateFlags())
+	replacement := clientPod("consul-a-new", "node-a")
+	replacement.Status.Conditions[0].Status = v1.ConditionFalse
+	c.kubernetes = fake.NewSimpleClientset(replacement)
+
+	_, err := c.waitForReplacement(context.Background(), *clientPod("consul-a", "node-a"), 10*time.Millisecond)
+	require.EqualError(t, err, "timed out waiting for the replacement of client pod consul-a on node node-a to be ready")
+}
+
+func TestValidateFlags(t *testing.T) {
+	cases := map[string][]string{
+		"-parallelism must be at least 1":   {"-parallelism", "0"},
+		"unable to parse -timeout":          {"-timeout", "soon"},
+		"-timeout must be positive":         {"-timeout", "0s"},
+		"should have no non-flag arguments": {"consul-a"},
+	}
+	for expErr, args := range cases {
+		t.Run(expErr, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			require.NoError(t, c.set.Parse(args))
+			err := c.validateFlags()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), expErr)
+		})
+	}
+}
+
+func clientPod(name, node string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: common.DefaultReleaseNamespace,
+			UID:       types.UID(name),
+			Labels:    map[string]string{"app": "consul", "component": "client"},
+		},
+		Spec: v1.PodSpec{NodeName: node},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+		},
+	}
+}
+
+func node(name string, unschedulable bool) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1.NodeSpec{Unschedulable: unschedulable},
+	}
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
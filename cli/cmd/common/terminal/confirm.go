@@ -0,0 +1,38 @@
+package terminal
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// Confirm asks the user the yes or no question prompt and returns whether they answered yes. The answer is case
+// insensitive and surrounding whitespace is ignored. An empty answer selects the default, which is yes if defaultYes
+// is true. Any answer other than y, yes, n or no is treated as no. If the input ends before an answer is given, the
+// question is treated as declined so that closed or non-interactive input never confirms.
+func Confirm(ui UI, prompt string, defaultYes bool) (bool, error) {
+	choices := "(y/N)"
+	if defaultYes {
+		choices = "(Y/n)"
+	}
+	answer, err := ui.Input(&Input{
+		Prompt: prompt + " " + choices,
+		Style:  InfoStyle,
+		Secret: false,
+	})
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "":
+		return defaultYes, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,69 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirm(t *testing.T) {
+	cases := map[string]struct {
+		answer     string
+		err        error
+		defaultYes bool
+		expConfirm bool
+		expErr     string
+	}{
+		"yes":                       {answer: "yes", expConfirm: true},
+		"y":                         {answer: "y", expConfirm: true},
+		"upper case and whitespace": {answer: "  YeS \t", expConfirm: true},
+		"no":                        {answer: "no", defaultYes: true},
+		"n":                         {answer: "N", defaultYes: true},
+		"other answer":              {answer: "sure", defaultYes: true},
+		"default no":                {answer: ""},
+		"default yes":               {answer: " ", defaultYes: true, expConfirm: true},
+		"EOF":                       {err: io.EOF, defaultYes: true},
+		"error":                     {err: context.Canceled, expErr: context.Canceled.Error()},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ui := &inputUI{answer: tc.answer, err: tc.err}
+			confirmed, err := Confirm(ui, "Proceed?", tc.defaultYes)
+			if tc.expErr != "" {
+				require.EqualError(t, err, tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expConfirm, confirmed)
+
+			expPrompt := "Proceed? (y/N)"
+			if tc.defaultYes {
+				expPrompt = "Proceed? (Y/n)"
+			}
+			require.Equal(t, expPrompt, ui.prompt)
+		})
+	}
+}
+
+// TestConfirm_WrappedEOF checks that input ending is detected when the UI wraps io.EOF.
+func TestConfirm_WrappedEOF(t *testing.T) {
+	confirmed, err := Confirm(&inputUI{err: fmt.Errorf("error reading input: %w", io.EOF)}, "Proceed?", true)
+	require.NoError(t, err)
+	require.False(t, confirmed)
+}
+
+// inputUI answers every input with answer and err and records the prompt.
+type inputUI struct {
+	UI
+	answer string
+	err    error
+	prompt string
+}
+
+func (u *inputUI) Input(input *Input) (string, error) {
+	u.prompt = input.Prompt
+	return u.answer, u.err
+}
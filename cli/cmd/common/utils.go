@@ -2,16 +2,18 @@ package common
 
 import (
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	helmCLI "helm.sh/helm/v3/pkg/cli"
-	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"helm.sh/helm/v3/pkg/kube"
 )
 
 const (
@@ -21,6 +23,12 @@ const (
 	valuesFileName          = "values.yaml"
 	templatesDirName        = "templates"
 	TopLevelChartDirName    = "consul"
+
+	// OutputTable, OutputJSON and OutputYAML are the supported values for commands that
+	// accept an -output flag.
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
 )
 
 // ReadChartFiles reads the chart files from the embedded file system, and loads their contents into
@@ -83,17 +91,18 @@ func Abort(raw string) bool {
 	return !(strings.ToLower(confirmation) == "y" || strings.ToLower(confirmation) == "yes")
 }
 
-// InitActionConfig initializes a Helm Go SDK action configuration. This function currently uses a hack to override the
-// namespace field that gets set in the K8s client set up by the SDK.
+// InitActionConfig initializes a Helm Go SDK action configuration for the namespace. The namespace is set on the
+// K8s client set up by the SDK rather than on the settings, so settings shared with other action configurations, such
+// as the one used to list installations in all namespaces, aren't modified.
 func InitActionConfig(actionConfig *action.Configuration, namespace string, settings *helmCLI.EnvSettings, logger action.DebugLog) (*action.Configuration, error) {
-	getter := settings.RESTClientGetter()
-	configFlags := getter.(*genericclioptions.ConfigFlags)
-	configFlags.Namespace = &namespace
 	err := actionConfig.Init(settings.RESTClientGetter(), namespace,
 		os.Getenv("HELM_DRIVER"), logger)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up helm action configuration to find existing installations: %s", err)
 	}
+	if kubeClient, ok := actionConfig.KubeClient.(*kube.Client); ok {
+		kubeClient.Namespace = namespace
+	}
 	return actionConfig, nil
 }
 
@@ -123,6 +132,94 @@ func CheckForInstallations(settings *helmCLI.EnvSettings, uiLogger action.DebugL
 	return "", "", errors.New("couldn't find consul installation")
 }
 
+// MergeMaps merges two maps of Helm values giving b precedence.
+// @source: https://github.com/helm/helm/blob/main/pkg/cli/values/options.go
+func MergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = MergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// ValuesDiff returns the changes from the current to the proposed values, one line per value in the order of the
+// values' paths. Added values are prefixed with +, removed values with - and changed values with ~.
+func ValuesDiff(current, proposed map[string]interface{}) ([]string, error) {
+	before, err := flatten(current)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flatten(proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(after))
+	for path := range after {
+		paths = append(paths, path)
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var diff []string
+	for _, path := range paths {
+		was, inBefore := before[path]
+		now, inAfter := after[path]
+		switch {
+		case !inBefore:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", path, now))
+		case !inAfter:
+			diff = append(diff, fmt.Sprintf("- %s: %s", path, was))
+		case was != now:
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", path, was, now))
+		}
+	}
+	return diff, nil
+}
+
+// flatten returns the leaf values of vals keyed by their dot-separated paths, formatted as JSON.
+func flatten(vals map[string]interface{}) (map[string]string, error) {
+	out := map[string]string{}
+	var walk func(prefix string, v interface{}) error
+	walk = func(prefix string, v interface{}) error {
+		if m, ok := v.(map[string]interface{}); ok && len(m) != 0 {
+			for k, child := range m {
+				if err := walk(prefix+"."+k, child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		formatted, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("error formatting value %s: %s", strings.TrimPrefix(prefix, "."), err)
+		}
+		out[strings.TrimPrefix(prefix, ".")] = string(formatted)
+		return nil
+	}
+	for k, v := range vals {
+		if err := walk(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
 func CloseWithError(c *BaseCommand) {
 	if err := c.Close(); err != nil {
 		c.Log.Error(err.Error())
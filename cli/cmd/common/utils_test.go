@@ -2,9 +2,14 @@ package common
 
 import (
 	"embed"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/kube"
 )
 
 //go:embed fixtures/consul/* fixtures/consul/templates/_helpers.tpl
@@ -37,3 +42,72 @@ func TestReadChartFiles(t *testing.T) {
 	require.True(t, foundTemplate)
 	require.True(t, foundHelper)
 }
+
+// TestInitActionConfig_Concurrent initializes action configurations for different namespaces concurrently from the same
+// settings and checks that each keeps its own namespace and that the settings aren't modified.
+func TestInitActionConfig_Concurrent(t *testing.T) {
+	settings := helmCLI.New()
+	settingsNamespace := settings.Namespace()
+	logger := func(string, ...interface{}) {}
+
+	namespaces := []string{"consul-a", "consul-b", "consul-c", "consul-d"}
+	configs := make([]*action.Configuration, len(namespaces))
+	errs := make([]error, len(namespaces))
+	var wg sync.WaitGroup
+	for i, namespace := range namespaces {
+		wg.Add(1)
+		go func(i int, namespace string) {
+			defer wg.Done()
+			configs[i], errs[i] = InitActionConfig(new(action.Configuration), namespace, settings, logger)
+		}(i, namespace)
+	}
+	wg.Wait()
+
+	for i, namespace := range namespaces {
+		require.NoError(t, errs[i])
+		kubeClient, ok := configs[i].KubeClient.(*kube.Client)
+		require.True(t, ok, fmt.Sprintf("unexpected kube client type %T", configs[i].KubeClient))
+		require.Equal(t, namespace, kubeClient.Namespace)
+	}
+	require.Equal(t, settingsNamespace, settings.Namespace())
+}
+
+// TestValuesDiff checks that added, removed and changed values are listed in the order of their paths.
+func TestValuesDiff(t *testing.T) {
+	current := map[string]interface{}{
+		"global": map[string]interface{}{
+			"name":  "consul",
+			"image": "hashicorp/consul:1.10.0",
+		},
+		"server": map[string]interface{}{
+			"replicas": 3,
+		},
+		"ui": map[string]interface{}{
+			"enabled": true,
+		},
+	}
+	proposed := map[string]interface{}{
+		"global": map[string]interface{}{
+			"name":  "consul",
+			"image": "hashicorp/consul:1.11.0",
+		},
+		"server": map[string]interface{}{
+			"replicas": 3,
+		},
+		"connectInject": map[string]interface{}{
+			"enabled": true,
+		},
+	}
+
+	diff, err := ValuesDiff(current, proposed)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"+ connectInject.enabled: true",
+		"~ global.image: \"hashicorp/consul:1.10.0\" -> \"hashicorp/consul:1.11.0\"",
+		"- ui.enabled: true",
+	}, diff)
+
+	diff, err = ValuesDiff(current, current)
+	require.NoError(t, err)
+	require.Empty(t, diff)
+}
@@ -0,0 +1,269 @@
+package toggle
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"helm.sh/helm/v3/pkg/action"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	flagNameDryRun = "dry-run"
+	defaultDryRun  = false
+
+	// labelInject is the namespace label that enables connect injection when the webhook's
+	// connectInject.namespaceSelector matches it.
+	labelInject = "consul.hashicorp.com/connect-inject"
+	// labelInjectEnabled is the value of labelInject on namespaces with connect injection enabled.
+	labelInjectEnabled = "true"
+)
+
+// Command enables or disables connect injection on a namespace by labeling it. The same command implements
+// connect enable and connect disable, depending on Enable.
+type Command struct {
+	*common.BaseCommand
+
+	// Enable is true for connect enable and false for connect disable.
+	Enable bool
+
+	kubernetes kubernetes.Interface
+
+	// namespaceSelector returns the connectInject.namespaceSelector of the Consul installation and a description of
+	// the installation. It defaults to reading the values of the installed release and is replaced in tests.
+	namespaceSelector func(settings *helmCLI.EnvSettings) (string, string, error)
+
+	set *flag.Sets
+
+	flagDryRun bool
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameDryRun,
+		Target:  &c.flagDryRun,
+		Default: defaultDryRun,
+		Usage:   "Output the change to the namespace without applying it.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to connect-enable or
+	// connect-disable so log lines would be prefixed with it.
+	c.Log.ResetNamed("connect-" + c.action())
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) != 1 {
+		c.UI.Output("Should have exactly one non-flag argument, the namespace.", terminal.WithErrorStyle())
+		return 1
+	}
+	namespace := c.set.Args()[0]
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	if err := c.checkNamespaceSelector(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	if err := c.labelNamespace(namespace); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	return 0
+}
+
+// labelNamespace adds the inject label to namespace when enabling, and removes it when disabling. With -dry-run, the
+// change is only output.
+func (c *Command) labelNamespace(namespace string) error {
+	ns, err := c.kubernetes.CoreV1().Namespaces().Get(c.Ctx, namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("namespace %q not found", namespace)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading namespace %q: %s", namespace, err)
+	}
+
+	value, labeled := ns.Labels[labelInject]
+	if c.Enable && value == labelInjectEnabled || !c.Enable && !labeled {
+		c.UI.Output("Connect injection is already %sd on namespace %q", c.action(), namespace, terminal.WithInfoStyle())
+		return nil
+	}
+
+	if c.Enable {
+		if ns.Labels == nil {
+			ns.Labels = map[string]string{}
+		}
+		ns.Labels[labelInject] = labelInjectEnabled
+	} else {
+		delete(ns.Labels, labelInject)
+	}
+	if c.flagDryRun {
+		if c.Enable {
+			c.UI.Output("Dry run: would add the label %s=%s to namespace %q", labelInject, labelInjectEnabled,
+				namespace, terminal.WithInfoStyle())
+		} else {
+			c.UI.Output("Dry run: would remove the label %s from namespace %q", labelInject, namespace,
+				terminal.WithInfoStyle())
+		}
+		return nil
+	}
+
+	if _, err := c.kubernetes.CoreV1().Namespaces().Update(c.Ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error labeling namespace %q: %s", namespace, err)
+	}
+	c.UI.Output("Connect injection %sd on namespace %q", c.action(), namespace, terminal.WithSuccessStyle())
+	return nil
+}
+
+// checkNamespaceSelector returns an error if the connectInject.namespaceSelector of the Consul installation doesn't
+// select on the inject label, since labeling the namespace then doesn't change which pods are injected. The chart's
+// default selector, for example, selects namespaces by name.
+func (c *Command) checkNamespaceSelector(settings *helmCLI.EnvSettings) error {
+	namespaceSelector := c.namespaceSelector
+	if namespaceSelector == nil {
+		namespaceSelector = c.releaseNamespaceSelector
+	}
+	selector, installation, err := namespaceSelector(settings)
+	if err != nil {
+		return err
+	}
+
+	var parsed metav1.LabelSelector
+	if err := yaml.Unmarshal([]byte(selector), &parsed); err != nil {
+		return fmt.Errorf("error parsing connectInject.namespaceSelector of %s: %s", installation, err)
+	}
+	if _, ok := parsed.MatchLabels[labelInject]; ok {
+		return nil
+	}
+	for _, expr := range parsed.MatchExpressions {
+		if expr.Key == labelInject {
+			return nil
+		}
+	}
+	return fmt.Errorf("connectInject.namespaceSelector of %s doesn't select on the label %s, so labeling the "+
+		"namespace doesn't %s connect injection. Set connectInject.namespaceSelector to e.g. "+
+		"'matchLabels: {%s: \"%s\"}' first", installation, labelInject, c.action(), labelInject, labelInjectEnabled)
+}
+
+// releaseNamespaceSelector returns the connectInject.namespaceSelector of the installed Consul release.
+func (c *Command) releaseNamespaceSelector(settings *helmCLI.EnvSettings) (string, string, error) {
+	// Helm library logs are only useful when debugging, so they are only logged at the debug level.
+	var helmLogger = func(s string, args ...interface{}) {
+		c.Log.Debug(fmt.Sprintf(s, args...))
+	}
+
+	name, namespace, err := common.CheckForInstallations(settings, helmLogger)
+	if err != nil {
+		return "", "", err
+	}
+	installation := fmt.Sprintf("the Consul installation %q in namespace %q", name, namespace)
+	actionConfig := new(action.Configuration)
+	actionConfig, err = common.InitActionConfig(actionConfig, namespace, settings, helmLogger)
+	if err != nil {
+		return "", "", err
+	}
+	getValues := action.NewGetValues(actionConfig)
+	getValues.AllValues = true
+	vals, err := getValues.Run(name)
+	if err != nil {
+		return "", "", fmt.Errorf("error getting the values of %s: %s", installation, err)
+	}
+	connectInject, _ := vals["connectInject"].(map[string]interface{})
+	selector, _ := connectInject["namespaceSelector"].(string)
+	return selector, installation, nil
+}
+
+// action returns the name of the subcommand, enable or disable.
+func (c *Command) action() string {
+	if c.Enable {
+		return "enable"
+	}
+	return "disable"
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.kubernetes == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := fmt.Sprintf("Usage: consul-k8s connect %s [flags] <namespace>", c.action()) + "\n" + c.Synopsis() + "\n\n" +
+		fmt.Sprintf("Enabling labels the namespace %s=%s and disabling removes the label.", labelInject,
+			labelInjectEnabled) + "\n" +
+		"The label takes effect when the chart's connectInject.namespaceSelector selects on it, which is checked " +
+		"first." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	if c.Enable {
+		return "Enable connect injection on a namespace."
+	}
+	return "Disable connect injection on a namespace."
+}
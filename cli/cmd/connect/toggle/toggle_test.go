@@ -0,0 +1,154 @@
+package toggle
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestRun_EnableDisable checks that enable labels the namespace and disable removes the label again.
+func TestRun_EnableDisable(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "apps", Labels: map[string]string{"team": "a"}},
+	})
+
+	enable := getInitializedCommand(t, true, client)
+	require.Equal(t, 0, enable.Run([]string{"apps"}))
+	require.Equal(t, map[string]string{"team": "a", labelInject: labelInjectEnabled}, namespaceLabels(t, client, "apps"))
+
+	// Enabling again is a no-op.
+	require.Equal(t, 0, enable.Run([]string{"apps"}))
+	require.Equal(t, map[string]string{"team": "a", labelInject: labelInjectEnabled}, namespaceLabels(t, client, "apps"))
+
+	disable := getInitializedCommand(t, false, client)
+	require.Equal(t, 0, disable.Run([]string{"apps"}))
+	require.Equal(t, map[string]string{"team": "a"}, namespaceLabels(t, client, "apps"))
+}
+
+// TestRun_DryRun checks that -dry-run leaves the namespace unchanged.
+func TestRun_DryRun(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}})
+
+	c := getInitializedCommand(t, true, client)
+	require.Equal(t, 0, c.Run([]string{"-dry-run", "apps"}))
+	require.Empty(t, namespaceLabels(t, client, "apps"))
+}
+
+func TestRun_Errors(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	cases := map[string][]string{
+		"no namespace":        {},
+		"too many arguments":  {"a", "b"},
+		"namespace not found": {"missing"},
+	}
+	for name, args := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t, true, client)
+			require.Equal(t, 1, c.Run(args))
+		})
+	}
+}
+
+// TestRun_DefaultNamespaceSelector checks that the namespace isn't labeled if the chart's default
+// connectInject.namespaceSelector, which ignores the label, is installed.
+func TestRun_DefaultNamespaceSelector(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "apps"}})
+
+	c := getInitializedCommand(t, true, client)
+	c.namespaceSelector = func(*helmCLI.EnvSettings) (string, string, error) {
+		return defaultNamespaceSelector, "the Consul installation", nil
+	}
+	require.Equal(t, 1, c.Run([]string{"apps"}))
+	require.Empty(t, namespaceLabels(t, client, "apps"))
+}
+
+// TestCheckNamespaceSelector checks which namespace selectors select on the inject label.
+func TestCheckNamespaceSelector(t *testing.T) {
+	cases := map[string]struct {
+		selector string
+		expErr   string
+	}{
+		"match labels": {
+			selector: injectLabelSelector,
+		},
+		"match expressions": {
+			selector: "matchExpressions:\n  - key: consul.hashicorp.com/connect-inject\n    operator: In\n    values: [\"true\"]\n",
+		},
+		"chart default": {
+			selector: defaultNamespaceSelector,
+			expErr: "connectInject.namespaceSelector of the Consul installation doesn't select on the label " +
+				"consul.hashicorp.com/connect-inject, so labeling the namespace doesn't enable connect injection. Set " +
+				"connectInject.namespaceSelector to e.g. 'matchLabels: {consul.hashicorp.com/connect-inject: \"true\"}' first",
+		},
+		"no selector": {
+			expErr: "doesn't select on the label",
+		},
+		"invalid selector": {
+			selector: "matchLabels: [",
+			expErr:   "error parsing connectInject.namespaceSelector of the Consul installation",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t, true, fake.NewSimpleClientset())
+			c.namespaceSelector = func(*helmCLI.EnvSettings) (string, string, error) {
+				return tc.selector, "the Consul installation", nil
+			}
+			err := c.checkNamespaceSelector(helmCLI.New())
+			if tc.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+const (
+	// injectLabelSelector selects the namespaces labeled for connect injection.
+	injectLabelSelector = "matchLabels:\n  consul.hashicorp.com/connect-inject: \"true\"\n"
+	// defaultNamespaceSelector is the chart's default connectInject.namespaceSelector.
+	defaultNamespaceSelector = "matchExpressions:\n  - key: \"kubernetes.io/metadata.name\"\n    operator: \"NotIn\"\n" +
+		"    values: [\"kube-system\",\"local-path-storage\"]\n"
+)
+
+func namespaceLabels(t *testing.T, client kubernetes.Interface, name string) map[string]string {
+	t.Helper()
+	ns, err := client.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return ns.Labels
+}
+
+// getInitializedCommand sets up a command struct for tests.
+func getInitializedCommand(t *testing.T, enable bool, client kubernetes.Interface) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	c := &Command{
+		BaseCommand: &common.BaseCommand{
+			Ctx: context.Background(),
+			Log: log,
+		},
+		Enable:     enable,
+		kubernetes: client,
+		namespaceSelector: func(*helmCLI.EnvSettings) (string, string, error) {
+			return injectLabelSelector, "the Consul installation", nil
+		},
+	}
+	c.init()
+	return c
+}
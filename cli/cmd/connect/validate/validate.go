@@ -0,0 +1,248 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	flagNameNamespace = "namespace"
+	defaultNamespace  = "default"
+
+	flagNameOutput = "output"
+
+	// annotationInject is the annotation read by the connect-inject webhook to
+	// decide whether a pod should be injected.
+	annotationInject = "consul.hashicorp.com/connect-inject"
+
+	// envoySidecarContainer is the name of the container added by the
+	// connect-inject webhook.
+	envoySidecarContainer = "envoy-sidecar"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	kubernetes kubernetes.Interface
+
+	set *flag.Sets
+
+	flagNamespace string
+	flagOutput    string
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+// podReport describes the connect-inject state of a single pod.
+type podReport struct {
+	Name       string `json:"name"`
+	Annotated  bool   `json:"annotated"`
+	Sidecar    bool   `json:"sidecar"`
+	Mismatched bool   `json:"mismatched"`
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: defaultNamespace,
+		Usage:   "Namespace of the pods to validate.",
+	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: common.OutputTable,
+		Values:  []string{common.OutputTable, common.OutputJSON},
+		Usage:   "Output format.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to connect-validate so log lines would be prefixed with connect-validate.
+	c.Log.ResetNamed("connect-validate")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) > 0 {
+		c.UI.Output("Should have no non-flag arguments.", terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	reports, err := c.reportPods(c.flagNamespace)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	if c.flagOutput == common.OutputJSON {
+		out, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.outputTable(reports)
+	}
+
+	for _, r := range reports {
+		if r.Mismatched {
+			return 1
+		}
+	}
+	return 0
+}
+
+// reportPods lists the pods in namespace and reports for each of them whether
+// it is annotated for injection and whether it is running the Envoy sidecar.
+func (c *Command) reportPods(namespace string) ([]podReport, error) {
+	pods, err := c.kubernetes.CoreV1().Pods(namespace).List(c.Ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods in namespace %q: %s", namespace, err)
+	}
+
+	reports := []podReport{}
+	for _, pod := range pods.Items {
+		annotated := isAnnotated(pod)
+		sidecar := hasSidecar(pod)
+		reports = append(reports, podReport{
+			Name:       pod.Name,
+			Annotated:  annotated,
+			Sidecar:    sidecar,
+			Mismatched: annotated && !sidecar,
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+	return reports, nil
+}
+
+// outputTable prints the pod reports as a table followed by a summary line.
+func (c *Command) outputTable(reports []podReport) {
+	if len(reports) == 0 {
+		c.UI.Output("No pods found in namespace %q.", c.flagNamespace, terminal.WithInfoStyle())
+		return
+	}
+
+	tbl := terminal.NewTable("Pod", "Annotated", "Sidecar", "Status")
+	var mismatched int
+	for _, r := range reports {
+		status, color := "OK", terminal.Green
+		if r.Mismatched {
+			status, color = "MISMATCHED", terminal.Red
+			mismatched++
+		}
+		tbl.Rich([]string{r.Name, strconv.FormatBool(r.Annotated), strconv.FormatBool(r.Sidecar), status},
+			[]string{"", "", "", color})
+	}
+	c.UI.Table(tbl)
+
+	if mismatched > 0 {
+		c.UI.Output("%d pod(s) are annotated for injection but have no %s container", mismatched, envoySidecarContainer, terminal.WithErrorStyle())
+	} else {
+		c.UI.Output("All annotated pods have a sidecar", terminal.WithSuccessStyle())
+	}
+}
+
+// isAnnotated returns true if the pod has the connect-inject annotation set to a true value.
+func isAnnotated(pod v1.Pod) bool {
+	raw, ok := pod.Annotations[annotationInject]
+	if !ok {
+		return false
+	}
+	inject, err := strconv.ParseBool(raw)
+	return err == nil && inject
+}
+
+// hasSidecar returns true if the pod is running the Envoy sidecar container.
+func hasSidecar(pod v1.Pod) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == envoySidecarContainer {
+			return true
+		}
+	}
+	return false
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.kubernetes == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s connect validate [flags]" + "\n" + "Report which pods in a namespace are annotated for connect injection and whether they are running a sidecar." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Validate connect-inject annotations against running sidecars."
+}
@@ -0,0 +1,92 @@
+package validate
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestReportPods creates fake pods in mixed injection states and checks the report for each.
+func TestReportPods(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset()
+
+	pods := []*v1.Pod{
+		pod("injected", "true", true),
+		pod("not-injected", "false", false),
+		pod("unannotated", "", false),
+		pod("mismatched", "true", false),
+		pod("sidecar-only", "", true),
+	}
+	for _, p := range pods {
+		_, err := c.kubernetes.CoreV1().Pods("default").Create(context.Background(), p, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	// Pods in other namespaces should not be reported.
+	_, err := c.kubernetes.CoreV1().Pods("other").Create(context.Background(), pod("other-namespace", "true", false), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	reports, err := c.reportPods("default")
+	require.NoError(t, err)
+	require.Equal(t, []podReport{
+		{Name: "injected", Annotated: true, Sidecar: true},
+		{Name: "mismatched", Annotated: true, Sidecar: false, Mismatched: true},
+		{Name: "not-injected", Annotated: false, Sidecar: false},
+		{Name: "sidecar-only", Annotated: false, Sidecar: true},
+		{Name: "unannotated", Annotated: false, Sidecar: false},
+	}, reports)
+
+	// An empty namespace returns an empty report.
+	reports, err = c.reportPods("empty")
+	require.NoError(t, err)
+	require.Empty(t, reports)
+}
+
+// pod returns a pod with the given inject annotation value (omitted when empty)
+// and, if sidecar is true, an envoy-sidecar container.
+func pod(name, inject string, sidecar bool) *v1.Pod {
+	p := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "app"}},
+		},
+	}
+	if inject != "" {
+		p.Annotations[annotationInject] = inject
+	}
+	if sidecar {
+		p.Spec.Containers = append(p.Spec.Containers, v1.Container{Name: envoySidecarContainer})
+	}
+	return p
+}
+
+// getInitializedCommand sets up a command struct for tests.
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
@@ -0,0 +1,295 @@
+package install
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	consulChart "github.com/hashicorp/consul-k8s/charts"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	flagNameNamespace = "namespace"
+
+	flagNameDryRun = "dry-run"
+	defaultDryRun  = false
+
+	// kindCRD is the kind of the manifests that are applied.
+	kindCRD = "CustomResourceDefinition"
+
+	// annotationReleaseName and annotationReleaseNamespace are the annotations Helm uses to record which release owns a
+	// resource.
+	annotationReleaseName      = "meta.helm.sh/release-name"
+	annotationReleaseNamespace = "meta.helm.sh/release-namespace"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	apiextensions apiextensions.Interface
+
+	set *flag.Sets
+
+	flagNamespace string
+	flagDryRun    bool
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage: "Namespace Consul will be installed into. The CRDs are marked as belonging to the Consul release in " +
+			"this namespace so that a later install adopts them.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameDryRun,
+		Target:  &c.flagDryRun,
+		Default: defaultDryRun,
+		Usage:   "List the CRDs that would be created or updated without applying them.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to crd-install so log lines would be prefixed with crd-install.
+	c.Log.ResetNamed("crd-install")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) > 0 {
+		c.UI.Output("Should have no non-flag arguments.", terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	chartFiles, err := common.ReadChartFiles(consulChart.ConsulHelmChart, common.TopLevelChartDirName)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	chrt, err := loader.LoadFiles(chartFiles)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// Helm library logs are only useful when debugging, so they are only logged at the debug level.
+	var helmLogger = func(s string, args ...interface{}) {
+		c.Log.Debug(fmt.Sprintf(s, args...))
+	}
+
+	crds, err := crdsFromChart(chrt, c.flagNamespace, helmLogger)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(crds) == 0 {
+		c.UI.Output("The chart does not contain any CRDs.", terminal.WithInfoStyle())
+		return 0
+	}
+
+	if err := c.applyCRDs(crds); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if !c.flagDryRun {
+		c.UI.Output("Applied %d CRDs", len(crds), terminal.WithSuccessStyle())
+	}
+	return 0
+}
+
+// crdsFromChart returns the CRDs of the chart, sorted by name. These are the CRDs in the chart's crds/ directory and
+// the CRDs rendered by its templates, which the Consul chart only renders when the controller is enabled. The CRDs are
+// given Helm's ownership metadata for the Consul release in namespace, so that installing the chart adopts them.
+func crdsFromChart(chrt *chart.Chart, namespace string, logger action.DebugLog) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	var manifests []string
+	for _, file := range chrt.CRDObjects() {
+		manifests = append(manifests, string(file.File.Data))
+	}
+
+	// Render the templates without contacting the cluster.
+	install := action.NewInstall(&action.Configuration{Log: logger})
+	install.ReleaseName = common.DefaultReleaseName
+	install.Namespace = namespace
+	install.DryRun = true
+	install.ClientOnly = true
+	rel, err := install.Run(chrt, map[string]interface{}{
+		"controller": map[string]interface{}{
+			"enabled": true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering chart: %s", err)
+	}
+	manifests = append(manifests, rel.Manifest)
+
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	for _, manifest := range manifests {
+		for _, doc := range releaseutil.SplitManifests(manifest) {
+			var typeMeta metav1.TypeMeta
+			if err := yaml.Unmarshal([]byte(doc), &typeMeta); err != nil {
+				return nil, fmt.Errorf("error parsing manifest: %s", err)
+			}
+			if typeMeta.Kind != kindCRD {
+				continue
+			}
+			var crd apiextensionsv1.CustomResourceDefinition
+			if err := yaml.Unmarshal([]byte(doc), &crd); err != nil {
+				return nil, fmt.Errorf("error parsing CRD: %s", err)
+			}
+			if crd.Labels == nil {
+				crd.Labels = map[string]string{}
+			}
+			crd.Labels["app.kubernetes.io/managed-by"] = "Helm"
+			if crd.Annotations == nil {
+				crd.Annotations = map[string]string{}
+			}
+			crd.Annotations[annotationReleaseName] = common.DefaultReleaseName
+			crd.Annotations[annotationReleaseNamespace] = namespace
+			crds = append(crds, &crd)
+		}
+	}
+	sort.Slice(crds, func(i, j int) bool {
+		return crds[i].Name < crds[j].Name
+	})
+	return crds, nil
+}
+
+// applyCRDs creates the CRDs that do not exist and updates the ones that do. With -dry-run, it only outputs what it
+// would do.
+func (c *Command) applyCRDs(crds []*apiextensionsv1.CustomResourceDefinition) error {
+	client := c.apiextensions.ApiextensionsV1().CustomResourceDefinitions()
+	for _, crd := range crds {
+		existing, err := client.Get(c.Ctx, crd.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			if c.flagDryRun {
+				c.UI.Output("Would create CRD %s", crd.Name, terminal.WithInfoStyle())
+				continue
+			}
+			if _, err := client.Create(c.Ctx, crd, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("error creating CRD %s: %s", crd.Name, err)
+			}
+			c.UI.Output("Created CRD %s", crd.Name, terminal.WithSuccessStyle())
+		case err != nil:
+			return fmt.Errorf("error reading CRD %s: %s", crd.Name, err)
+		default:
+			if owner := existing.Annotations[annotationReleaseNamespace]; owner != "" && owner != crd.Annotations[annotationReleaseNamespace] {
+				return fmt.Errorf("CRD %s belongs to the Helm release %q in namespace %q, not to the Consul "+
+					"installation in namespace %q", crd.Name, existing.Annotations[annotationReleaseName], owner,
+					crd.Annotations[annotationReleaseNamespace])
+			}
+			if c.flagDryRun {
+				c.UI.Output("Would update CRD %s", crd.Name, terminal.WithInfoStyle())
+				continue
+			}
+			// Keep the labels and annotations set on the existing CRD by others.
+			crd.Labels = mergeStringMaps(existing.Labels, crd.Labels)
+			crd.Annotations = mergeStringMaps(existing.Annotations, crd.Annotations)
+			crd.ResourceVersion = existing.ResourceVersion
+			if _, err := client.Update(c.Ctx, crd, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("error updating CRD %s: %s", crd.Name, err)
+			}
+			c.UI.Output("Updated CRD %s", crd.Name, terminal.WithSuccessStyle())
+		}
+	}
+	return nil
+}
+
+// mergeStringMaps returns the entries of a and b, giving b precedence.
+func mergeStringMaps(a, b map[string]string) map[string]string {
+	out := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.apiextensions == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.apiextensions, err = apiextensions.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s crd install [flags]" + "\n" +
+		"Install or update only the Consul CRDs, e.g. to manage them separately from the Helm chart." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Install the Consul CRDs."
+}
@@ -0,0 +1,189 @@
+package install
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	consulChart "github.com/hashicorp/consul-k8s/charts"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+`
+
+// TestCRDsFromChart checks that CRDs are read from both the crds/ directory and the templates, and nothing else.
+func TestCRDsFromChart(t *testing.T) {
+	chrt, err := loader.LoadFiles([]*loader.BufferedFile{
+		{Name: "Chart.yaml", Data: []byte("apiVersion: v2\nname: test\nversion: 0.1.0\n")},
+		{Name: "crds/widgets.yaml", Data: []byte(testCRD)},
+		{Name: "templates/gadgets.yaml", Data: []byte(`{{- if .Values.controller.enabled }}
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.com
+  labels:
+    release: {{ .Release.Name }}
+spec:
+  group: example.com
+  names:
+    kind: Gadget
+    plural: gadgets
+  scope: Namespaced
+{{- end }}
+`)},
+		{Name: "templates/configmap.yaml", Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n")},
+	})
+	require.NoError(t, err)
+
+	crds, err := crdsFromChart(chrt, "ns", t.Logf)
+	require.NoError(t, err)
+	require.Len(t, crds, 2)
+	require.Equal(t, "gadgets.example.com", crds[0].Name)
+	require.Equal(t, map[string]string{"release": "consul", "app.kubernetes.io/managed-by": "Helm"}, crds[0].Labels)
+	require.Equal(t, "widgets.example.com", crds[1].Name)
+	require.Equal(t, "Widget", crds[1].Spec.Names.Kind)
+	for _, crd := range crds {
+		require.Equal(t, map[string]string{
+			"meta.helm.sh/release-name":      "consul",
+			"meta.helm.sh/release-namespace": "ns",
+		}, crd.Annotations)
+	}
+}
+
+// TestApplyCRDs checks that the CRDs of the Consul chart are created, and updated when they already exist.
+func TestApplyCRDs(t *testing.T) {
+	chartFiles, err := common.ReadChartFiles(consulChart.ConsulHelmChart, common.TopLevelChartDirName)
+	require.NoError(t, err)
+	chrt, err := loader.LoadFiles(chartFiles)
+	require.NoError(t, err)
+	crds, err := crdsFromChart(chrt, "consul", t.Logf)
+	require.NoError(t, err)
+
+	c := getInitializedCommand(t)
+	existing := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "servicedefaults.consul.hashicorp.com"},
+	}
+	client := fake.NewSimpleClientset(existing)
+	c.apiextensions = client
+
+	// A dry run does not change anything.
+	c.flagDryRun = true
+	require.NoError(t, c.applyCRDs(crds))
+	list, err := client.ApiextensionsV1().CustomResourceDefinitions().List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+
+	c.flagDryRun = false
+	require.NoError(t, c.applyCRDs(crds))
+	list, err = client.ApiextensionsV1().CustomResourceDefinitions().List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, crd := range list.Items {
+		names = append(names, crd.Name)
+		require.Equal(t, "consul.hashicorp.com", crd.Spec.Group)
+	}
+	require.ElementsMatch(t, []string{
+		"ingressgateways.consul.hashicorp.com",
+		"meshes.consul.hashicorp.com",
+		"partitionexports.consul.hashicorp.com",
+		"proxydefaults.consul.hashicorp.com",
+		"servicedefaults.consul.hashicorp.com",
+		"serviceintentions.consul.hashicorp.com",
+		"serviceresolvers.consul.hashicorp.com",
+		"servicerouters.consul.hashicorp.com",
+		"servicesplitters.consul.hashicorp.com",
+		"terminatinggateways.consul.hashicorp.com",
+	}, names)
+}
+
+// TestApplyCRDs_Metadata checks that updating a CRD keeps its existing labels and annotations, and that CRDs owned by
+// a release in another namespace are not updated.
+func TestApplyCRDs_Metadata(t *testing.T) {
+	chartFiles, err := common.ReadChartFiles(consulChart.ConsulHelmChart, common.TopLevelChartDirName)
+	require.NoError(t, err)
+	chrt, err := loader.LoadFiles(chartFiles)
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		owner  string
+		expErr string
+	}{
+		"not owned":            {},
+		"owned by the release": {owner: "consul"},
+		"owned by another release namespace": {
+			owner:  "other",
+			expErr: `CRD meshes.consul.hashicorp.com belongs to the Helm release "consul" in namespace "other", not to the Consul installation in namespace "consul"`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			crds, err := crdsFromChart(chrt, "consul", t.Logf)
+			require.NoError(t, err)
+			existing := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "meshes.consul.hashicorp.com",
+					Labels:      map[string]string{"team": "platform"},
+					Annotations: map[string]string{"example.com/note": "keep"},
+				},
+			}
+			if tc.owner != "" {
+				existing.Annotations[annotationReleaseName] = "consul"
+				existing.Annotations[annotationReleaseNamespace] = tc.owner
+			}
+			client := fake.NewSimpleClientset(existing)
+			c := getInitializedCommand(t)
+			c.apiextensions = client
+
+			err = c.applyCRDs(crds)
+			crd, getErr := client.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(),
+				"meshes.consul.hashicorp.com", metav1.GetOptions{})
+			require.NoError(t, getErr)
+			if tc.expErr != "" {
+				require.EqualError(t, err, tc.expErr)
+				require.Equal(t, existing.Annotations, crd.Annotations)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "platform", crd.Labels["team"])
+			require.Equal(t, "Helm", crd.Labels["app.kubernetes.io/managed-by"])
+			require.Equal(t, "keep", crd.Annotations["example.com/note"])
+			require.Equal(t, "consul", crd.Annotations[annotationReleaseNamespace])
+		})
+	}
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
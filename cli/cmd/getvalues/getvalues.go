@@ -0,0 +1,178 @@
+package getvalues
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"helm.sh/helm/v3/pkg/action"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	flagNameName = "name"
+
+	flagNameNamespace = "namespace"
+
+	flagNameAll = "all"
+	defaultAll  = false
+
+	flagNameOutput = "output"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	set *flag.Sets
+
+	flagName      string
+	flagNamespace string
+	flagAll       bool
+	flagOutput    string
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameName,
+		Target:  &c.flagName,
+		Default: common.DefaultReleaseName,
+		Usage:   "Name of the Helm release.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage:   "Namespace of the Helm release.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameAll,
+		Target:  &c.flagAll,
+		Default: defaultAll,
+		Usage:   "Print all values of the release, including the chart's defaults, instead of only the user-supplied values.",
+	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: common.OutputYAML,
+		Values:  []string{common.OutputYAML, common.OutputJSON},
+		Usage:   "Output format.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to get-values so log lines would be prefixed with get-values.
+	c.Log.ResetNamed("get-values")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) > 0 {
+		c.UI.Output("Should have no non-flag arguments.", terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used by the Helm Go SDK calls.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	// Helm library logs are only useful when debugging, so they are only logged at the debug level.
+	var helmLogger = func(s string, args ...interface{}) {
+		c.Log.Debug(fmt.Sprintf(s, args...))
+	}
+
+	actionConfig := new(action.Configuration)
+	actionConfig, err := common.InitActionConfig(actionConfig, c.flagNamespace, settings, helmLogger)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	out, err := c.getValues(actionConfig)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	c.UI.Output(out)
+	return 0
+}
+
+// getValues returns the values of the release, formatted according to -output.
+func (c *Command) getValues(actionConfig *action.Configuration) (string, error) {
+	getValues := action.NewGetValues(actionConfig)
+	getValues.AllValues = c.flagAll
+	vals, err := getValues.Run(c.flagName)
+	if err != nil {
+		return "", fmt.Errorf("error getting the values of release %q in namespace %q: %s", c.flagName, c.flagNamespace, err)
+	}
+	// A release installed without any values has no values to print, which is printed as an empty map.
+	if vals == nil {
+		vals = map[string]interface{}{}
+	}
+
+	var out []byte
+	switch c.flagOutput {
+	case common.OutputJSON:
+		out, err = json.MarshalIndent(vals, "", "  ")
+	case common.OutputYAML:
+		out, err = yaml.Marshal(vals)
+	default:
+		err = errors.New("unsupported output format")
+	}
+	if err != nil {
+		return "", fmt.Errorf("error formatting values: %s", err)
+	}
+	return string(out), nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s get-values [flags]" + "\n" + "Print the Helm values of an installed Consul release." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Print the Helm values of a Consul installation."
+}
@@ -0,0 +1,100 @@
+package getvalues
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// TestGetValues renders the values of a known release in each output format.
+func TestGetValues(t *testing.T) {
+	actionConfig := &action.Configuration{
+		Releases:   storage.Init(driver.NewMemory()),
+		KubeClient: &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Log:        t.Logf,
+	}
+	require.NoError(t, actionConfig.Releases.Create(&release.Release{
+		Name:      "consul",
+		Namespace: "consul",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: "consul", Version: "0.1.0"},
+			Values: map[string]interface{}{
+				"global": map[string]interface{}{
+					"name":       nil,
+					"datacenter": "dc1",
+				},
+			},
+		},
+		Config: map[string]interface{}{
+			"global": map[string]interface{}{
+				"name": "consul",
+			},
+		},
+	}))
+
+	cases := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"user-supplied yaml": {
+			args:     nil,
+			expected: "global:\n  name: consul\n",
+		},
+		"all yaml": {
+			args:     []string{"-all"},
+			expected: "global:\n  datacenter: dc1\n  name: consul\n",
+		},
+		"user-supplied json": {
+			args:     []string{"-output", "json"},
+			expected: "{\n  \"global\": {\n    \"name\": \"consul\"\n  }\n}",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			require.NoError(t, c.set.Parse(tc.args))
+			out, err := c.getValues(actionConfig)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, out)
+		})
+	}
+
+	t.Run("release not found", func(t *testing.T) {
+		c := getInitializedCommand(t)
+		require.NoError(t, c.set.Parse([]string{"-name", "other"}))
+		_, err := c.getValues(actionConfig)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `error getting the values of release "other" in namespace "consul"`)
+	})
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
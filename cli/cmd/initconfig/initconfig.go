@@ -0,0 +1,270 @@
+package initconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	flagNameOutputFile = "output-file"
+	defaultOutputFile  = "values.yaml"
+
+	flagNameNonInteractive = "non-interactive"
+	defaultNonInteractive  = false
+
+	flagNameTLS = "tls"
+	defaultTLS  = true
+
+	flagNameACLs = "acls"
+	defaultACLs  = true
+
+	flagNameServerReplicas = "server-replicas"
+	defaultServerReplicas  = 1
+
+	flagNameConnectInject = "connect-inject"
+	defaultConnectInject  = true
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	set *flag.Sets
+
+	flagOutputFile     string
+	flagNonInteractive bool
+	flagTLS            bool
+	flagACLs           bool
+	flagServerReplicas int
+	flagConnectInject  bool
+
+	once sync.Once
+	help string
+}
+
+// answers holds the choices used to generate the values file.
+type answers struct {
+	TLS            bool
+	ACLs           bool
+	ServerReplicas int
+	ConnectInject  bool
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameOutputFile,
+		Aliases: []string{"o"},
+		Target:  &c.flagOutputFile,
+		Default: defaultOutputFile,
+		Usage:   "Path of the values file to write. The file must not already exist.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameNonInteractive,
+		Target:  &c.flagNonInteractive,
+		Default: defaultNonInteractive,
+		Usage:   "Skip the prompts and generate the values file from the flags below.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameTLS,
+		Target:  &c.flagTLS,
+		Default: defaultTLS,
+		Usage:   "Enable TLS. Only used with -non-interactive.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameACLs,
+		Target:  &c.flagACLs,
+		Default: defaultACLs,
+		Usage:   "Enable ACLs managed by the chart. Only used with -non-interactive.",
+	})
+	f.IntVar(&flag.IntVar{
+		Name:    flagNameServerReplicas,
+		Target:  &c.flagServerReplicas,
+		Default: defaultServerReplicas,
+		Usage:   "Number of Consul servers. Only used with -non-interactive.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameConnectInject,
+		Target:  &c.flagConnectInject,
+		Default: defaultConnectInject,
+		Usage:   "Enable connect injection. Only used with -non-interactive.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to init-config so log lines would be prefixed with init-config.
+	c.Log.ResetNamed("init-config")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) > 0 {
+		c.UI.Output("Should have no non-flag arguments.", terminal.WithErrorStyle())
+		return 1
+	}
+	if _, err := os.Stat(c.flagOutputFile); err == nil {
+		c.UI.Output("File %q already exists, choose a different -%s.", c.flagOutputFile, flagNameOutputFile, terminal.WithErrorStyle())
+		return 1
+	}
+
+	var a answers
+	if c.flagNonInteractive {
+		a = answers{
+			TLS:            c.flagTLS,
+			ACLs:           c.flagACLs,
+			ServerReplicas: c.flagServerReplicas,
+			ConnectInject:  c.flagConnectInject,
+		}
+		if a.ServerReplicas < 1 {
+			c.UI.Output("-%s must be at least 1", flagNameServerReplicas, terminal.WithErrorStyle())
+			return 1
+		}
+	} else {
+		var err error
+		a, err = promptAnswers(c.UI.Input)
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+	}
+
+	valuesYaml, err := generateValues(a)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if err := ioutil.WriteFile(c.flagOutputFile, valuesYaml, 0644); err != nil {
+		c.UI.Output("Error writing values file: %s", err, terminal.WithErrorStyle())
+		return 1
+	}
+
+	c.UI.Output("Values file written to %s", c.flagOutputFile, terminal.WithSuccessStyle())
+	c.UI.Output("Review the file, then install with:\nconsul-k8s install -f %s", c.flagOutputFile, terminal.WithInfoStyle())
+	return 0
+}
+
+// promptAnswers asks the user each question using ask. Empty answers select the default.
+func promptAnswers(ask func(*terminal.Input) (string, error)) (answers, error) {
+	var a answers
+	var err error
+	if a.TLS, err = promptBool(ask, "Enable TLS?", defaultTLS); err != nil {
+		return a, err
+	}
+	if a.ACLs, err = promptBool(ask, "Enable ACLs?", defaultACLs); err != nil {
+		return a, err
+	}
+	if a.ServerReplicas, err = promptInt(ask, "How many Consul servers?", defaultServerReplicas); err != nil {
+		return a, err
+	}
+	if a.ConnectInject, err = promptBool(ask, "Enable connect injection?", defaultConnectInject); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+// promptBool asks a yes/no question, re-asking until the answer is valid.
+func promptBool(ask func(*terminal.Input) (string, error), prompt string, def bool) (bool, error) {
+	options := "(y/N)"
+	if def {
+		options = "(Y/n)"
+	}
+	for {
+		raw, err := ask(&terminal.Input{
+			Prompt: fmt.Sprintf("%s %s", prompt, options),
+			Style:  terminal.InfoStyle,
+		})
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(raw)) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// promptInt asks for a positive number, re-asking until the answer is valid.
+func promptInt(ask func(*terminal.Input) (string, error), prompt string, def int) (int, error) {
+	for {
+		raw, err := ask(&terminal.Input{
+			Prompt: fmt.Sprintf("%s (%d)", prompt, def),
+			Style:  terminal.InfoStyle,
+		})
+		if err != nil {
+			return 0, err
+		}
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			return def, nil
+		}
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// generateValues returns the values file YAML for the given answers.
+func generateValues(a answers) ([]byte, error) {
+	if a.ServerReplicas < 1 {
+		return nil, errors.New("server replicas must be at least 1")
+	}
+	global := map[string]interface{}{
+		"name": "consul",
+	}
+	if a.TLS {
+		global["tls"] = map[string]interface{}{
+			"enabled":           true,
+			"enableAutoEncrypt": true,
+		}
+	}
+	if a.ACLs {
+		global["acls"] = map[string]interface{}{
+			"manageSystemACLs": true,
+		}
+	}
+	vals := map[string]interface{}{
+		"global": global,
+		"server": map[string]interface{}{
+			"replicas":        a.ServerReplicas,
+			"bootstrapExpect": a.ServerReplicas,
+		},
+		"connectInject": map[string]interface{}{
+			"enabled": a.ConnectInject,
+		},
+	}
+	return yaml.Marshal(vals)
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s init-config [flags]" + "\n" + "Generate a Consul Helm chart values file by answering a few questions." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Generate a values file for installing Consul."
+}
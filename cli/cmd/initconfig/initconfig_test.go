@@ -0,0 +1,94 @@
+package initconfig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedInput returns an input function that replies with the given answers in order.
+func scriptedInput(t *testing.T, replies ...string) func(*terminal.Input) (string, error) {
+	t.Helper()
+	return func(*terminal.Input) (string, error) {
+		if len(replies) == 0 {
+			return "", errors.New("no more scripted answers")
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	}
+}
+
+// TestPromptAnswers checks that scripted answers produce the expected values file.
+func TestPromptAnswers(t *testing.T) {
+	cases := map[string]struct {
+		replies  []string
+		expected string
+	}{
+		"defaults": {
+			replies: []string{"", "", "", ""},
+			expected: `connectInject:
+  enabled: true
+global:
+  acls:
+    manageSystemACLs: true
+  name: consul
+  tls:
+    enableAutoEncrypt: true
+    enabled: true
+server:
+  bootstrapExpect: 1
+  replicas: 1
+`,
+		},
+		"everything disabled": {
+			replies: []string{"n", "no", "3", "N"},
+			expected: `connectInject:
+  enabled: false
+global:
+  name: consul
+server:
+  bootstrapExpect: 3
+  replicas: 3
+`,
+		},
+		"invalid answers are asked again": {
+			replies: []string{"maybe", "y", "n", "0", "abc", "5", "yes"},
+			expected: `connectInject:
+  enabled: true
+global:
+  name: consul
+  tls:
+    enableAutoEncrypt: true
+    enabled: true
+server:
+  bootstrapExpect: 5
+  replicas: 5
+`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			a, err := promptAnswers(scriptedInput(t, tc.replies...))
+			require.NoError(t, err)
+			actual, err := generateValues(a)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(actual))
+		})
+	}
+}
+
+// TestPromptAnswers_InputError checks that an error reading input is returned.
+func TestPromptAnswers_InputError(t *testing.T) {
+	_, err := promptAnswers(scriptedInput(t, "y"))
+	require.EqualError(t, err, "no more scripted answers")
+}
+
+// TestGenerateValues_InvalidReplicas checks that fewer than one server is rejected.
+func TestGenerateValues_InvalidReplicas(t *testing.T) {
+	_, err := generateValues(answers{ServerReplicas: 0})
+	require.EqualError(t, err, "server replicas must be at least 1")
+}
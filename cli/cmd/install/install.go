@@ -1,9 +1,18 @@
 package install
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,15 +21,34 @@ import (
 	"github.com/hashicorp/consul-k8s/cli/cmd/common"
 	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
 	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/cmd/uninstall"
+	"github.com/hashicorp/go-hclog"
+	"github.com/xeipuuv/gojsonschema"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	helmCLI "helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	v1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
 	"sigs.k8s.io/yaml"
 )
 
@@ -32,6 +60,20 @@ const (
 	flagNameSetStringValues = "set-string"
 	flagNameSetValues       = "set"
 	flagNameFileValues      = "set-file"
+	flagNameLiteralValues   = "set-literal"
+	flagNameBaseValues      = "base-values"
+	flagNameValuesSchema    = "values-schema"
+
+	flagNameChartVersion = "version"
+
+	flagNameHelmRepoURL = "helm-repo-url"
+	defaultHelmRepoURL  = "https://helm.releases.hashicorp.com"
+	envHelmRepoURL      = "CONSUL_K8S_HELM_REPO_URL"
+
+	flagNameVerify = "verify"
+	defaultVerify  = false
+
+	flagNameKeyring = "keyring"
 
 	flagNameDryRun = "dry-run"
 	defaultDryRun  = false
@@ -39,6 +81,8 @@ const (
 	flagNameAutoApprove = "auto-approve"
 	defaultAutoApprove  = false
 
+	flagNameOutput = "output"
+
 	flagNameNamespace = "namespace"
 
 	flagNameTimeout = "timeout"
@@ -47,29 +91,270 @@ const (
 	flagNameVerbose = "verbose"
 	defaultVerbose  = false
 
+	flagNameLogLevel = "log-level"
+	defaultLogLevel  = "info"
+
 	flagNameWait = "wait"
 	defaultWait  = true
+
+	flagNameCAFile = "ca-file"
+
+	flagNameCheckResources = "check-resources"
+	defaultCheckResources  = false
+
+	flagNameReusePVCs = "reuse-pvcs"
+	defaultReusePVCs  = false
+
+	flagNameSkipPreInstallChecks = "skip-pre-install-checks"
+	defaultSkipPreInstallChecks  = false
+
+	flagNameBootstrapSecretPatterns = "bootstrap-secret-pattern"
+
+	flagNameForceReinstall = "force-reinstall"
+	defaultForceReinstall  = false
+
+	flagNameEnableNamespaceMirroring = "enable-namespace-mirroring"
+	defaultEnableNamespaceMirroring  = false
+
+	flagNameMirroringPrefix = "mirroring-prefix"
+
+	flagNameStrict = "strict"
+	defaultStrict  = false
+
+	flagNameClientOnly = "client-only"
+	defaultClientOnly  = false
+
+	flagNameExternalServers = "external-servers"
+
+	flagNameHistoryMax = "history-max"
+	defaultHistoryMax  = 0
+
+	flagNameReleaseDescription = "release-description"
+
+	flagNameNoNotes = "no-notes"
+	defaultNoNotes  = false
+
+	flagNameServerResources = "server-resources"
+	flagNameClientResources = "client-resources"
+
+	flagNameServerExtraConfig = "server-extra-config"
+	flagNameClientExtraConfig = "client-extra-config"
+
+	flagNameConsulLogLevel = "consul-log-level"
+
+	flagNameDNSEnabled = "dns-enabled"
+	defaultDNSEnabled  = false
+
+	flagNameDNSClusterIP = "dns-cluster-ip"
+
+	flagNameWaitForServers = "wait-for-servers"
+	defaultWaitForServers  = false
+
+	flagNameWaitForJobs = "wait-for-jobs"
+	defaultWaitForJobs  = false
+
+	flagNameHookTimeout = "hook-timeout"
+
+	flagNameEnableMetrics = "enable-metrics"
+	defaultEnableMetrics  = false
+
+	flagNameMetricsPort = "metrics-port"
+
+	flagNamePodSecurityLevel = "pod-security-level"
+
+	flagNameServerPriorityClass = "server-priority-class"
+
+	flagNameCreatePriorityClass = "create-priority-class"
+	defaultCreatePriorityClass  = false
+
+	flagNamePriorityClassValue = "priority-class-value"
+	defaultPriorityClassValue  = 1000000
+
+	flagNameCreateStorageClass = "create-storage-class"
+	defaultCreateStorageClass  = false
+
+	flagNameStorageClassProvisioner = "storage-class-provisioner"
+	flagNameStorageClassParameters  = "storage-class-parameter"
+
+	flagNameImagePullSecrets = "image-pull-secret"
+
+	flagNameCreatePullSecret = "create-pull-secret"
+	flagNameRegistryServer   = "registry-server"
+	defaultRegistryServer    = "https://index.docker.io/v1/"
+	flagNameRegistryUsername = "registry-username"
+	flagNameRegistryPassword = "registry-password"
+
+	// maxPriorityClassValue is the highest value Kubernetes allows for user-defined priority classes.
+	maxPriorityClassValue = 1000000000
+
+	flagNameSecurityAdvice = "security-advice"
+	defaultSecurityAdvice  = true
+
+	flagNameServerAnnotations = "server-annotations"
+	flagNameClientAnnotations = "client-annotations"
+
+	flagNameClientEnv = "client-env"
+
+	flagNameServerServiceAccountAnnotations = "server-service-account-annotations"
+	flagNameClientServiceAccountAnnotations = "client-service-account-annotations"
+
+	flagNameTopologySpread = "topology-spread"
+	defaultTopologySpread  = false
+
+	flagNameTopologyMaxSkew = "topology-max-skew"
+	defaultTopologyMaxSkew  = 1
+
+	flagNameTopologyWhenUnsatisfiable = "topology-when-unsatisfiable"
+	defaultTopologyWhenUnsatisfiable  = "DoNotSchedule"
+
+	// The Pod Security Standards levels that can be set with -pod-security-level.
+	podSecurityPrivileged = "privileged"
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+
+	// eventPollInterval is how often events are checked while waiting for the installation to be ready.
+	eventPollInterval = 5 * time.Second
 )
 
+// Exit codes returned by Run, so that automation can tell apart why an installation did not complete.
+const (
+	exitCodeSuccess = 0
+	// exitCodeError is returned for invalid flags or values and any error not covered below.
+	exitCodeError = 1
+	// exitCodePreflight is returned when a pre-install check fails.
+	exitCodePreflight = 2
+	// exitCodeAborted is returned when the user does not confirm the installation.
+	exitCodeAborted = 3
+	// exitCodeHelm is returned when Helm fails to install the chart.
+	exitCodeHelm = 4
+)
+
+// notableEventReasons are the reasons of Kubernetes warning events that usually explain why an installation is not
+// becoming ready.
+var notableEventReasons = map[string]bool{
+	"BackOff":          true,
+	"ErrImagePull":     true,
+	"Failed":           true,
+	"FailedCreate":     true,
+	"FailedMount":      true,
+	"FailedScheduling": true,
+	"ImagePullBackOff": true,
+	"Unhealthy":        true,
+}
+
 type Command struct {
 	*common.BaseCommand
 
 	kubernetes kubernetes.Interface
 
+	// checkForInstallations finds an existing installation and uninstall uninstalls it for -force-reinstall. They
+	// default to common.CheckForInstallations and running the uninstall command, and are replaced in tests.
+	checkForInstallations func(settings *helmCLI.EnvSettings, uiLogger action.DebugLog) (string, string, error)
+	uninstall             func(name, namespace string) error
+
+	// proxyClient is the REST client of the core API group used to reach the Consul servers through the Kubernetes
+	// API server's service proxy. It defaults to the REST client of kubernetes and is replaced in tests.
+	proxyClient rest.Interface
+
+	// currentValues are the values of the release being upgraded, set by the upgrade command.
+	currentValues map[string]interface{}
+
 	set *flag.Sets
 
 	flagPreset          string
+	flagChartVersion    string
+	flagHelmRepoURL     string
+	flagVerify          bool
+	flagKeyring         string
 	flagNamespace       string
 	flagDryRun          bool
 	flagAutoApprove     bool
+	flagOutput          string
 	flagValueFiles      []string
 	flagSetStringValues []string
 	flagSetValues       []string
 	flagFileValues      []string
+	flagLiteralValues   map[string]string
+	flagBaseValues      string
+	flagValuesSchema    string
+	valuesSchema        []byte
 	flagTimeout         string
 	timeoutDuration     time.Duration
 	flagVerbose         bool
+	flagLogLevel        string
 	flagWait            bool
+	flagCAFile          string
+	flagCheckResources  bool
+	flagReusePVCs       bool
+
+	flagSkipPreInstallChecks bool
+
+	flagBootstrapSecretPatterns []string
+	flagForceReinstall          bool
+
+	flagEnableNamespaceMirroring bool
+	flagMirroringPrefix          string
+
+	flagStrict bool
+
+	flagClientOnly      bool
+	flagExternalServers []string
+
+	flagServerResources string
+	flagClientResources string
+
+	flagServerExtraConfig string
+	flagClientExtraConfig string
+
+	flagConsulLogLevel string
+
+	flagDNSEnabled   bool
+	flagDNSClusterIP string
+
+	flagWaitForServers bool
+
+	flagWaitForJobs     bool
+	flagHookTimeout     string
+	hookTimeoutDuration time.Duration
+
+	flagEnableMetrics bool
+	flagMetricsPort   int
+
+	flagHistoryMax int
+
+	flagReleaseDescription string
+
+	flagNoNotes bool
+
+	flagSecurityAdvice bool
+
+	flagPodSecurityLevel string
+
+	flagServerPriorityClass string
+	flagCreatePriorityClass bool
+	flagPriorityClassValue  int
+
+	flagCreateStorageClass      bool
+	flagStorageClassProvisioner string
+	flagStorageClassParameters  map[string]string
+
+	flagImagePullSecrets []string
+	flagCreatePullSecret string
+	flagRegistryServer   string
+	flagRegistryUsername string
+	flagRegistryPassword string
+
+	flagServerAnnotations map[string]string
+	flagClientAnnotations map[string]string
+
+	flagClientEnv map[string]string
+
+	flagServerServiceAccountAnnotations map[string]string
+	flagClientServiceAccountAnnotations map[string]string
+
+	flagTopologySpread            bool
+	flagTopologyMaxSkew           int
+	flagTopologyWhenUnsatisfiable string
 
 	flagKubeConfig  string
 	flagKubeContext string
@@ -79,12 +364,6 @@ type Command struct {
 }
 
 func (c *Command) init() {
-	// Store all the possible preset values in 'presetList'. Printed in the help message.
-	var presetList []string
-	for name := range presets {
-		presetList = append(presetList, name)
-	}
-
 	c.set = flag.NewSets()
 	f := c.set.NewSet("Command Options")
 	f.BoolVar(&flag.BoolVar{
@@ -99,11 +378,20 @@ func (c *Command) init() {
 		Default: defaultDryRun,
 		Usage:   "Run pre-install checks and display summary of installation.",
 	})
-	f.StringSliceVar(&flag.StringSliceVar{
-		Name:    flagNameConfigFile,
-		Aliases: []string{"f"},
-		Target:  &c.flagValueFiles,
-		Usage:   "Path to a file to customize the installation, such as Consul Helm chart values file. Can be specified multiple times.",
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:    flagNameOutput,
+		Target:  &c.flagOutput,
+		Default: common.OutputTable,
+		Values:  []string{common.OutputTable, common.OutputJSON},
+		Usage: fmt.Sprintf("Output format. With json, a document with the installation's name, namespace, chart "+
+			"version, values and status is output instead of the text, which is output to stderr. Requires -%s or "+
+			"-%s.", flagNameAutoApprove, flagNameDryRun),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameValuesSchema,
+		Target: &c.flagValuesSchema,
+		Usage: "Path to a JSON schema file to validate the values against instead of the schema bundled with the " +
+			"chart, e.g. for a customized chart.",
 	})
 	f.StringVar(&flag.StringVar{
 		Name:    flagNameNamespace,
@@ -111,28 +399,6 @@ func (c *Command) init() {
 		Default: common.DefaultReleaseNamespace,
 		Usage:   "Namespace for the Consul installation.",
 	})
-	f.StringVar(&flag.StringVar{
-		Name:    flagNamePreset,
-		Target:  &c.flagPreset,
-		Default: defaultPreset,
-		Usage:   fmt.Sprintf("Use an installation preset, one of %s. Defaults to none", strings.Join(presetList, ", ")),
-	})
-	f.StringSliceVar(&flag.StringSliceVar{
-		Name:   flagNameSetValues,
-		Target: &c.flagSetValues,
-		Usage:  "Set a value to customize. Can be specified multiple times. Supports Consul Helm chart values.",
-	})
-	f.StringSliceVar(&flag.StringSliceVar{
-		Name:   flagNameFileValues,
-		Target: &c.flagFileValues,
-		Usage: "Set a value to customize via a file. The contents of the file will be set as the value. Can be " +
-			"specified multiple times. Supports Consul Helm chart values.",
-	})
-	f.StringSliceVar(&flag.StringSliceVar{
-		Name:   flagNameSetStringValues,
-		Target: &c.flagSetStringValues,
-		Usage:  "Set a string value to customize. Can be specified multiple times. Supports Consul Helm chart values.",
-	})
 	f.StringVar(&flag.StringVar{
 		Name:    flagNameTimeout,
 		Target:  &c.flagTimeout,
@@ -146,12 +412,164 @@ func (c *Command) init() {
 		Default: defaultVerbose,
 		Usage:   "Output verbose logs from the install command with the status of resources being installed.",
 	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:    flagNameLogLevel,
+		Target:  &c.flagLogLevel,
+		Default: defaultLogLevel,
+		Values:  []string{"trace", "debug", "info", "warn", "error"},
+		Usage:   "Log level of the structured logs of each installation step, e.g. debug to troubleshoot an installation.",
+	})
 	f.BoolVar(&flag.BoolVar{
 		Name:    flagNameWait,
 		Target:  &c.flagWait,
 		Default: defaultWait,
-		Usage:   "Determines whether to wait for resources in installation to be ready before exiting command.",
+		Usage: "Determines whether to wait for resources in installation to be ready before exiting command. " +
+			"With -wait=false, the command returns once the chart is installed and prints the release name.",
+	})
+	c.AddHistoryMaxFlag(f)
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameReleaseDescription,
+		Target: &c.flagReleaseDescription,
+		Usage: "Description to record on the Helm release, for example a ticket ID or owner. It is shown by " +
+			"helm history.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameNoNotes,
+		Target:  &c.flagNoNotes,
+		Default: defaultNoNotes,
+		Usage:   "Do not output the chart's notes with the next steps after a successful installation.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameCheckResources,
+		Target:  &c.flagCheckResources,
+		Default: defaultCheckResources,
+		Usage: "Compare the CPU and memory requested by the installation with the allocatable capacity of the " +
+			"cluster's nodes. Only warns if a check fails.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameReusePVCs,
+		Target:  &c.flagReusePVCs,
+		Default: defaultReusePVCs,
+		Usage: "Allow persistent volume claims from a previous installation to exist so that the new Consul servers " +
+			"bind to them and keep their data.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameSkipPreInstallChecks,
+		Target:  &c.flagSkipPreInstallChecks,
+		Default: defaultSkipPreInstallChecks,
+		Usage: "Skip all pre-install checks for existing installations, persistent volume claims and secrets. " +
+			"Leftovers from previous installations may conflict with the new installation or cause data loss.",
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameBootstrapSecretPatterns,
+		Target: &c.flagBootstrapSecretPatterns,
+		Usage: "Substring of the name of an ACL bootstrap token secret left over from a previous installation, for " +
+			"charts that name it differently. Can be specified multiple times. Defaults to the name used by the " +
+			"Consul chart, consul-bootstrap-acl-token.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameForceReinstall,
+		Target:  &c.flagForceReinstall,
+		Default: defaultForceReinstall,
+		Usage: "If Consul is already installed, uninstall it and delete all of its data, including PVCs and " +
+			"secrets, before installing it again. Intended for development clusters.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameStrict,
+		Target:  &c.flagStrict,
+		Default: defaultStrict,
+		Usage:   "Fail instead of warning when the values are inconsistent or the storage class does not exist.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameWaitForServers,
+		Target:  &c.flagWaitForServers,
+		Default: defaultWaitForServers,
+		Usage: fmt.Sprintf("After installing, wait until server.bootstrapExpect Consul servers have joined the Raft "+
+			"cluster, which pods being ready does not guarantee, or until -%s expires.", flagNameTimeout),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameWaitForJobs,
+		Target:  &c.flagWaitForJobs,
+		Default: defaultWaitForJobs,
+		Usage: fmt.Sprintf("Wait until the jobs of the installation, such as server-acl-init, have completed as well "+
+			"as its other resources being ready. The jobs and the chart's hooks, such as tls-init, are waited for up "+
+			"to -%s rather than -%s. Requires -%s.", flagNameHookTimeout, flagNameTimeout, flagNameWait),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameHookTimeout,
+		Target: &c.flagHookTimeout,
+		Usage: fmt.Sprintf("Timeout to wait for each hook and for the jobs with -%s, separate from -%s. Defaults "+
+			"to -%s.", flagNameWaitForJobs, flagNameTimeout, flagNameTimeout),
+	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:   flagNamePodSecurityLevel,
+		Target: &c.flagPodSecurityLevel,
+		Values: []string{podSecurityPrivileged, podSecurityBaseline, podSecurityRestricted},
+		Usage: "Pod Security Standard that PodSecurity admission enforces, audits and warns about in the installation " +
+			"namespace. The namespace is labeled accordingly, and created if it does not exist.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameCreatePriorityClass,
+		Target:  &c.flagCreatePriorityClass,
+		Default: defaultCreatePriorityClass,
+		Usage: fmt.Sprintf("Create the priority class set by -%s with the value of -%s if it does not exist.",
+			flagNameServerPriorityClass, flagNamePriorityClassValue),
+	})
+	f.IntVar(&flag.IntVar{
+		Name:    flagNamePriorityClassValue,
+		Target:  &c.flagPriorityClassValue,
+		Default: defaultPriorityClassValue,
+		Usage:   fmt.Sprintf("Value of the priority class created by -%s.", flagNameCreatePriorityClass),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameCreateStorageClass,
+		Target:  &c.flagCreateStorageClass,
+		Default: defaultCreateStorageClass,
+		Usage: fmt.Sprintf("Create the storage class set by server.storageClass with the provisioner of -%s and the "+
+			"parameters of -%s if it does not exist.", flagNameStorageClassProvisioner, flagNameStorageClassParameters),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameStorageClassProvisioner,
+		Target: &c.flagStorageClassProvisioner,
+		Usage:  fmt.Sprintf("Provisioner of the storage class created by -%s, e.g. ebs.csi.aws.com.", flagNameCreateStorageClass),
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameStorageClassParameters,
+		Target: &c.flagStorageClassParameters,
+		Usage: fmt.Sprintf("Parameter in the form key=value of the storage class created by -%s. Can be specified "+
+			"multiple times.", flagNameCreateStorageClass),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameCreatePullSecret,
+		Target: &c.flagCreatePullSecret,
+		Usage: fmt.Sprintf("Name of a docker-registry secret to create in the installation namespace from -%s, -%s "+
+			"and -%s, and to use as an image pull secret. An existing secret with that name is left as is.",
+			flagNameRegistryServer, flagNameRegistryUsername, flagNameRegistryPassword),
 	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameRegistryServer,
+		Target:  &c.flagRegistryServer,
+		Default: defaultRegistryServer,
+		Usage:   fmt.Sprintf("Server of the private registry. Used by -%s.", flagNameCreatePullSecret),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameRegistryUsername,
+		Target: &c.flagRegistryUsername,
+		Usage:  fmt.Sprintf("Username for the private registry. Used by -%s.", flagNameCreatePullSecret),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameRegistryPassword,
+		Target: &c.flagRegistryPassword,
+		Usage:  fmt.Sprintf("Password for the private registry. Used by -%s.", flagNameCreatePullSecret),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameSecurityAdvice,
+		Target:  &c.flagSecurityAdvice,
+		Default: defaultSecurityAdvice,
+		Usage: fmt.Sprintf("Warn about the security features of the %q preset that the installation disables. "+
+			"Set to false to suppress the warning.", PresetSecure),
+	})
+	c.AddValuesFlags(f)
 
 	f = c.set.NewSet("Global Options")
 	f.StringVar(&flag.StringVar{
@@ -174,18 +592,241 @@ func (c *Command) init() {
 	c.Init()
 }
 
+// AddValuesFlags adds the flags that select the Consul Helm chart and set its values to f. The upgrade command adds
+// them too, so that it locates the chart and merges the values exactly like install does.
+func (c *Command) AddValuesFlags(f *flag.Set) {
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameChartVersion,
+		Target: &c.flagChartVersion,
+		Usage: fmt.Sprintf("Version of the Consul Helm chart to install or upgrade to, downloaded from -%s. Defaults "+
+			"to the chart version embedded in the CLI.", flagNameHelmRepoURL),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameHelmRepoURL,
+		Target:  &c.flagHelmRepoURL,
+		Default: defaultHelmRepoURL,
+		EnvVar:  envHelmRepoURL,
+		Usage: fmt.Sprintf("URL of the Helm repository that -%s downloads the Consul Helm chart from, e.g. an internal "+
+			"mirror.", flagNameChartVersion),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameVerify,
+		Target:  &c.flagVerify,
+		Default: defaultVerify,
+		Usage: fmt.Sprintf("Verify the provenance of the chart downloaded with -%s against -%s before using it. Fails "+
+			"if the chart is unsigned or its signature doesn't verify.", flagNameChartVersion, flagNameKeyring),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameKeyring,
+		Target: &c.flagKeyring,
+		Usage:  fmt.Sprintf("Path to the keyring with the public keys trusted by -%s.", flagNameVerify),
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:    flagNameConfigFile,
+		Aliases: []string{"f"},
+		Target:  &c.flagValueFiles,
+		Usage:   "Path to a file to customize the installation, such as Consul Helm chart values file. Can be specified multiple times.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameBaseValues,
+		Target: &c.flagBaseValues,
+		Usage: "Path to a values file, for example the output of get-values for a previous installation, to start " +
+			"from. It has the lowest precedence, so -preset, -f and the -set flags override its values.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNamePreset,
+		Target:  &c.flagPreset,
+		Default: defaultPreset,
+		Usage:   fmt.Sprintf("Use an installation preset, one of %s. Defaults to none", strings.Join(PresetNames(), ", ")),
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameSetValues,
+		Target: &c.flagSetValues,
+		Usage:  "Set a value to customize. Can be specified multiple times. Supports Consul Helm chart values.",
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameFileValues,
+		Target: &c.flagFileValues,
+		Usage: "Set a value to customize via a file. The contents of the file will be set as the value. Can be " +
+			"specified multiple times. Supports Consul Helm chart values.",
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameSetStringValues,
+		Target: &c.flagSetStringValues,
+		Usage:  "Set a string value to customize. Can be specified multiple times. Supports Consul Helm chart values.",
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameLiteralValues,
+		Target: &c.flagLiteralValues,
+		Usage: "Set a string value to customize, taking everything after the first '=' literally. Dots in the key " +
+			"separate nested keys and can be escaped with '\\'. Can be specified multiple times. Supports Consul Helm chart values.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameCAFile,
+		Target: &c.flagCAFile,
+		Usage: fmt.Sprintf("Path to a PEM-encoded CA bundle, e.g. of an internal CA. It is trusted when downloading "+
+			"the chart with -%s from -%s and values files over HTTPS. Of the installed components, only the snapshot "+
+			"agent trusts it, by setting client.snapshotAgent.caCert, e.g. for an S3-compatible snapshot storage. The "+
+			"other Consul components do not.", flagNameChartVersion, flagNameHelmRepoURL),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameEnableNamespaceMirroring,
+		Target:  &c.flagEnableNamespaceMirroring,
+		Default: defaultEnableNamespaceMirroring,
+		Usage: "Enable Consul namespaces and register services injected by connect-inject into the Consul namespace " +
+			"matching their Kubernetes namespace. Requires Consul Enterprise.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameMirroringPrefix,
+		Target: &c.flagMirroringPrefix,
+		Usage:  fmt.Sprintf("Prefix added to the mirrored Consul namespaces. Requires -%s.", flagNameEnableNamespaceMirroring),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameClientOnly,
+		Target:  &c.flagClientOnly,
+		Default: defaultClientOnly,
+		Usage: fmt.Sprintf("Install only Consul clients that join the Consul servers given by -%s instead of "+
+			"installing Consul servers.", flagNameExternalServers),
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameExternalServers,
+		Target: &c.flagExternalServers,
+		Usage: fmt.Sprintf("Host of an external Consul server to join. Can be specified multiple times. Requires -%s.",
+			flagNameClientOnly),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameServerResources,
+		Target: &c.flagServerResources,
+		Usage: "CPU and memory requests and limits of the Consul servers, in the form cpu=<quantity>,mem=<quantity>, " +
+			"e.g. cpu=500m,mem=1Gi. Either may be omitted.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameClientResources,
+		Target: &c.flagClientResources,
+		Usage: "CPU and memory requests and limits of the Consul clients, in the form cpu=<quantity>,mem=<quantity>, " +
+			"e.g. cpu=100m,mem=100Mi. Either may be omitted.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameServerExtraConfig,
+		Target: &c.flagServerExtraConfig,
+		Usage: "Extra Consul agent configuration of the servers, as a JSON object or the path to a file " +
+			"containing one. Sets server.extraConfig.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameClientExtraConfig,
+		Target: &c.flagClientExtraConfig,
+		Usage: "Extra Consul agent configuration of the clients, as a JSON object or the path to a file " +
+			"containing one. Sets client.extraConfig.",
+	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:   flagNameConsulLogLevel,
+		Target: &c.flagConsulLogLevel,
+		Values: []string{"trace", "debug", "info", "warn", "error"},
+		Usage: fmt.Sprintf("Log level of the Consul servers and clients. Sets log_level in server.extraConfig and "+
+			"client.extraConfig, so it cannot be combined with a log_level set by -%s or -%s.",
+			flagNameServerExtraConfig, flagNameClientExtraConfig),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameDNSEnabled,
+		Target:  &c.flagDNSEnabled,
+		Default: defaultDNSEnabled,
+		Usage: "Expose Consul DNS as a ClusterIP service. Sets dns.enabled. After an installation, its IP and the " +
+			"CoreDNS stub domain configuration that forwards the consul domain to it are output.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameDNSClusterIP,
+		Target: &c.flagDNSClusterIP,
+		Usage: fmt.Sprintf("Cluster IP of the Consul DNS service, so it can be referenced in the CoreDNS "+
+			"configuration before installing. Sets dns.clusterIP. Requires -%s.", flagNameDNSEnabled),
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameEnableMetrics,
+		Target:  &c.flagEnableMetrics,
+		Default: defaultEnableMetrics,
+		Usage: "Expose Prometheus metrics of the Consul agents, gateways and connect-injected pods, with the " +
+			"Prometheus scrape annotations on their pods. Sets global.metrics.enabled, " +
+			"global.metrics.enableAgentMetrics and connectInject.metrics.defaultEnabled. Not supported with " +
+			"HTTPS only TLS.",
+	})
+	f.IntVar(&flag.IntVar{
+		Name:   flagNameMetricsPort,
+		Target: &c.flagMetricsPort,
+		Usage: fmt.Sprintf("Port Prometheus scrapes the metrics of connect-injected pods from. Sets "+
+			"connectInject.metrics.defaultPrometheusScrapePort. Requires -%s.", flagNameEnableMetrics),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameServerPriorityClass,
+		Target: &c.flagServerPriorityClass,
+		Usage:  "Name of the priority class of the Consul servers, to protect them from eviction under node pressure.",
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameImagePullSecrets,
+		Target: &c.flagImagePullSecrets,
+		Usage: "Name of an image pull secret in the installation namespace used to pull the images from a private " +
+			"registry. Can be specified multiple times. Sets global.imagePullSecrets.",
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameServerAnnotations,
+		Target: &c.flagServerAnnotations,
+		Usage:  "Annotation in the form key=value to add to the Consul server pods. Can be specified multiple times.",
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameClientAnnotations,
+		Target: &c.flagClientAnnotations,
+		Usage:  "Annotation in the form key=value to add to the Consul client pods. Can be specified multiple times.",
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameClientEnv,
+		Target: &c.flagClientEnv,
+		Usage:  "Environment variable in the form key=value to set on the Consul clients. Can be specified multiple times.",
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameServerServiceAccountAnnotations,
+		Target: &c.flagServerServiceAccountAnnotations,
+		Usage: "Annotation in the form key=value to add to the service account of the Consul servers, e.g. to " +
+			"bind a cloud IAM role. Can be specified multiple times.",
+	})
+	f.StringMapVar(&flag.StringMapVar{
+		Name:   flagNameClientServiceAccountAnnotations,
+		Target: &c.flagClientServiceAccountAnnotations,
+		Usage: "Annotation in the form key=value to add to the service account of the Consul clients, e.g. to " +
+			"bind a cloud IAM role. Can be specified multiple times.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameTopologySpread,
+		Target:  &c.flagTopologySpread,
+		Default: defaultTopologySpread,
+		Usage:   "Spread the Consul servers across the zones given by the topology.kubernetes.io/zone node label.",
+	})
+	f.IntVar(&flag.IntVar{
+		Name:    flagNameTopologyMaxSkew,
+		Target:  &c.flagTopologyMaxSkew,
+		Default: defaultTopologyMaxSkew,
+		Usage: fmt.Sprintf("Maximum difference in the number of Consul servers between any two zones. Requires -%s.",
+			flagNameTopologySpread),
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameTopologyWhenUnsatisfiable,
+		Target:  &c.flagTopologyWhenUnsatisfiable,
+		Default: defaultTopologyWhenUnsatisfiable,
+		Usage: fmt.Sprintf("What to do with a Consul server that cannot be scheduled within the maximum skew, "+
+			"either DoNotSchedule or ScheduleAnyway. Requires -%s.", flagNameTopologySpread),
+	})
+}
+
 func (c *Command) Run(args []string) int {
 	c.once.Do(c.init)
 
 	// The logger is initialized in main with the name cli. Here, we reset the name to install so log lines would be prefixed with install.
-	c.Log.ResetNamed("install")
+	c.Log = c.Log.ResetNamed("install")
 
 	defer common.CloseWithError(c.BaseCommand)
 
 	if err := c.validateFlags(args); err != nil {
 		c.UI.Output(err.Error())
-		return 1
+		return exitCodeError
 	}
+	c.Log.SetLevel(hclog.LevelFromString(c.flagLogLevel))
 
 	// helmCLI.New() will create a settings object which is used by the Helm Go SDK calls.
 	settings := helmCLI.New()
@@ -222,56 +863,117 @@ func (c *Command) Run(args []string) int {
 		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
 		if err != nil {
 			c.UI.Output("Retrieving Kubernetes auth: %v", err, terminal.WithErrorStyle())
-			return 1
+			return exitCodeError
 		}
 		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
 		if err != nil {
 			c.UI.Output("Initializing Kubernetes client: %v", err, terminal.WithErrorStyle())
-			return 1
+			return exitCodeError
 		}
 	}
 
 	c.UI.Output("Pre-Install Checks", terminal.WithHeaderStyle())
-
-	// Note the logic here, common's CheckForInstallations function returns an error if
-	// the release is not found, which in the install command is what we need for a successful install.
-	if name, ns, err := common.CheckForInstallations(settings, uiLogger); err == nil {
-		c.UI.Output(fmt.Sprintf("existing Consul installation found (name=%s, namespace=%s) - run "+
-			"consul-k8s uninstall if you wish to re-install", name, ns), terminal.WithErrorStyle())
-		return 1
-	} else {
-		c.UI.Output("No existing installations found.")
+	c.Log.Debug("running pre-install checks", "namespace", c.flagNamespace, "skip", c.flagSkipPreInstallChecks)
+	if c.flagChartVersion != "" {
+		c.UI.Output("Consul Helm chart version %s will be downloaded from %s", c.flagChartVersion, c.flagHelmRepoURL,
+			terminal.WithInfoStyle())
 	}
-
-	// Ensure there's no previous PVCs lying around.
-	if err := c.checkForPreviousPVCs(); err != nil {
+	// The chart is located first since the checks and the defaults of the values depend on the chart being installed.
+	c.Log.Debug("loading chart", "version", c.flagChartVersion)
+	chart, err := c.LocateChart(settings)
+	if err != nil {
 		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+		return exitCodeHelm
 	}
+	c.Log.Debug("loaded chart", "name", chart.Metadata.Name, "version", chart.Metadata.Version)
 
-	// Ensure there's no previous bootstrap secret lying around.
-	if err := c.checkForPreviousSecrets(); err != nil {
+	// Handle preset, value files, and set values logic.
+	vals, err := c.MergeValuesFlagsWithPrecedence(settings)
+	if err != nil {
 		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+		return exitCodeError
 	}
-
-	// Handle preset, value files, and set values logic.
-	vals, err := c.mergeValuesFlagsWithPrecedence(settings)
+	datacenter, err := effectiveDatacenter(chart, vals)
 	if err != nil {
 		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+		return exitCodeError
 	}
-	valuesYaml, err := yaml.Marshal(vals)
+	c.Log.Debug("merged values", "preset", c.flagPreset, "value_files", len(c.flagValueFiles), "datacenter", datacenter)
+	role, err := federationRole(chart, vals, datacenter)
 	if err != nil {
 		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+		return exitCodeError
+	}
+	// The existing servers are checked before the pre-install checks, which refuse or, with -force-reinstall,
+	// uninstall an existing installation.
+	if role == federationPrimary && !c.flagSkipPreInstallChecks {
+		if err := c.checkExistingPrimary(c.Ctx, datacenter); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodePreflight
+		}
+	}
+	if err := c.preInstallChecks(settings, uiLogger); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return exitCodePreflight
+	}
+	// Helm refuses to install the chart on an unsupported Kubernetes version, so this check always fails.
+	if !c.flagSkipPreInstallChecks {
+		if err := c.checkKubernetesVersion(chart); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodePreflight
+		}
 	}
 
-	// Print out the installation summary.
-	if !c.flagAutoApprove {
-		c.UI.Output("Consul Installation Summary", terminal.WithHeaderStyle())
+	if err := checkAgentMetrics(chart, vals); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return exitCodeError
+	}
+	if err := checkServerReplicas(chart, vals); err != nil {
+		if c.flagStrict {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodePreflight
+		}
+		c.UI.Output(err.Error(), terminal.WithWarningStyle())
+	}
+	storageClass := effectiveStorageClass(chart, vals)
+	if c.flagCreateStorageClass && storageClass == "" {
+		c.UI.Output("-%s requires server.storageClass to be set", flagNameCreateStorageClass, terminal.WithErrorStyle())
+		return exitCodeError
+	}
+	if storageClass != "" && !c.flagSkipPreInstallChecks && !c.flagCreateStorageClass {
+		if err := c.checkStorageClass(storageClass); err != nil {
+			if c.flagStrict {
+				c.UI.Output(err.Error(), terminal.WithErrorStyle())
+				return exitCodePreflight
+			}
+			c.UI.Output(err.Error(), terminal.WithWarningStyle())
+		}
+	}
+	valuesYaml, err := marshalValues(vals)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return exitCodeError
+	}
+	if err := c.validateValues(chart, vals); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return exitCodeError
+	}
+
+	// Print out the installation summary.
+	if !c.flagAutoApprove {
+		c.UI.Output("Consul Installation Summary", terminal.WithHeaderStyle())
 		c.UI.Output("Installation name: %s", common.DefaultReleaseName, terminal.WithInfoStyle())
 		c.UI.Output("Namespace: %s", c.flagNamespace, terminal.WithInfoStyle())
+		c.UI.Output("Chart version: %s", chart.Metadata.Version, terminal.WithInfoStyle())
+		if role != "" {
+			c.UI.Output("Datacenter: %s (%s)", datacenter, role, terminal.WithInfoStyle())
+		} else {
+			c.UI.Output("Datacenter: %s", datacenter, terminal.WithInfoStyle())
+		}
+		if c.flagCAFile != "" {
+			c.UI.Output("CA file: %s (trusted by the snapshot agent only, not by the Consul servers, clients or "+
+				"control plane)", c.flagCAFile, terminal.WithInfoStyle())
+		}
 
 		if len(vals) == 0 {
 			c.UI.Output("Overrides: "+string(valuesYaml), terminal.WithInfoStyle())
@@ -279,81 +981,196 @@ func (c *Command) Run(args []string) int {
 			c.UI.Output("Overrides:"+"\n"+string(valuesYaml), terminal.WithInfoStyle())
 		}
 	}
+	if c.flagPodSecurityLevel == podSecurityRestricted && c.flagPreset != PresetSecure {
+		c.UI.Output("The %q Pod Security Standard may reject Consul pods that are not configured like the %q preset.",
+			podSecurityRestricted, PresetSecure, terminal.WithWarningStyle())
+	}
+	if c.flagSecurityAdvice {
+		if disabled := securityAdvice(chart, vals); len(disabled) != 0 {
+			c.UI.Output("Security features enabled by the %q preset are disabled: %s. Use -%s=false to suppress "+
+				"this warning.", PresetSecure, strings.Join(disabled, ", "), flagNameSecurityAdvice, terminal.WithWarningStyle())
+		}
+	}
 
 	// Without informing the user, default global.name to consul if it hasn't been set already. We don't allow setting
 	// the release name, and since that is hardcoded to "consul", setting global.name to "consul" makes it so resources
 	// aren't double prefixed with "consul-consul-...".
-	vals = mergeMaps(convert(globalNameConsul), vals)
+	vals = common.MergeMaps(convert(globalNameConsul), vals)
 
-	// Dry Run should exit here, no need to actual locate/download the charts.
+	if c.flagCheckResources {
+		if err := c.runResourceChecks(chart, vals, uiLogger); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodePreflight
+		}
+	}
+
+	// Dry Run should exit here, after outputting the manifests that would be applied.
 	if c.flagDryRun {
+		manifest, err := c.renderManifest(chart, vals, uiLogger)
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeHelm
+		}
+		c.Log.Debug("dry run complete")
+		if c.flagOutput == common.OutputJSON {
+			return c.outputResult(installResult{
+				Name:         common.DefaultReleaseName,
+				Namespace:    c.flagNamespace,
+				ChartVersion: chart.Metadata.Version,
+				Values:       vals,
+				Status:       statusDryRun,
+				Manifest:     manifest,
+			}, exitCodeSuccess)
+		}
+		c.UI.Output("Rendered Manifests", terminal.WithHeaderStyle())
+		c.UI.Output("%s", manifest)
 		c.UI.Output("Dry run complete - installation can proceed.", terminal.WithInfoStyle())
-		return 0
+		return exitCodeSuccess
 	}
 
 	if !c.flagAutoApprove {
-		confirmation, err := c.UI.Input(&terminal.Input{
-			Prompt: "Proceed with installation? (y/N)",
-			Style:  terminal.InfoStyle,
-			Secret: false,
-		})
-
+		confirmed, err := terminal.Confirm(c.UI, "Proceed with installation?", false)
 		if err != nil {
 			c.UI.Output(err.Error(), terminal.WithErrorStyle())
-			return 1
+			return exitCodeError
 		}
-		if common.Abort(confirmation) {
+		if !confirmed {
 			c.UI.Output("Install aborted. To learn how to customize your installation, run:\nconsul-k8s install --help", terminal.WithInfoStyle())
-			return 1
+			return exitCodeAborted
 		}
 	}
 
 	c.UI.Output("Running Installation", terminal.WithHeaderStyle())
 
+	if c.flagPodSecurityLevel != "" {
+		if err := c.applyPodSecurityLabels(c.flagNamespace, c.flagPodSecurityLevel); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeError
+		}
+	}
+	if c.flagCreatePriorityClass {
+		if err := c.ensurePriorityClass(c.flagServerPriorityClass, int32(c.flagPriorityClassValue)); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeError
+		}
+	}
+	if c.flagCreateStorageClass {
+		if err := c.ensureStorageClass(storageClass, c.flagStorageClassProvisioner, c.flagStorageClassParameters); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeError
+		}
+	}
+	if c.flagCreatePullSecret != "" {
+		if err := c.ensurePullSecret(c.flagCreatePullSecret, c.flagNamespace); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeError
+		}
+	}
+
 	// Setup action configuration for Helm Go SDK function calls.
 	actionConfig := new(action.Configuration)
 	actionConfig, err = common.InitActionConfig(actionConfig, c.flagNamespace, settings, uiLogger)
 	if err != nil {
 		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+		return exitCodeHelm
 	}
 
-	// Setup the installation action.
-	install := action.NewInstall(actionConfig)
-	install.ReleaseName = common.DefaultReleaseName
-	install.Namespace = c.flagNamespace
-	install.CreateNamespace = true
-	install.Wait = c.flagWait
-	install.Timeout = c.timeoutDuration
-
-	// Read the embedded chart files into []*loader.BufferedFile.
-	chartFiles, err := common.ReadChartFiles(consulChart.ConsulHelmChart, common.TopLevelChartDirName)
-	if err != nil {
-		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+	// Bound the release history. History left over from previous installations is pruned here to make space for
+	// the new release, since Helm's own pruning fails when the release has no deployed revision.
+	if c.flagHistoryMax > 0 {
+		actionConfig.Releases.MaxHistory = c.flagHistoryMax
+		if err := pruneReleaseHistory(actionConfig.Releases, common.DefaultReleaseName, c.flagHistoryMax-1); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeHelm
+		}
 	}
 
-	// Create a *chart.Chart object from the files to run the installation from.
-	chart, err := loader.LoadFiles(chartFiles)
-	if err != nil {
-		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+	// Setup the installation action.
+	install := c.newInstallAction(actionConfig)
+
+	// While Helm waits for the resources to be ready, surface events that explain why they are not.
+	stopEvents := func() {}
+	if c.flagWait {
+		ctx, cancel := context.WithCancel(c.Ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.watchEvents(ctx, c.flagNamespace, eventPollInterval, func(event v1.Event) {
+				c.UI.Output("%s/%s: %s: %s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name,
+					event.Reason, event.Message, terminal.WithWarningStyle())
+			})
+		}()
+		stopEvents = func() {
+			cancel()
+			<-done
+		}
 	}
-	c.UI.Output("Downloaded charts", terminal.WithSuccessStyle())
 
 	// Run the install.
-	_, err = install.Run(chart, vals)
+	c.Log.Debug("running helm install", "release", install.ReleaseName, "namespace", install.Namespace,
+		"wait", install.Wait, "timeout", install.Timeout)
+	rel, err := install.Run(chart, vals)
+	stopEvents()
 	if err != nil {
+		c.Log.Debug("helm install failed", "err", err)
 		c.UI.Output(err.Error(), terminal.WithErrorStyle())
-		return 1
+		if c.flagOutput == common.OutputJSON {
+			return c.outputResult(installResult{
+				Name:         common.DefaultReleaseName,
+				Namespace:    c.flagNamespace,
+				ChartVersion: chart.Metadata.Version,
+				Values:       vals,
+				Status:       release.StatusFailed.String(),
+				Error:        err.Error(),
+			}, exitCodeHelm)
+		}
+		return exitCodeHelm
 	}
+	c.Log.Debug("helm install complete")
 	c.UI.Output("Consul installed into namespace %q", c.flagNamespace, terminal.WithSuccessStyle())
+	if !c.flagWait {
+		// The resources may still be starting, so print the release name for a follow-up status check.
+		c.UI.Output("Release %q was installed without waiting for its resources to be ready. Run consul-k8s status "+
+			"to check them.", rel.Name, terminal.WithInfoStyle())
+	}
+	if c.flagWaitForServers {
+		if err := c.waitForServers(chart, vals); err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return exitCodeError
+		}
+	}
+	if c.flagDNSEnabled {
+		if err := c.outputDNS(c.flagNamespace); err != nil {
+			c.UI.Output(err.Error(), terminal.WithWarningStyle())
+		}
+	}
+	if aclsManaged(chart, vals) {
+		if err := c.outputACLTokens(c.flagNamespace); err != nil {
+			c.UI.Output(err.Error(), terminal.WithWarningStyle())
+		}
+	}
+	c.outputNotes(rel)
 
-	return 0
+	if c.flagOutput == common.OutputJSON {
+		return c.outputResult(installResult{
+			Name:         rel.Name,
+			Namespace:    rel.Namespace,
+			ChartVersion: chart.Metadata.Version,
+			Values:       vals,
+			Status:       rel.Info.Status.String(),
+		}, exitCodeSuccess)
+	}
+	return exitCodeSuccess
 }
 func (c *Command) Help() string {
 	c.once.Do(c.init)
-	s := "Usage: consul-k8s install [flags]" + "\n" + "Install Consul onto a Kubernetes cluster." + "\n"
+	s := "Usage: consul-k8s install [flags]" + "\n" + "Install Consul onto a Kubernetes cluster." + "\n\n" +
+		"Exit codes:" + "\n" +
+		fmt.Sprintf("  %d  Consul was installed, or the dry run completed.", exitCodeSuccess) + "\n" +
+		fmt.Sprintf("  %d  Invalid flags or values, or another error.", exitCodeError) + "\n" +
+		fmt.Sprintf("  %d  A pre-install check failed.", exitCodePreflight) + "\n" +
+		fmt.Sprintf("  %d  The installation was aborted at the confirmation prompt.", exitCodeAborted) + "\n" +
+		fmt.Sprintf("  %d  Helm failed to install the chart.", exitCodeHelm) + "\n"
 	return s + "\n" + c.help
 }
 
@@ -361,37 +1178,206 @@ func (c *Command) Synopsis() string {
 	return "Install Consul on Kubernetes."
 }
 
-// checkForPreviousPVCs checks for existing PVCs with a name containing "consul-server" and returns an error and lists
-// the PVCs it finds matches.
-func (c *Command) checkForPreviousPVCs() error {
+// ResourceNames are the names of the Kubernetes resources the chart creates for a release.
+type ResourceNames struct {
+	Fullname                string
+	ServerStatefulSet       string
+	ServerService           string
+	ClientDaemonSet         string
+	ServerACLInitJob        string
+	BootstrapACLTokenSecret string
+	ConnectInjectDeployment string
+	DNSService              string
+}
+
+// consulResourceNames returns the names of the resources the chart creates for the release. They are all prefixed
+// with the chart's fullname which, since the CLI sets global.name to the release name (see globalNameConsul), is the
+// release name truncated to 63 characters.
+func consulResourceNames(releaseName string) ResourceNames {
+	fullname := releaseName
+	if len(fullname) > 63 {
+		fullname = fullname[:63]
+	}
+	fullname = strings.TrimSuffix(fullname, "-")
+	return ResourceNames{
+		Fullname:                fullname,
+		ServerStatefulSet:       fullname + "-server",
+		ServerService:           fullname + "-server",
+		ClientDaemonSet:         fullname,
+		ServerACLInitJob:        fullname + "-server-acl-init",
+		BootstrapACLTokenSecret: fullname + "-bootstrap-acl-token",
+		ConnectInjectDeployment: fullname + "-connect-injector-webhook-deployment",
+		DNSService:              fullname + "-dns",
+	}
+}
+
+// preInstallChecks checks that there are no leftovers from a previous installation: an existing installation, PVCs
+// and bootstrap secrets. With -skip-pre-install-checks, it only outputs a warning.
+func (c *Command) preInstallChecks(settings *helmCLI.EnvSettings, uiLogger action.DebugLog) error {
+	if c.flagSkipPreInstallChecks {
+		c.UI.Output("Skipping pre-install checks: leftovers from previous installations may conflict with this "+
+			"installation or cause data loss.", terminal.WithWarningStyle())
+		return nil
+	}
+
+	checkForInstallations := c.checkForInstallations
+	if checkForInstallations == nil {
+		checkForInstallations = common.CheckForInstallations
+	}
+	// Note the logic here, common's CheckForInstallations function returns an error if
+	// the release is not found, which in the install command is what we need for a successful install.
+	var uninstalledNamespace string
+	if name, ns, err := checkForInstallations(settings, uiLogger); err == nil {
+		if !c.flagForceReinstall {
+			return fmt.Errorf("existing Consul installation found (name=%s, namespace=%s) - run "+
+				"consul-k8s uninstall if you wish to re-install", name, ns)
+		}
+		if err := c.forceUninstall(name, ns); err != nil {
+			return err
+		}
+		// A dry run doesn't uninstall the existing installation, so the PVCs and secrets in its namespace, which the
+		// uninstall deletes, are ignored.
+		if c.flagDryRun {
+			uninstalledNamespace = ns
+		}
+	} else {
+		c.UI.Output("No existing installations found.")
+	}
+
+	// Ensure there's no previous PVCs lying around.
+	if err := c.checkForPreviousPVCs(uninstalledNamespace); err != nil {
+		return err
+	}
+
+	// Ensure there's no previous bootstrap secret lying around.
+	return c.checkForPreviousSecrets(uninstalledNamespace)
+}
+
+// forceUninstall uninstalls the existing installation and deletes its data for -force-reinstall, after the user
+// confirms by typing the installation's name unless -auto-approve is set. Dry runs only report the uninstall.
+func (c *Command) forceUninstall(name, namespace string) error {
+	c.UI.Output("Existing Consul installation found (name=%s, namespace=%s), it will be uninstalled and all of its "+
+		"data, including PVCs and secrets, deleted.", name, namespace, terminal.WithWarningStyle())
+	if c.flagDryRun {
+		return nil
+	}
+	if !c.flagAutoApprove {
+		confirmation, err := c.UI.Input(&terminal.Input{
+			Prompt: fmt.Sprintf("Type the installation name %q to confirm the uninstall:", name),
+			Style:  terminal.WarningStyle,
+			Secret: false,
+		})
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(confirmation) != name {
+			return errors.New("reinstall aborted, the existing installation was not uninstalled")
+		}
+	}
+
+	uninstall := c.uninstall
+	if uninstall == nil {
+		uninstall = c.runUninstall
+	}
+	if err := uninstall(name, namespace); err != nil {
+		return err
+	}
+	c.UI.Output("Existing Consul installation uninstalled.", terminal.WithSuccessStyle())
+	return nil
+}
+
+// runUninstall runs the uninstall command to uninstall the installation and delete all of its data.
+func (c *Command) runUninstall(name, namespace string) error {
+	args := []string{
+		"-auto-approve", "-wipe-data",
+		"-name", name,
+		"-namespace", namespace,
+		"-timeout", c.flagTimeout,
+	}
+	if c.flagKubeConfig != "" {
+		args = append(args, "-kubeconfig", c.flagKubeConfig)
+	}
+	if c.flagKubeContext != "" {
+		args = append(args, "-context", c.flagKubeContext)
+	}
+	// The uninstall command gets its own BaseCommand so that it doesn't replace the UI of the install, which it outputs
+	// to, e.g. stderr with -output=json.
+	uninstallCmd := &uninstall.Command{BaseCommand: &common.BaseCommand{Ctx: c.Ctx, Log: c.Log, UI: c.UI}}
+	if code := uninstallCmd.Run(args); code != 0 {
+		return fmt.Errorf("unable to uninstall the existing Consul installation (name=%s, namespace=%s)", name, namespace)
+	}
+	return nil
+}
+
+// checkForPreviousPVCs checks for existing PVCs with a name containing the server stateful set's name and returns an
+// error and lists the PVCs it finds matches. If -reuse-pvcs is set, the PVCs found are only listed in a warning. PVCs
+// in ignoreNamespace, if set, are ignored.
+func (c *Command) checkForPreviousPVCs(ignoreNamespace string) error {
 	pvcs, err := c.kubernetes.CoreV1().PersistentVolumeClaims("").List(c.Ctx, metav1.ListOptions{})
 	if err != nil {
 		return fmt.Errorf("error listing PVCs: %s", err)
 	}
+	names := consulResourceNames(common.DefaultReleaseName)
 	var previousPVCs []string
 	for _, pvc := range pvcs.Items {
-		if strings.Contains(pvc.Name, "consul-server") {
+		if ignoreNamespace != "" && pvc.Namespace == ignoreNamespace {
+			continue
+		}
+		if strings.Contains(pvc.Name, names.ServerStatefulSet) {
 			previousPVCs = append(previousPVCs, fmt.Sprintf("%s/%s", pvc.Namespace, pvc.Name))
 		}
 	}
 
 	if len(previousPVCs) > 0 {
-		return fmt.Errorf("found PVCs from previous installations (%s), delete before re-installing",
-			strings.Join(previousPVCs, ","))
+		if c.flagReusePVCs {
+			c.UI.Output("Reusing PVCs from previous installations (%s). The new Consul servers must be able to read "+
+				"the data written by the previous version of Consul", strings.Join(previousPVCs, ","), terminal.WithWarningStyle())
+			return nil
+		}
+		return fmt.Errorf("found PVCs from previous installations (%s), delete before re-installing or set -%s to reuse them",
+			strings.Join(previousPVCs, ","), flagNameReusePVCs)
 	}
 	c.UI.Output("No previous persistent volume claims found", terminal.WithSuccessStyle())
 	return nil
 }
 
-// checkForPreviousSecrets checks for the bootstrap token and returns an error if found.
-func (c *Command) checkForPreviousSecrets() error {
+// checkKubernetesVersion returns an error if the version of the Kubernetes cluster does not satisfy the chart's
+// kubeVersion requirement, which Helm would otherwise only report once installing.
+func (c *Command) checkKubernetesVersion(chrt *chart.Chart) error {
+	required := chrt.Metadata.KubeVersion
+	if required == "" {
+		return nil
+	}
+	version, err := c.kubernetes.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("error reading the Kubernetes version: %s", err)
+	}
+	if !chartutil.IsCompatibleRange(required, version.GitVersion) {
+		return fmt.Errorf("Kubernetes %s is not supported, the Consul chart requires Kubernetes %s",
+			version.GitVersion, required)
+	}
+	c.UI.Output("Kubernetes %s is supported", version.GitVersion, terminal.WithSuccessStyle())
+	return nil
+}
+
+// checkForPreviousSecrets checks for the bootstrap token and returns an error if found. A secret is the bootstrap
+// token if its name contains one of the -bootstrap-secret-pattern values, or the chart's name for it by default.
+// Secrets in ignoreNamespace, if set, are ignored.
+func (c *Command) checkForPreviousSecrets(ignoreNamespace string) error {
 	secrets, err := c.kubernetes.CoreV1().Secrets("").List(c.Ctx, metav1.ListOptions{})
 	if err != nil {
 		return fmt.Errorf("error listing secrets: %s", err)
 	}
+	patterns := c.flagBootstrapSecretPatterns
+	if len(patterns) == 0 {
+		patterns = []string{consulResourceNames(common.DefaultReleaseName).BootstrapACLTokenSecret}
+	}
 	for _, secret := range secrets.Items {
+		if ignoreNamespace != "" && secret.Namespace == ignoreNamespace {
+			continue
+		}
 		// future TODO: also check for federation secret
-		if strings.Contains(secret.Name, "consul-bootstrap-acl-token") {
+		if matchesAny(secret.Name, patterns) {
 			return fmt.Errorf("found consul-acl-bootstrap-token secret from previous installations: %q in namespace %q. To delete, run kubectl delete secret %s --namespace %s",
 				secret.Name, secret.Namespace, secret.Name, secret.Namespace)
 		}
@@ -400,89 +1386,1693 @@ func (c *Command) checkForPreviousSecrets() error {
 	return nil
 }
 
-// mergeValuesFlagsWithPrecedence is responsible for merging all the values to determine the values file for the
-// installation based on the following precedence order from lowest to highest:
-// 1. -preset
-// 2. -f values-file
-// 3. -set
-// 4. -set-string
-// 5. -set-file
-// For example, -set-file will override a value provided via -set.
-// Within each of these groups the rightmost flag value has the highest precedence.
-func (c *Command) mergeValuesFlagsWithPrecedence(settings *helmCLI.EnvSettings) (map[string]interface{}, error) {
-	p := getter.All(settings)
-	v := &values.Options{
-		ValueFiles:   c.flagValueFiles,
-		StringValues: c.flagSetStringValues,
-		Values:       c.flagSetValues,
-		FileValues:   c.flagFileValues,
-	}
-	vals, err := v.MergeValues(p)
-	if err != nil {
-		return nil, fmt.Errorf("error merging values: %s", err)
-	}
-	if c.flagPreset != defaultPreset {
-		// Note the ordering of the function call, presets have lower precedence than set vals.
-		presetMap := presets[c.flagPreset].(map[string]interface{})
-		vals = mergeMaps(presetMap, vals)
+// matchesAny returns whether name contains any of patterns.
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(name, pattern) {
+			return true
+		}
 	}
-	return vals, err
+	return false
 }
 
-// mergeMaps is a helper function used in Run. Merges two maps giving b precedent.
-// @source: https://github.com/helm/helm/blob/main/pkg/cli/values/options.go
-func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
-	out := make(map[string]interface{}, len(a))
-	for k, v := range a {
-		out[k] = v
-	}
-	for k, v := range b {
-		if v, ok := v.(map[string]interface{}); ok {
-			if bv, ok := out[k]; ok {
-				if bv, ok := bv.(map[string]interface{}); ok {
-					out[k] = mergeMaps(bv, v)
+// watchEvents polls the warning events in namespace until ctx is cancelled and calls report once for each new event
+// with a notable reason on an object of the release. Events that happened before watchEvents was called are ignored.
+func (c *Command) watchEvents(ctx context.Context, namespace string, interval time.Duration, report func(v1.Event)) {
+	start := time.Now().Truncate(time.Second)
+	seen := make(map[string]int32)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		events, err := c.kubernetes.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: "type=" + v1.EventTypeWarning,
+		})
+		if err != nil {
+			c.Log.Debug("error listing events", "namespace", namespace, "err", err)
+		} else {
+			sort.Slice(events.Items, func(i, j int) bool {
+				return eventTime(events.Items[i]).Before(eventTime(events.Items[j]))
+			})
+			for _, event := range events.Items {
+				if event.Type != v1.EventTypeWarning || !notableEventReasons[event.Reason] ||
+					!strings.HasPrefix(event.InvolvedObject.Name, common.DefaultReleaseName+"-") ||
+					eventTime(event).Before(start) {
 					continue
 				}
+				// Repeated events are aggregated by Kubernetes into a single event with an increasing count.
+				if count, ok := seen[string(event.UID)]; ok && count >= event.Count {
+					continue
+				}
+				seen[string(event.UID)] = event.Count
+				report(event)
 			}
 		}
-		out[k] = v
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-	return out
 }
 
-// validateFlags is a helper function that performs sanity checks on the user's provided flags.
-func (c *Command) validateFlags(args []string) error {
-	if err := c.set.Parse(args); err != nil {
-		return err
+// eventTime returns the last time the event occurred.
+func eventTime(event v1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
 	}
-	if len(c.set.Args()) > 0 {
-		return errors.New("should have no non-flag arguments")
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
 	}
-	if len(c.flagValueFiles) != 0 && c.flagPreset != defaultPreset {
-		return fmt.Errorf("Cannot set both -%s and -%s", flagNameConfigFile, flagNamePreset)
+	return event.FirstTimestamp.Time
+}
+
+// loadChart reads the embedded chart files and creates a *chart.Chart object to run the installation from.
+func loadChart() (*chart.Chart, error) {
+	// Read the embedded chart files into []*loader.BufferedFile.
+	chartFiles, err := common.ReadChartFiles(consulChart.ConsulHelmChart, common.TopLevelChartDirName)
+	if err != nil {
+		return nil, err
 	}
-	if _, ok := presets[c.flagPreset]; c.flagPreset != defaultPreset && !ok {
-		return fmt.Errorf("'%s' is not a valid preset", c.flagPreset)
+	return loader.LoadFiles(chartFiles)
+}
+
+// LocateChart returns the chart to install or upgrade to: the chart embedded in the CLI, or the chart version set by
+// -version downloaded from the Helm repository set by -helm-repo-url, trusting the -ca-file CA. With -verify, the
+// signature of the chart's provenance file is checked against -keyring. The chart is downloaded with Helm's chart
+// downloader rather than action.ChartPathOptions, which replaces the reason a download or verification failed with
+// a generic error and fetches the provenance file without the CA.
+func (c *Command) LocateChart(settings *helmCLI.EnvSettings) (*chart.Chart, error) {
+	if c.flagChartVersion == "" {
+		return loadChart()
 	}
-	if !validLabel(c.flagNamespace) {
-		return fmt.Errorf("'%s' is an invalid namespace. Namespaces follow the RFC 1123 label convention and must "+
-			"consist of a lower case alphanumeric character or '-' and must start/end with an alphanumeric", c.flagNamespace)
+	downloadErr := func(err error) error {
+		return fmt.Errorf("error downloading version %q of the Consul Helm chart from %s: %s", c.flagChartVersion,
+			c.flagHelmRepoURL, err)
 	}
-	duration, err := time.ParseDuration(c.flagTimeout)
+	providers := c.getterProviders(settings)
+	chartURL, err := repo.FindChartInAuthAndTLSAndPassRepoURL(c.flagHelmRepoURL, "", "", common.DefaultReleaseName,
+		c.flagChartVersion, "", "", c.flagCAFile, false, false, providers)
 	if err != nil {
-		return fmt.Errorf("unable to parse -%s: %s", flagNameTimeout, err)
+		return nil, downloadErr(err)
 	}
-	c.timeoutDuration = duration
-	if len(c.flagValueFiles) != 0 {
-		for _, filename := range c.flagValueFiles {
-			if _, err := os.Stat(filename); err != nil && os.IsNotExist(err) {
-				return fmt.Errorf("File '%s' does not exist.", filename)
+	dl := downloader.ChartDownloader{
+		Out:              ioutil.Discard,
+		Keyring:          c.flagKeyring,
+		Getters:          providers,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	if c.flagVerify {
+		dl.Verify = downloader.VerifyAlways
+	}
+	if err := os.MkdirAll(settings.RepositoryCache, 0755); err != nil {
+		return nil, downloadErr(err)
+	}
+	path, _, err := dl.DownloadTo(chartURL, c.flagChartVersion, settings.RepositoryCache)
+	if err != nil {
+		return nil, downloadErr(err)
+	}
+	chrt, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading version %q of the Consul Helm chart: %s", c.flagChartVersion, err)
+	}
+	if c.flagVerify {
+		c.UI.Output("Downloaded Consul Helm chart version %s and verified its provenance", chrt.Metadata.Version,
+			terminal.WithSuccessStyle())
+	} else {
+		c.UI.Output("Downloaded Consul Helm chart version %s", chrt.Metadata.Version, terminal.WithSuccessStyle())
+	}
+	return chrt, nil
+}
+
+// readValuesSchema reads the JSON schema in filename and returns an error if it is not a valid JSON schema.
+func readValuesSchema(filename string) ([]byte, error) {
+	schema, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("File '%s' does not exist.", filename)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading -%s: %s", flagNameValuesSchema, err)
+	}
+	if _, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema)); err != nil {
+		return nil, fmt.Errorf("-%s: %s is not a valid JSON schema: %s", flagNameValuesSchema, filename, err)
+	}
+	return schema, nil
+}
+
+// validateValues validates vals, merged with the chart's default values, against the schema set by -values-schema.
+// The schema replaces the chart's, so Helm validates against it too when installing chrt.
+func (c *Command) validateValues(chrt *chart.Chart, vals map[string]interface{}) error {
+	if c.valuesSchema == nil {
+		return nil
+	}
+	chrt.Schema = c.valuesSchema
+	if err := chartutil.ValidateAgainstSingleSchema(common.MergeMaps(chrt.Values, vals), chrt.Schema); err != nil {
+		return fmt.Errorf("values don't match the schema of -%s: %s", flagNameValuesSchema, err)
+	}
+	return nil
+}
+
+// newInstallAction returns the Helm install action for the release, configured from the flags. With -wait-for-jobs,
+// the Kubernetes client of actionConfig is replaced to wait for the hooks and jobs with -hook-timeout.
+func (c *Command) newInstallAction(actionConfig *action.Configuration) *action.Install {
+	if c.flagWaitForJobs {
+		actionConfig.KubeClient = &hookTimeoutClient{Interface: actionConfig.KubeClient, hookTimeout: c.hookTimeoutDuration}
+	}
+	install := action.NewInstall(actionConfig)
+	install.ReleaseName = common.DefaultReleaseName
+	install.Namespace = c.flagNamespace
+	install.CreateNamespace = true
+	install.Wait = c.flagWait
+	install.WaitForJobs = c.flagWaitForJobs
+	install.Timeout = c.timeoutDuration
+	install.Description = c.flagReleaseDescription
+	return install
+}
+
+// waitForServers waits until the number of Consul servers the installation expects have joined the Raft cluster.
+func (c *Command) waitForServers(chrt *chart.Chart, vals map[string]interface{}) error {
+	expected, scheme, err := expectedServers(chrt, vals)
+	if err != nil {
+		return err
+	}
+	if expected == 0 {
+		c.UI.Output("No Consul servers were installed, not waiting for them", terminal.WithInfoStyle())
+		return nil
+	}
+	c.UI.Output("Waiting for %d Consul server(s) to join the Raft cluster", expected, terminal.WithInfoStyle())
+	ctx, cancel := context.WithTimeout(c.Ctx, c.timeoutDuration)
+	defer cancel()
+	if err := c.pollRaftPeers(ctx, c.flagNamespace, scheme, expected, raftPollInterval); err != nil {
+		return err
+	}
+	c.UI.Output("%d Consul server(s) joined the Raft cluster", expected, terminal.WithSuccessStyle())
+	return nil
+}
+
+// raftPollInterval is how often the Raft peers are polled while waiting for the Consul servers.
+const raftPollInterval = 2 * time.Second
+
+// pollRaftPeers polls the Raft peers of the Consul servers in namespace every interval until there are at least
+// expected peers or ctx is done. The servers' HTTP API is reached through the Kubernetes API server's service proxy,
+// with scheme http or https, so errors reaching it are retried until ctx is done.
+func (c *Command) pollRaftPeers(ctx context.Context, namespace, scheme string, expected int, interval time.Duration) error {
+	port := "8500"
+	if scheme == "https" {
+		port = "8501"
+	}
+	service := consulResourceNames(common.DefaultReleaseName).ServerService
+	for {
+		var reason string
+		body, err := c.kubernetes.CoreV1().Services(namespace).ProxyGet(scheme, service, port, "/v1/status/peers", nil).DoRaw(ctx)
+		if err != nil {
+			reason = fmt.Sprintf("error reaching the Consul servers: %s", err)
+		} else {
+			var peers []string
+			if err := json.Unmarshal(body, &peers); err != nil {
+				reason = fmt.Sprintf("error parsing the Raft peers: %s", err)
+			} else if len(peers) >= expected {
+				return nil
+			} else {
+				reason = fmt.Sprintf("%d of %d servers have joined", len(peers), expected)
 			}
 		}
+		c.Log.Debug("waiting for Consul servers", "reason", reason)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %d Consul server(s) to join the Raft cluster: %s", expected, reason)
+		case <-time.After(interval):
+		}
 	}
+}
 
-	if c.flagDryRun {
-		c.UI.Output("Performing dry run installation.", terminal.WithInfoStyle())
+// hookTimeoutClient waits for the chart's hooks and jobs with hookTimeout rather than the timeout of the install, so
+// -hook-timeout bounds them separately from the other resources of the installation, which are waited for with
+// -timeout.
+type hookTimeoutClient struct {
+	kube.Interface
+	hookTimeout time.Duration
+}
+
+// WatchUntilReady is only called by Helm to wait for the resources of hooks.
+func (k *hookTimeoutClient) WatchUntilReady(resources kube.ResourceList, _ time.Duration) error {
+	if err := k.Interface.WatchUntilReady(resources, k.hookTimeout); err != nil {
+		return fmt.Errorf("error waiting for hook with -%s %s: %s", flagNameHookTimeout, k.hookTimeout, err)
+	}
+	return nil
+}
+
+func (k *hookTimeoutClient) WaitWithJobs(resources kube.ResourceList, timeout time.Duration) error {
+	var jobs, others kube.ResourceList
+	for _, r := range resources {
+		if r.Object != nil && r.Object.GetObjectKind().GroupVersionKind().Kind == "Job" {
+			jobs = append(jobs, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	if err := k.Interface.Wait(others, timeout); err != nil {
+		return err
+	}
+	if err := k.Interface.WaitWithJobs(jobs, k.hookTimeout); err != nil {
+		return fmt.Errorf("error waiting for jobs with -%s %s: %s", flagNameHookTimeout, k.hookTimeout, err)
+	}
+	return nil
+}
+
+// expectedServers returns the number of Consul servers the values install, server.bootstrapExpect or else
+// server.replicas, taking the chart's default values into account, and the scheme their HTTP API is served on.
+// It returns 0 if the values do not install servers.
+func expectedServers(chrt *chart.Chart, vals map[string]interface{}) (int, string, error) {
+	effective := common.MergeMaps(chrt.Values, vals)
+	global, _ := effective["global"].(map[string]interface{})
+	server, _ := effective["server"].(map[string]interface{})
+	if !enabled(server["enabled"], global["enabled"]) {
+		return 0, "", nil
+	}
+
+	expected, ok := toInt(server["bootstrapExpect"])
+	if !ok {
+		if expected, ok = toInt(server["replicas"]); !ok {
+			return 0, "", fmt.Errorf("server.replicas must be a number, got %v", server["replicas"])
+		}
+	}
+
+	scheme := "http"
+	if tls, _ := global["tls"].(map[string]interface{}); tls["enabled"] == true && tls["httpsOnly"] != false {
+		scheme = "https"
+	}
+	return int(expected), scheme, nil
+}
+
+// enabled returns whether a component with the chart's enabled value is enabled, where "-" defaults to the value of
+// global.enabled.
+func enabled(value, globalEnabled interface{}) bool {
+	if value == "-" {
+		return globalEnabled != false
+	}
+	return value == true
+}
+
+// metricsValues returns the chart values that expose Prometheus metrics of the Consul agents, gateways and
+// connect-injected pods. If port is not 0, connect-injected pods are scraped on port.
+func metricsValues(port int) map[string]interface{} {
+	connectInjectMetrics := map[string]interface{}{
+		"defaultEnabled": true,
+	}
+	if port != 0 {
+		connectInjectMetrics["defaultPrometheusScrapePort"] = port
+	}
+	return map[string]interface{}{
+		"global": map[string]interface{}{
+			"metrics": map[string]interface{}{
+				"enabled":            true,
+				"enableAgentMetrics": true,
+			},
+		},
+		"connectInject": map[string]interface{}{
+			"metrics": connectInjectMetrics,
+		},
+	}
+}
+
+// checkAgentMetrics returns an error if the values enable the metrics of the Consul agents together with HTTPS only
+// TLS, taking the chart's default values into account. The agents serve their metrics on the HTTP port, so the chart
+// fails to render.
+func checkAgentMetrics(chrt *chart.Chart, vals map[string]interface{}) error {
+	global, _ := common.MergeMaps(chrt.Values, vals)["global"].(map[string]interface{})
+	metrics, _ := global["metrics"].(map[string]interface{})
+	tls, _ := global["tls"].(map[string]interface{})
+	if metrics["enabled"] == true && metrics["enableAgentMetrics"] == true &&
+		tls["enabled"] == true && tls["httpsOnly"] == true {
+		return errors.New("the metrics of the Consul agents cannot be enabled with HTTPS only TLS; set " +
+			"global.tls.httpsOnly to false or disable global.metrics.enableAgentMetrics")
+	}
+	return nil
+}
+
+// outputDNS outputs the cluster IP of the Consul DNS service in namespace and the CoreDNS stub domain configuration
+// that forwards DNS queries for the consul domain to it.
+func (c *Command) outputDNS(namespace string) error {
+	name := consulResourceNames(common.DefaultReleaseName).DNSService
+	svc, err := c.kubernetes.CoreV1().Services(namespace).Get(c.Ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error reading the Consul DNS service %q: %s", name, err)
+	}
+	ip := svc.Spec.ClusterIP
+	if ip == "" || ip == v1.ClusterIPNone {
+		return fmt.Errorf("the Consul DNS service %q has no cluster IP", name)
+	}
+	c.UI.Output("Consul DNS", terminal.WithHeaderStyle())
+	c.UI.Output("Consul DNS service %q has cluster IP %s. To resolve .consul names, add this server block to the "+
+		"Corefile in the coredns ConfigMap in the kube-system namespace:", name, ip, terminal.WithInfoStyle())
+	c.UI.Output(coreDNSStubDomain(ip), terminal.WithInfoStyle())
+	return nil
+}
+
+// aclsManaged returns whether the chart manages the ACLs of the installation, i.e. whether global.acls.manageSystemACLs
+// is set, taking the chart's default values into account.
+func aclsManaged(chrt *chart.Chart, vals map[string]interface{}) bool {
+	global, _ := common.MergeMaps(chrt.Values, vals)["global"].(map[string]interface{})
+	acls, _ := global["acls"].(map[string]interface{})
+	return acls["manageSystemACLs"] == true
+}
+
+// outputACLTokens outputs the secrets in namespace that hold the ACL tokens created by the server-acl-init job, the
+// bootstrap token first, and how to read them. The job may still be running, in which case the secrets are created
+// once it completes.
+func (c *Command) outputACLTokens(namespace string) error {
+	names := consulResourceNames(common.DefaultReleaseName)
+	secrets, err := c.kubernetes.CoreV1().Secrets(namespace).List(c.Ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing the ACL token secrets: %s", err)
+	}
+	var tokens []string
+	for _, secret := range secrets.Items {
+		name := secret.Name
+		if name == names.BootstrapACLTokenSecret || !strings.HasPrefix(name, names.Fullname+"-") ||
+			!strings.HasSuffix(name, "-acl-token") {
+			continue
+		}
+		tokens = append(tokens, name)
+	}
+	sort.Strings(tokens)
+	for _, secret := range secrets.Items {
+		if secret.Name == names.BootstrapACLTokenSecret {
+			tokens = append([]string{secret.Name}, tokens...)
+		}
+	}
+
+	c.UI.Output("ACL Tokens", terminal.WithHeaderStyle())
+	if len(tokens) == 0 {
+		c.UI.Output("The ACL tokens will be stored in secrets named %s-<component>-acl-token in namespace %q once "+
+			"the %s job completes.", names.Fullname, namespace, names.ServerACLInitJob, terminal.WithInfoStyle())
+		return nil
+	}
+	c.UI.Output("The ACL tokens are stored in these secrets in namespace %q:", namespace, terminal.WithInfoStyle())
+	for _, name := range tokens {
+		c.UI.Output("%s", name, terminal.WithInfoStyle())
+	}
+	c.UI.Output("To read a token, run: kubectl get secret <name> --namespace %s --output jsonpath='{.data.token}' "+
+		"| base64 --decode", namespace, terminal.WithInfoStyle())
+	if tokens[0] == names.BootstrapACLTokenSecret {
+		c.UI.Output("The bootstrap token can also be printed with: consul-k8s acl bootstrap-token --namespace %s",
+			namespace, terminal.WithInfoStyle())
+	}
+	return nil
+}
+
+// coreDNSStubDomain returns the CoreDNS server block that forwards the consul domain to the Consul DNS service at ip.
+func coreDNSStubDomain(ip string) string {
+	return fmt.Sprintf(`consul {
+  errors
+  cache 30
+  forward . %s
+}`, ip)
+}
+
+// outputNotes outputs the notes the chart rendered for rel, unless -no-notes is set or there are none.
+func (c *Command) outputNotes(rel *release.Release) {
+	if c.flagNoNotes || rel == nil || rel.Info == nil {
+		return
+	}
+	notes := strings.TrimSpace(rel.Info.Notes)
+	if notes == "" {
+		return
+	}
+	c.UI.Output("Notes", terminal.WithHeaderStyle())
+	c.UI.Output("%s", notes, terminal.WithInfoStyle())
+}
+
+// statusDryRun is the status of the installResult of a dry run, which has no release.
+const statusDryRun = "dry-run"
+
+// installResult is the document output by -output=json.
+type installResult struct {
+	Name         string                 `json:"name"`
+	Namespace    string                 `json:"namespace"`
+	ChartVersion string                 `json:"chartVersion"`
+	Values       map[string]interface{} `json:"values"`
+	Status       string                 `json:"status"`
+	Manifest     string                 `json:"manifest,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// outputResult outputs result as JSON to stdout and returns exitCode, or exitCodeError if it can't be output.
+func (c *Command) outputResult(result installResult, exitCode int) int {
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		c.UI.Output("error formatting the result: %s", err, terminal.WithErrorStyle())
+		return exitCodeError
+	}
+	stdout, _, err := c.UI.OutputWriters()
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return exitCodeError
+	}
+	c.UI.Output("%s", out, terminal.WithWriter(stdout))
+	return exitCode
+}
+
+// stderrUI outputs messages to stderr unless another writer is given, so -output=json can use stdout for the document.
+type stderrUI struct {
+	terminal.UI
+}
+
+func (u *stderrUI) Output(msg string, raw ...interface{}) {
+	_, stderr, err := u.UI.OutputWriters()
+	if err != nil || stderr == nil {
+		stderr = os.Stderr
+	}
+	u.UI.Output(msg, append([]interface{}{terminal.WithWriter(stderr)}, raw...)...)
+}
+
+// renderManifest renders chrt with vals without contacting the cluster, like helm install --dry-run, and returns the
+// manifests of the chart's hooks followed by the manifest of the release.
+func (c *Command) renderManifest(chrt *chart.Chart, vals map[string]interface{}, logger action.DebugLog) (string, error) {
+	install := action.NewInstall(&action.Configuration{Log: logger})
+	install.ReleaseName = common.DefaultReleaseName
+	install.Namespace = c.flagNamespace
+	install.DryRun = true
+	install.ClientOnly = true
+	rel, err := install.Run(chrt, vals)
+	if err != nil {
+		return "", fmt.Errorf("error rendering chart: %s", err)
+	}
+	var manifest strings.Builder
+	for _, hook := range rel.Hooks {
+		fmt.Fprintf(&manifest, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+	}
+	manifest.WriteString(rel.Manifest)
+	return manifest.String(), nil
+}
+
+// runResourceChecks renders the chart with vals and outputs a warning for each resource check that fails.
+func (c *Command) runResourceChecks(chrt *chart.Chart, vals map[string]interface{}, logger action.DebugLog) error {
+	manifest, err := c.renderManifest(chrt, vals, logger)
+	if err != nil {
+		return err
+	}
+	c.UI.Output("Checking cluster resources", terminal.WithInfoStyle())
+
+	warnings, err := c.checkClusterResources(manifest)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		c.UI.Output(w, terminal.WithWarningStyle())
+	}
+	if len(warnings) == 0 {
+		c.UI.Output("Cluster has sufficient resources", terminal.WithSuccessStyle())
+	}
+	return nil
+}
+
+// checkClusterResources sums the CPU and memory requested by the workloads in manifest and compares them with the
+// allocatable capacity of the cluster's nodes. A warning is returned for each check that fails.
+func (c *Command) checkClusterResources(manifest string) ([]string, error) {
+	nodes, err := c.kubernetes.CoreV1().Nodes().List(c.Ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %s", err)
+	}
+	allocatable := v1.ResourceList{}
+	for _, node := range nodes.Items {
+		addResources(allocatable, node.Status.Allocatable, 1)
+	}
+
+	required := v1.ResourceList{}
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		var w workload
+		if err := yaml.Unmarshal([]byte(doc), &w); err != nil {
+			return nil, fmt.Errorf("error parsing rendered manifest: %s", err)
+		}
+		var count int64
+		switch w.Kind {
+		case "Deployment", "StatefulSet":
+			count = 1
+			if w.Spec.Replicas != nil {
+				count = int64(*w.Spec.Replicas)
+			}
+		case "DaemonSet":
+			count = int64(len(nodes.Items))
+		default:
+			continue
+		}
+		for _, container := range w.Spec.Template.Spec.Containers {
+			addResources(required, container.Resources.Requests, count)
+		}
+	}
+
+	var warnings []string
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		req, ok := required[name]
+		if !ok {
+			continue
+		}
+		alloc := allocatable[name]
+		if req.Cmp(alloc) > 0 {
+			warnings = append(warnings, fmt.Sprintf("installation requests %s %s but the cluster's nodes only have %s allocatable",
+				req.String(), name, alloc.String()))
+		}
+	}
+	return warnings, nil
+}
+
+// workload holds the fields of a rendered Deployment, StatefulSet or DaemonSet needed to sum its requested resources.
+type workload struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Replicas *int32             `json:"replicas"`
+		Template v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+}
+
+// addResources adds count times each quantity in add to total.
+func addResources(total, add v1.ResourceList, count int64) {
+	for name, quantity := range add {
+		sum := total[name]
+		for i := int64(0); i < count; i++ {
+			sum.Add(quantity)
+		}
+		total[name] = sum
+	}
+}
+
+// MergeValuesFlagsWithPrecedence is responsible for merging all the values to determine the values file for the
+// installation based on the following precedence order from lowest to highest:
+// 1. -base-values
+// 2. -preset
+// 3. the values set by the other flags, such as -ca-file, see flagValues
+// 4. -f values-file
+// 5. -set
+// 6. -set-string
+// 7. -set-file
+// 8. -set-literal
+// For example, -set-file will override a value provided via -set.
+// Within each of these groups the rightmost flag value has the highest precedence.
+func (c *Command) MergeValuesFlagsWithPrecedence(settings *helmCLI.EnvSettings) (map[string]interface{}, error) {
+	p := c.getterProviders(settings)
+	v := &values.Options{
+		ValueFiles:   c.flagValueFiles,
+		StringValues: c.flagSetStringValues,
+		Values:       c.flagSetValues,
+		FileValues:   c.flagFileValues,
+	}
+	vals, err := v.MergeValues(p)
+	if err != nil {
+		return nil, fmt.Errorf("error merging values: %s", err)
+	}
+	literalVals, err := literalValues(c.flagLiteralValues)
+	if err != nil {
+		return nil, err
+	}
+	vals = common.MergeMaps(vals, literalVals)
+	flagVals, err := c.flagValues()
+	if err != nil {
+		return nil, err
+	}
+	// Note the ordering of the function calls, the values of lower precedence are merged below vals.
+	vals = common.MergeMaps(flagVals, vals)
+	if c.flagPreset != defaultPreset {
+		presetMap := presets[c.flagPreset].(map[string]interface{})
+		vals = common.MergeMaps(presetMap, vals)
+	}
+	if c.flagBaseValues != "" {
+		baseVals, err := (&values.Options{ValueFiles: []string{c.flagBaseValues}}).MergeValues(p)
+		if err != nil {
+			return nil, fmt.Errorf("error reading -%s: %s", flagNameBaseValues, err)
+		}
+		vals = common.MergeMaps(baseVals, vals)
+	}
+	if c.flagEnableNamespaceMirroring {
+		if connectInject, ok := vals["connectInject"].(map[string]interface{}); !ok || connectInject["enabled"] != true {
+			c.UI.Output("-%s has no effect unless connect-inject is enabled with connectInject.enabled=true",
+				flagNameEnableNamespaceMirroring, terminal.WithWarningStyle())
+		}
+	}
+	return vals, nil
+}
+
+// flagValues returns the chart values set by the flags that are shortcuts for them, such as -ca-file or
+// -enable-metrics. No two of these flags set the same value, so the order they are merged in doesn't matter.
+func (c *Command) flagValues() (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	if c.flagCAFile != "" {
+		caCert, err := ioutil.ReadFile(c.flagCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading -%s: %s", flagNameCAFile, err)
+		}
+		vals = common.MergeMaps(vals, caCertValues(string(caCert)))
+	}
+	if c.flagClientOnly {
+		vals = common.MergeMaps(vals, clientOnlyValues(c.flagExternalServers))
+	}
+	for _, a := range []struct {
+		annotations map[string]string
+		path        []string
+	}{
+		{c.flagServerAnnotations, []string{"server", "annotations"}},
+		{c.flagClientAnnotations, []string{"client", "annotations"}},
+		{c.flagServerServiceAccountAnnotations, []string{"server", "serviceAccount", "annotations"}},
+		{c.flagClientServiceAccountAnnotations, []string{"client", "serviceAccount", "annotations"}},
+	} {
+		if len(a.annotations) == 0 {
+			continue
+		}
+		annotationValues, err := annotationsValue(a.annotations)
+		if err != nil {
+			return nil, err
+		}
+		var annotationVals interface{} = annotationValues
+		for i := len(a.path) - 1; i >= 0; i-- {
+			annotationVals = map[string]interface{}{a.path[i]: annotationVals}
+		}
+		vals = common.MergeMaps(vals, annotationVals.(map[string]interface{}))
+	}
+	if len(c.flagClientEnv) != 0 {
+		env := make(map[string]interface{}, len(c.flagClientEnv))
+		for k, v := range c.flagClientEnv {
+			env[k] = v
+		}
+		vals = common.MergeMaps(vals, map[string]interface{}{
+			"client": map[string]interface{}{
+				"extraEnvironmentVars": env,
+			},
+		})
+	}
+	if c.flagServerPriorityClass != "" {
+		vals = common.MergeMaps(vals, map[string]interface{}{
+			"server": map[string]interface{}{
+				"priorityClassName": c.flagServerPriorityClass,
+			},
+		})
+	}
+	if pullSecrets := c.imagePullSecrets(); len(pullSecrets) != 0 {
+		secretRefs := make([]interface{}, 0, len(pullSecrets))
+		for _, name := range pullSecrets {
+			secretRefs = append(secretRefs, map[string]interface{}{"name": name})
+		}
+		vals = common.MergeMaps(vals, map[string]interface{}{
+			"global": map[string]interface{}{
+				"imagePullSecrets": secretRefs,
+			},
+		})
+	}
+	if c.flagEnableMetrics {
+		vals = common.MergeMaps(vals, metricsValues(c.flagMetricsPort))
+	}
+	if c.flagDNSEnabled {
+		dns := map[string]interface{}{
+			"enabled": true,
+			"type":    "ClusterIP",
+		}
+		if c.flagDNSClusterIP != "" {
+			dns["clusterIP"] = c.flagDNSClusterIP
+		}
+		vals = common.MergeMaps(vals, map[string]interface{}{"dns": dns})
+	}
+	if c.flagTopologySpread {
+		vals = common.MergeMaps(vals, topologySpreadValues(c.flagTopologyMaxSkew, c.flagTopologyWhenUnsatisfiable))
+	}
+	for component, flagValue := range map[string]string{"server": c.flagServerResources, "client": c.flagClientResources} {
+		if flagValue == "" {
+			continue
+		}
+		resources, err := parseResources(flagValue)
+		if err != nil {
+			return nil, err
+		}
+		vals = common.MergeMaps(vals, map[string]interface{}{
+			component: map[string]interface{}{
+				"resources": map[string]interface{}{
+					"requests": resources,
+					"limits":   resources,
+				},
+			},
+		})
+	}
+	for _, e := range []struct {
+		flagName  string
+		flagValue string
+		component string
+	}{
+		{flagNameServerExtraConfig, c.flagServerExtraConfig, "server"},
+		{flagNameClientExtraConfig, c.flagClientExtraConfig, "client"},
+	} {
+		if e.flagValue == "" && c.flagConsulLogLevel == "" {
+			continue
+		}
+		extraConfig, err := c.extraConfig(e.flagName, e.flagValue, e.component)
+		if err != nil {
+			return nil, err
+		}
+		vals = common.MergeMaps(vals, map[string]interface{}{
+			e.component: map[string]interface{}{
+				"extraConfig": extraConfig,
+			},
+		})
+	}
+	if c.flagEnableNamespaceMirroring {
+		vals = common.MergeMaps(vals, namespaceMirroringValues(c.flagMirroringPrefix))
+	}
+	return vals, nil
+}
+
+// getterProviders returns the getters used to download values files. If -ca-file is set, every getter is configured
+// to trust the CA bundle.
+func (c *Command) getterProviders(settings *helmCLI.EnvSettings) getter.Providers {
+	providers := getter.All(settings)
+	if c.flagCAFile == "" {
+		return providers
+	}
+	for i := range providers {
+		newGetter := providers[i].New
+		providers[i].New = func(options ...getter.Option) (getter.Getter, error) {
+			return newGetter(append(options, getter.WithTLSClientConfig("", "", c.flagCAFile))...)
+		}
+	}
+	return providers
+}
+
+// checkServerReplicas returns an error if server.bootstrapExpect is set to a different number than server.replicas,
+// taking the chart's default values into account. If bootstrapExpect is greater than replicas the servers never elect
+// a leader, and if it is lower the chart fails to render.
+func checkServerReplicas(chrt *chart.Chart, vals map[string]interface{}) error {
+	server, _ := common.MergeMaps(chrt.Values, vals)["server"].(map[string]interface{})
+	bootstrapExpect, ok := toInt(server["bootstrapExpect"])
+	if !ok {
+		// When bootstrapExpect is not set the chart defaults it to server.replicas.
+		return nil
+	}
+	replicas, ok := toInt(server["replicas"])
+	if !ok {
+		return fmt.Errorf("server.replicas must be a number, got %v", server["replicas"])
+	}
+	if bootstrapExpect != replicas {
+		return fmt.Errorf("server.bootstrapExpect (%d) does not match server.replicas (%d); unset server.bootstrapExpect "+
+			"or set it to the number of replicas", bootstrapExpect, replicas)
+	}
+	return nil
+}
+
+// marshalValues returns vals as YAML with the keys of every map sorted, so that the same values always produce the same
+// output and summaries can be diffed. sigs.k8s.io/yaml guarantees this by converting to JSON first, which sorts keys at
+// every level; the order of lists is kept.
+func marshalValues(vals map[string]interface{}) ([]byte, error) {
+	out, err := yaml.Marshal(vals)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling values: %s", err)
+	}
+	return out, nil
+}
+
+// validDatacenter matches the datacenter names Consul accepts.
+var validDatacenter = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// effectiveDatacenter returns global.datacenter, taking the chart's default values into account. It returns an error
+// if the datacenter is not a valid Consul datacenter name.
+func effectiveDatacenter(chrt *chart.Chart, vals map[string]interface{}) (string, error) {
+	global, _ := common.MergeMaps(chrt.Values, vals)["global"].(map[string]interface{})
+	datacenter, ok := global["datacenter"].(string)
+	if !ok || !validDatacenter.MatchString(datacenter) {
+		return "", fmt.Errorf("global.datacenter %q is invalid: it may only contain alphanumeric characters, "+
+			"underscores and dashes", fmt.Sprint(global["datacenter"]))
+	}
+	return datacenter, nil
+}
+
+// federationRole returns whether datacenter is the primary or a secondary datacenter of a federation, taking the
+// chart's default values into account. It returns "" if federation is not enabled. A datacenter is a secondary if
+// server.extraConfig sets primary_datacenter to another datacenter, which is how secondaries are configured, and the
+// primary otherwise. It returns an error if the values configure the datacenter as both.
+func federationRole(chrt *chart.Chart, vals map[string]interface{}, datacenter string) (string, error) {
+	effective := common.MergeMaps(chrt.Values, vals)
+	global, _ := effective["global"].(map[string]interface{})
+	federation, _ := global["federation"].(map[string]interface{})
+	if enabled, _ := federation["enabled"].(bool); !enabled {
+		return "", nil
+	}
+
+	var primaryDatacenter string
+	server, _ := effective["server"].(map[string]interface{})
+	if extraConfig, ok := server["extraConfig"].(string); ok && extraConfig != "" {
+		var config struct {
+			PrimaryDatacenter string `json:"primary_datacenter"`
+		}
+		if err := json.Unmarshal([]byte(extraConfig), &config); err != nil {
+			return "", fmt.Errorf("server.extraConfig is not valid JSON: %s", err)
+		}
+		primaryDatacenter = config.PrimaryDatacenter
+	}
+	if primaryDatacenter == "" || primaryDatacenter == datacenter {
+		return federationPrimary, nil
+	}
+
+	// Only the primary datacenter creates the federation secret that the secondaries are configured with.
+	if createSecret, _ := federation["createFederationSecret"].(bool); createSecret {
+		return "", fmt.Errorf("global.federation.createFederationSecret is only supported in the primary datacenter, "+
+			"but server.extraConfig sets the primary datacenter to %q instead of %q", primaryDatacenter, datacenter)
+	}
+	return fmt.Sprintf("federation secondary of %s", primaryDatacenter), nil
+}
+
+// federationPrimary is the federation role of a primary datacenter.
+const federationPrimary = "federation primary"
+
+// checkExistingPrimary returns an error if Consul servers installed by the chart already run in any namespace and belong
+// to a primary datacenter other than datacenter, since installing datacenter as a federation primary would then create
+// a second primary. The servers' HTTP API is reached through the Kubernetes API server's service proxy, over HTTPS or
+// HTTP since the TLS settings of the existing servers are unknown, and with the ACL bootstrap token of their
+// installation if its secret exists. Servers that can't be reached are skipped.
+func (c *Command) checkExistingPrimary(ctx context.Context, datacenter string) error {
+	services, err := c.kubernetes.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=consul,component=server",
+	})
+	if err != nil {
+		c.Log.Debug("error listing existing Consul server services", "err", err)
+		return nil
+	}
+	for _, service := range services.Items {
+		primary, ok := c.serversPrimaryDatacenter(ctx, service)
+		if ok && primary != datacenter {
+			return fmt.Errorf("the Consul servers already running in namespace %q belong to primary datacenter %q, so "+
+				"installing %q as a federation primary would create a second primary", service.Namespace, primary,
+				datacenter)
+		}
+	}
+	return nil
+}
+
+// serversPrimaryDatacenter returns the primary datacenter of the Consul servers behind service, and false if they
+// can't be reached.
+func (c *Command) serversPrimaryDatacenter(ctx context.Context, service v1.Service) (string, bool) {
+	// The chart names the server service and the bootstrap token secret after its fullname.
+	secretName := strings.TrimSuffix(service.Name, "-server") + "-bootstrap-acl-token"
+	var token string
+	secret, err := c.kubernetes.CoreV1().Secrets(service.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err == nil {
+		token = string(secret.Data["token"])
+	}
+	proxyClient := c.proxyClient
+	if proxyClient == nil {
+		proxyClient = c.kubernetes.CoreV1().RESTClient()
+	}
+
+	for _, scheme := range []string{"https", "http"} {
+		port := "8500"
+		if scheme == "https" {
+			port = "8501"
+		}
+		req := proxyClient.Get().
+			Namespace(service.Namespace).
+			Resource("services").
+			Name(scheme + ":" + service.Name + ":" + port).
+			SubResource("proxy").
+			Suffix("/v1/agent/self")
+		if token != "" {
+			req = req.SetHeader("X-Consul-Token", token)
+		}
+		body, err := req.DoRaw(ctx)
+		if err != nil {
+			c.Log.Debug("existing Consul servers not reachable", "namespace", service.Namespace, "service",
+				service.Name, "scheme", scheme, "err", err)
+			continue
+		}
+		var self struct {
+			Config struct {
+				Datacenter        string
+				PrimaryDatacenter string
+			}
+		}
+		if err := json.Unmarshal(body, &self); err != nil {
+			c.Log.Debug("error parsing the configuration of existing Consul servers", "namespace", service.Namespace,
+				"err", err)
+			return "", false
+		}
+		if self.Config.PrimaryDatacenter != "" {
+			return self.Config.PrimaryDatacenter, true
+		}
+		return self.Config.Datacenter, true
+	}
+	return "", false
+}
+
+// securityAdvice returns the security features of the secure preset that are disabled in vals, taking the chart's
+// default values into account.
+func securityAdvice(chrt *chart.Chart, vals map[string]interface{}) []string {
+	effective := common.MergeMaps(chrt.Values, vals)
+	enabled := func(path ...string) bool {
+		var v interface{} = effective
+		for _, key := range path {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			v = m[key]
+		}
+		switch value := v.(type) {
+		case bool:
+			return value
+		case string:
+			return value != ""
+		default:
+			return false
+		}
+	}
+
+	var disabled []string
+	if !enabled("global", "acls", "manageSystemACLs") {
+		disabled = append(disabled, "ACLs disabled")
+	}
+	if !enabled("global", "tls", "enabled") {
+		disabled = append(disabled, "TLS disabled")
+	} else if !enabled("global", "tls", "enableAutoEncrypt") {
+		disabled = append(disabled, "TLS auto-encrypt disabled")
+	}
+	// Gossip encryption is enabled by either generating a key or providing one in a secret.
+	if !enabled("global", "gossipEncryption", "autoGenerate") && !enabled("global", "gossipEncryption", "secretName") {
+		disabled = append(disabled, "gossip encryption disabled")
+	}
+	return disabled
+}
+
+// toInt converts a number parsed from values to an int64. It returns false if v is not a number.
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// clientOnlyValues returns the chart values that disable the Consul servers and configure the clients and the other
+// components to use the external servers at hosts instead.
+func clientOnlyValues(hosts []string) map[string]interface{} {
+	// Copy the hosts into a []interface{} so the values match those parsed from a values file.
+	var hostVals []interface{}
+	for _, h := range hosts {
+		hostVals = append(hostVals, h)
+	}
+	return map[string]interface{}{
+		"server": map[string]interface{}{
+			"enabled": false,
+		},
+		"externalServers": map[string]interface{}{
+			"enabled": true,
+			"hosts":   hostVals,
+		},
+		"client": map[string]interface{}{
+			"join": hostVals,
+		},
+	}
+}
+
+// annotationsValue returns annotations in the form of the chart's annotations values, which are YAML strings.
+func annotationsValue(annotations map[string]string) (string, error) {
+	out, err := yaml.Marshal(annotations)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling annotations: %s", err)
+	}
+	return string(out), nil
+}
+
+// validateAnnotations returns an error if any of the annotation keys is not a valid Kubernetes annotation key.
+func validateAnnotations(flagName string, annotations map[string]string) error {
+	for key := range annotations {
+		// Annotation keys are validated like Kubernetes does, which accepts upper case prefixes.
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) != 0 {
+			return fmt.Errorf("-%s: invalid annotation key %q: %s", flagName, key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// applyPodSecurityLabels labels namespace so that PodSecurity admission enforces, audits and warns about level. The
+// namespace is created if it does not exist yet, in which case the install uses it as is.
+func (c *Command) applyPodSecurityLabels(namespace, level string) error {
+	labels := map[string]string{
+		"pod-security.kubernetes.io/enforce": level,
+		"pod-security.kubernetes.io/audit":   level,
+		"pod-security.kubernetes.io/warn":    level,
+	}
+	ns, err := c.kubernetes.CoreV1().Namespaces().Get(c.Ctx, namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = c.kubernetes.CoreV1().Namespaces().Create(c.Ctx, &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace, Labels: labels},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("error creating namespace %q: %s", namespace, err)
+		}
+		c.UI.Output("Created namespace %q with the %q Pod Security Standard", namespace, level, terminal.WithSuccessStyle())
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading namespace %q: %s", namespace, err)
+	}
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		ns.Labels[k] = v
+	}
+	if _, err := c.kubernetes.CoreV1().Namespaces().Update(c.Ctx, ns, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error labeling namespace %q: %s", namespace, err)
+	}
+	c.UI.Output("Applied the %q Pod Security Standard to namespace %q", level, namespace, terminal.WithSuccessStyle())
+	return nil
+}
+
+// ensurePriorityClass creates the priority class name with value unless a priority class with that name exists.
+func (c *Command) ensurePriorityClass(name string, value int32) error {
+	_, err := c.kubernetes.SchedulingV1().PriorityClasses().Get(c.Ctx, name, metav1.GetOptions{})
+	if err == nil {
+		c.UI.Output("Priority class %q already exists", name, terminal.WithInfoStyle())
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error reading priority class %q: %s", name, err)
+	}
+	_, err = c.kubernetes.SchedulingV1().PriorityClasses().Create(c.Ctx, &schedulingv1.PriorityClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Value:       value,
+		Description: "Priority class of the Consul servers, created by consul-k8s install.",
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating priority class %q: %s", name, err)
+	}
+	c.UI.Output("Created priority class %q", name, terminal.WithSuccessStyle())
+	return nil
+}
+
+// effectiveStorageClass returns server.storageClass, taking the chart's default values into account. It returns "" if
+// the servers use the cluster's default storage class.
+func effectiveStorageClass(chrt *chart.Chart, vals map[string]interface{}) string {
+	server, _ := common.MergeMaps(chrt.Values, vals)["server"].(map[string]interface{})
+	storageClass, _ := server["storageClass"].(string)
+	return storageClass
+}
+
+// checkStorageClass returns an error if the storage class name does not exist, since the servers' persistent volume
+// claims would stay pending.
+func (c *Command) checkStorageClass(name string) error {
+	_, err := c.kubernetes.StorageV1().StorageClasses().Get(c.Ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("storage class %q set by server.storageClass does not exist - the Consul servers' volumes "+
+			"will not be provisioned. Create it or use -%s", name, flagNameCreateStorageClass)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading storage class %q: %s", name, err)
+	}
+	return nil
+}
+
+// ensureStorageClass creates the storage class name with provisioner and parameters unless a storage class with that
+// name exists.
+func (c *Command) ensureStorageClass(name, provisioner string, parameters map[string]string) error {
+	_, err := c.kubernetes.StorageV1().StorageClasses().Get(c.Ctx, name, metav1.GetOptions{})
+	if err == nil {
+		c.UI.Output("Storage class %q already exists", name, terminal.WithInfoStyle())
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error reading storage class %q: %s", name, err)
+	}
+	_, err = c.kubernetes.StorageV1().StorageClasses().Create(c.Ctx, &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: name},
+		Provisioner: provisioner,
+		Parameters:  parameters,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating storage class %q: %s", name, err)
+	}
+	c.UI.Output("Created storage class %q", name, terminal.WithSuccessStyle())
+	return nil
+}
+
+// imagePullSecrets returns the names of the image pull secrets set by -image-pull-secret, followed by the secret
+// created by -create-pull-secret unless it is already among them.
+func (c *Command) imagePullSecrets() []string {
+	names := append([]string{}, c.flagImagePullSecrets...)
+	if c.flagCreatePullSecret == "" {
+		return names
+	}
+	for _, name := range names {
+		if name == c.flagCreatePullSecret {
+			return names
+		}
+	}
+	return append(names, c.flagCreatePullSecret)
+}
+
+// ensurePullSecret creates the docker-registry secret name in namespace from the registry credentials unless a secret
+// with that name exists. The namespace is created if it does not exist yet.
+func (c *Command) ensurePullSecret(name, namespace string) error {
+	_, err := c.kubernetes.CoreV1().Secrets(namespace).Get(c.Ctx, name, metav1.GetOptions{})
+	if err == nil {
+		c.UI.Output("Image pull secret %q already exists and was not updated", name, terminal.WithWarningStyle())
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error reading image pull secret %q: %s", name, err)
+	}
+	dockerConfig, err := dockerConfigJSON(c.flagRegistryServer, c.flagRegistryUsername, c.flagRegistryPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.kubernetes.CoreV1().Namespaces().Get(c.Ctx, namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = c.kubernetes.CoreV1().Namespaces().Create(c.Ctx, &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("error creating namespace %q: %s", namespace, err)
+	}
+
+	_, err = c.kubernetes.CoreV1().Secrets(namespace).Create(c.Ctx, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Type: v1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{v1.DockerConfigJsonKey: dockerConfig},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating image pull secret %q: %s", name, err)
+	}
+	c.UI.Output("Created image pull secret %q", name, terminal.WithSuccessStyle())
+	return nil
+}
+
+// dockerConfigJSON returns the .dockerconfigjson content of a docker-registry secret with the credentials for server.
+func dockerConfigJSON(server, username, password string) ([]byte, error) {
+	if err := validateRegistryCredentials(server, username, password); err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			server: map[string]string{
+				"username": username,
+				"password": password,
+				"auth":     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+			},
+		},
+	})
+}
+
+// validateRegistryCredentials checks that the registry credentials can be used for basic authentication to server.
+func validateRegistryCredentials(server, username, password string) error {
+	if strings.TrimSpace(server) == "" {
+		return fmt.Errorf("-%s must be set", flagNameRegistryServer)
+	}
+	if strings.ContainsAny(server, " \t\n") {
+		return fmt.Errorf("-%s: invalid registry server %q", flagNameRegistryServer, server)
+	}
+	if username == "" {
+		return fmt.Errorf("-%s must be set", flagNameRegistryUsername)
+	}
+	if strings.Contains(username, ":") {
+		return fmt.Errorf("-%s must not contain ':'", flagNameRegistryUsername)
+	}
+	if password == "" {
+		return fmt.Errorf("-%s must be set", flagNameRegistryPassword)
+	}
+	return nil
+}
+
+// topologySpreadValues returns the values that spread the Consul servers across zones. The chart renders
+// server.topologySpreadConstraints as a template, so the label selector matches the server pods of the release.
+func topologySpreadValues(maxSkew int, whenUnsatisfiable string) map[string]interface{} {
+	constraints := fmt.Sprintf(`- maxSkew: %d
+  topologyKey: topology.kubernetes.io/zone
+  whenUnsatisfiable: %s
+  labelSelector:
+    matchLabels:
+      app: {{ template "consul.name" . }}
+      release: "{{ .Release.Name }}"
+      component: server
+`, maxSkew, whenUnsatisfiable)
+	return map[string]interface{}{
+		"server": map[string]interface{}{
+			"topologySpreadConstraints": constraints,
+		},
+	}
+}
+
+// pruneReleaseHistory deletes the oldest history entries of the named release so that at most max entries remain.
+func pruneReleaseHistory(releases *storage.Storage, name string, max int) error {
+	history, err := releases.History(name)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error reading history of release %q: %s", name, err)
+	}
+	if len(history) <= max {
+		return nil
+	}
+	releaseutil.SortByRevision(history)
+	for _, rel := range history[:len(history)-max] {
+		if _, err := releases.Delete(rel.Name, rel.Version); err != nil {
+			return fmt.Errorf("error removing revision %d of release %q: %s", rel.Version, name, err)
+		}
+	}
+	return nil
+}
+
+// parseResources parses resources in the form cpu=<quantity>,mem=<quantity> into the chart's values for resource
+// requests or limits. Each quantity must be a valid Kubernetes quantity.
+func parseResources(resources string) (map[string]interface{}, error) {
+	vals := map[string]interface{}{}
+	for _, pair := range strings.Split(resources, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid resources %q: expected cpu=<quantity>,mem=<quantity>", resources)
+		}
+		var name string
+		switch kv[0] {
+		case "cpu":
+			name = "cpu"
+		case "mem", "memory":
+			name = "memory"
+		default:
+			return nil, fmt.Errorf("invalid resources %q: unknown resource %q, must be cpu or mem", resources, kv[0])
+		}
+		if _, ok := vals[name]; ok {
+			return nil, fmt.Errorf("invalid resources %q: %s is set more than once", resources, kv[0])
+		}
+		quantity, err := resource.ParseQuantity(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid resources %q: invalid %s quantity %q: %s", resources, kv[0], kv[1], err)
+		}
+		vals[name] = quantity.String()
+	}
+	return vals, nil
+}
+
+// readExtraConfig returns the Consul agent configuration given either as a JSON object or as the path to a file
+// containing one. The configuration must be a JSON object since the chart passes it to the agents as a JSON file.
+func readExtraConfig(value string) (string, error) {
+	config := strings.TrimSpace(value)
+	if !strings.HasPrefix(config, "{") {
+		contents, err := ioutil.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("error reading extra config: %s", err)
+		}
+		config = strings.TrimSpace(string(contents))
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		return "", fmt.Errorf("extra config is not a valid JSON object: %s", err)
+	}
+	return config, nil
+}
+
+// extraConfig returns the extra Consul agent configuration of component set by the extra config flag flagName with
+// value flagValue, with log_level set from -consul-log-level. When upgrading, the configuration is merged into the
+// release's current extraConfig of component instead of replacing it. It returns an empty config if nothing is set.
+func (c *Command) extraConfig(flagName, flagValue, component string) (string, error) {
+	var current string
+	if values, ok := c.currentValues[component].(map[string]interface{}); ok {
+		current, _ = values["extraConfig"].(string)
+	}
+	config := "{}"
+	if flagValue != "" {
+		var err error
+		if config, err = readExtraConfig(flagValue); err != nil {
+			return "", fmt.Errorf("-%s: %s", flagName, err)
+		}
+	}
+	if current == "" && c.flagConsulLogLevel == "" {
+		return config, nil
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		return "", fmt.Errorf("-%s: extra config is not a valid JSON object: %s", flagName, err)
+	}
+	if _, ok := parsed["log_level"]; ok && c.flagConsulLogLevel != "" {
+		return "", fmt.Errorf("-%s cannot be used with -%s setting log_level", flagNameConsulLogLevel, flagName)
+	}
+	if current != "" {
+		var currentParsed map[string]interface{}
+		if err := json.Unmarshal([]byte(current), &currentParsed); err != nil {
+			return "", fmt.Errorf("%s.extraConfig of the release is not a valid JSON object: %s", component, err)
+		}
+		parsed = common.MergeMaps(currentParsed, parsed)
+	}
+	if c.flagConsulLogLevel != "" {
+		// Consul expects upper case log levels.
+		parsed["log_level"] = strings.ToUpper(c.flagConsulLogLevel)
+	}
+	merged, err := json.Marshal(parsed)
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+// namespaceMirroringValues returns the chart values that enable Consul namespaces and mirror Kubernetes namespaces
+// into them for connect-inject, adding prefix to the name of each Consul namespace.
+func namespaceMirroringValues(prefix string) map[string]interface{} {
+	return map[string]interface{}{
+		"global": map[string]interface{}{
+			"enableConsulNamespaces": true,
+		},
+		"connectInject": map[string]interface{}{
+			"consulNamespaces": map[string]interface{}{
+				"mirroringK8S":       true,
+				"mirroringK8SPrefix": prefix,
+			},
+		},
+	}
+}
+
+// caCertValues returns the chart values that add caCert to the trusted CAs of the snapshot agent, the only component
+// of the chart with a value for an additional CA.
+func caCertValues(caCert string) map[string]interface{} {
+	return map[string]interface{}{
+		"client": map[string]interface{}{
+			"snapshotAgent": map[string]interface{}{
+				"caCert": caCert,
+			},
+		},
+	}
+}
+
+// literalValues converts -set-literal key/value pairs into chart values. Unlike -set, the value is never parsed, so
+// it may contain any characters, including '.', ',' and '='. The key is split into nested keys on each '.' that is
+// not escaped with '\'.
+func literalValues(literals map[string]string) (map[string]interface{}, error) {
+	// Sort the keys so that overlapping keys are applied in a consistent order.
+	keys := make([]string, 0, len(literals))
+	for k := range literals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	vals := map[string]interface{}{}
+	for _, k := range keys {
+		path := splitKey(k)
+		for _, p := range path {
+			if p == "" {
+				return nil, fmt.Errorf("invalid -%s key %q", flagNameLiteralValues, k)
+			}
+		}
+		var v interface{} = literals[k]
+		for i := len(path) - 1; i >= 0; i-- {
+			v = map[string]interface{}{path[i]: v}
+		}
+		vals = common.MergeMaps(vals, v.(map[string]interface{}))
+	}
+	return vals, nil
+}
+
+// splitKey splits a dotted key into its parts. A '.' preceded by '\' is kept as part of the key.
+func splitKey(key string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == '\\' && i+1 < len(key) && key[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case key[i] == '.':
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(key[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+// validateFlags is a helper function that performs sanity checks on the user's provided flags.
+func (c *Command) validateFlags(args []string) error {
+	if err := c.set.Parse(args); err != nil {
+		return err
+	}
+	if len(c.set.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	if err := c.ValidateValuesFlags(); err != nil {
+		return err
+	}
+	if !validLabel(c.flagNamespace) {
+		return fmt.Errorf("'%s' is an invalid namespace. Namespaces follow the RFC 1123 label convention and must "+
+			"consist of a lower case alphanumeric character or '-' and must start/end with an alphanumeric", c.flagNamespace)
+	}
+	duration, err := time.ParseDuration(c.flagTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to parse -%s: %s", flagNameTimeout, err)
+	}
+	c.timeoutDuration = duration
+	c.hookTimeoutDuration = duration
+	if c.flagWaitForJobs && !c.flagWait {
+		return fmt.Errorf("-%s requires -%s", flagNameWaitForJobs, flagNameWait)
+	}
+	if c.flagHookTimeout != "" {
+		if !c.flagWaitForJobs {
+			return fmt.Errorf("-%s requires -%s", flagNameHookTimeout, flagNameWaitForJobs)
+		}
+		hookTimeout, err := time.ParseDuration(c.flagHookTimeout)
+		if err != nil {
+			return fmt.Errorf("unable to parse -%s: %s", flagNameHookTimeout, err)
+		}
+		if hookTimeout <= 0 {
+			return fmt.Errorf("-%s must be positive", flagNameHookTimeout)
+		}
+		c.hookTimeoutDuration = hookTimeout
+	}
+	if c.flagValuesSchema != "" {
+		schema, err := readValuesSchema(c.flagValuesSchema)
+		if err != nil {
+			return err
+		}
+		c.valuesSchema = schema
+	}
+	if c.flagCreatePriorityClass && c.flagServerPriorityClass == "" {
+		return fmt.Errorf("-%s requires -%s", flagNameCreatePriorityClass, flagNameServerPriorityClass)
+	}
+	if c.flagCreateStorageClass && c.flagStorageClassProvisioner == "" {
+		return fmt.Errorf("-%s requires -%s", flagNameCreateStorageClass, flagNameStorageClassProvisioner)
+	}
+	if c.flagPriorityClassValue < -maxPriorityClassValue || c.flagPriorityClassValue > maxPriorityClassValue {
+		return fmt.Errorf("-%s must be between %d and %d", flagNamePriorityClassValue, -maxPriorityClassValue,
+			maxPriorityClassValue)
+	}
+	if c.flagCreatePullSecret != "" {
+		if err := validateRegistryCredentials(c.flagRegistryServer, c.flagRegistryUsername, c.flagRegistryPassword); err != nil {
+			return err
+		}
+	} else if c.flagRegistryUsername != "" || c.flagRegistryPassword != "" || c.flagRegistryServer != defaultRegistryServer {
+		return fmt.Errorf("-%s, -%s and -%s require -%s", flagNameRegistryServer, flagNameRegistryUsername,
+			flagNameRegistryPassword, flagNameCreatePullSecret)
+	}
+	for _, pattern := range c.flagBootstrapSecretPatterns {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("-%s must not be empty", flagNameBootstrapSecretPatterns)
+		}
+	}
+	if c.flagForceReinstall && c.flagSkipPreInstallChecks {
+		return fmt.Errorf("-%s cannot be used with -%s since existing installations are found by the pre-install checks",
+			flagNameForceReinstall, flagNameSkipPreInstallChecks)
+	}
+
+	if c.flagOutput == common.OutputJSON {
+		if !c.flagAutoApprove && !c.flagDryRun {
+			return fmt.Errorf("-%s=%s requires -%s or -%s", flagNameOutput, common.OutputJSON, flagNameAutoApprove,
+				flagNameDryRun)
+		}
+		// Keep stdout for the JSON document.
+		c.UI = &stderrUI{UI: c.UI}
+	}
+
+	if c.flagDryRun {
+		c.UI.Output("Performing dry run installation.", terminal.WithInfoStyle())
+	}
+	return nil
+}
+
+// AddHistoryMaxFlag adds the -history-max flag, which bounds the Helm release history, to f. The upgrade command adds
+// it too.
+func (c *Command) AddHistoryMaxFlag(f *flag.Set) {
+	f.IntVar(&flag.IntVar{
+		Name:    flagNameHistoryMax,
+		Target:  &c.flagHistoryMax,
+		Default: defaultHistoryMax,
+		Usage: "Maximum number of Helm release history entries to keep for the release. Older entries, for example " +
+			"left over from a previous installation, are removed. 0 means no limit.",
+	})
+}
+
+// SetCurrentValues sets the values of the release being upgraded. The extra config flags and -consul-log-level are
+// then merged into the release's current extraConfig rather than replacing it.
+func (c *Command) SetCurrentValues(vals map[string]interface{}) {
+	c.currentValues = vals
+}
+
+// HistoryMax returns the value of the -history-max flag.
+func (c *Command) HistoryMax() int {
+	return c.flagHistoryMax
+}
+
+// ValidateValuesFlags checks the flags added by AddValuesFlags and AddHistoryMaxFlag once they have been parsed.
+func (c *Command) ValidateValuesFlags() error {
+	if c.flagHistoryMax < 0 {
+		return fmt.Errorf("-%s must not be negative", flagNameHistoryMax)
+	}
+	if c.flagVerify {
+		if c.flagChartVersion == "" {
+			return fmt.Errorf("-%s requires -%s since the chart embedded in the CLI has no provenance file",
+				flagNameVerify, flagNameChartVersion)
+		}
+		if c.flagKeyring == "" {
+			return fmt.Errorf("-%s requires -%s", flagNameVerify, flagNameKeyring)
+		}
+	}
+	if c.flagKeyring != "" {
+		if !c.flagVerify {
+			return fmt.Errorf("-%s requires -%s", flagNameKeyring, flagNameVerify)
+		}
+		if _, err := os.Stat(c.flagKeyring); err != nil && os.IsNotExist(err) {
+			return fmt.Errorf("File '%s' does not exist.", c.flagKeyring)
+		}
+	}
+	if len(c.flagValueFiles) != 0 && c.flagPreset != defaultPreset {
+		return fmt.Errorf("Cannot set both -%s and -%s", flagNameConfigFile, flagNamePreset)
+	}
+	if _, ok := presets[c.flagPreset]; c.flagPreset != defaultPreset && !ok {
+		return fmt.Errorf("'%s' is not a valid preset", c.flagPreset)
+	}
+	if u, err := url.Parse(c.flagHelmRepoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("-%s: invalid Helm repository URL %q, it must be an http or https URL", flagNameHelmRepoURL,
+			c.flagHelmRepoURL)
+	}
+	if c.flagBaseValues != "" {
+		if _, err := os.Stat(c.flagBaseValues); err != nil && os.IsNotExist(err) {
+			return fmt.Errorf("File '%s' does not exist.", c.flagBaseValues)
+		}
+	}
+	if len(c.flagValueFiles) != 0 {
+		for _, filename := range c.flagValueFiles {
+			if _, err := os.Stat(filename); err != nil && os.IsNotExist(err) {
+				return fmt.Errorf("File '%s' does not exist.", filename)
+			}
+		}
+	}
+
+	if c.flagClientOnly && len(c.flagExternalServers) == 0 {
+		return fmt.Errorf("-%s requires the hosts of the external Consul servers to be set with -%s",
+			flagNameClientOnly, flagNameExternalServers)
+	}
+	if len(c.flagExternalServers) != 0 && !c.flagClientOnly {
+		return fmt.Errorf("-%s requires -%s", flagNameExternalServers, flagNameClientOnly)
+	}
+	for _, host := range c.flagExternalServers {
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("-%s cannot contain an empty host", flagNameExternalServers)
+		}
+	}
+	if err := validateAnnotations(flagNameServerAnnotations, c.flagServerAnnotations); err != nil {
+		return err
+	}
+	if err := validateAnnotations(flagNameClientAnnotations, c.flagClientAnnotations); err != nil {
+		return err
+	}
+	if err := validateAnnotations(flagNameServerServiceAccountAnnotations, c.flagServerServiceAccountAnnotations); err != nil {
+		return err
+	}
+	if err := validateAnnotations(flagNameClientServiceAccountAnnotations, c.flagClientServiceAccountAnnotations); err != nil {
+		return err
+	}
+	for key := range c.flagClientEnv {
+		if errs := validation.IsEnvVarName(key); len(errs) != 0 {
+			return fmt.Errorf("-%s: invalid environment variable name %q: %s", flagNameClientEnv, key, strings.Join(errs, "; "))
+		}
+	}
+	if c.flagServerPriorityClass != "" {
+		if errs := validation.IsDNS1123Subdomain(c.flagServerPriorityClass); len(errs) != 0 {
+			return fmt.Errorf("-%s: invalid priority class name %q: %s", flagNameServerPriorityClass,
+				c.flagServerPriorityClass, strings.Join(errs, "; "))
+		}
+	}
+	for _, name := range c.imagePullSecrets() {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			return fmt.Errorf("invalid image pull secret name %q: %s", name, strings.Join(errs, "; "))
+		}
+	}
+	if c.flagTopologyMaxSkew < 1 {
+		return fmt.Errorf("-%s must be at least 1", flagNameTopologyMaxSkew)
+	}
+	if c.flagTopologyWhenUnsatisfiable != "DoNotSchedule" && c.flagTopologyWhenUnsatisfiable != "ScheduleAnyway" {
+		return fmt.Errorf("-%s must be DoNotSchedule or ScheduleAnyway, got %q", flagNameTopologyWhenUnsatisfiable,
+			c.flagTopologyWhenUnsatisfiable)
+	}
+	if !c.flagTopologySpread && (c.flagTopologyMaxSkew != defaultTopologyMaxSkew ||
+		c.flagTopologyWhenUnsatisfiable != defaultTopologyWhenUnsatisfiable) {
+		return fmt.Errorf("-%s and -%s require -%s", flagNameTopologyMaxSkew, flagNameTopologyWhenUnsatisfiable,
+			flagNameTopologySpread)
+	}
+	if c.flagServerResources != "" {
+		if _, err := parseResources(c.flagServerResources); err != nil {
+			return fmt.Errorf("-%s: %s", flagNameServerResources, err)
+		}
+	}
+	if c.flagClientResources != "" {
+		if _, err := parseResources(c.flagClientResources); err != nil {
+			return fmt.Errorf("-%s: %s", flagNameClientResources, err)
+		}
+	}
+	if _, err := c.extraConfig(flagNameServerExtraConfig, c.flagServerExtraConfig, "server"); err != nil {
+		return err
+	}
+	if _, err := c.extraConfig(flagNameClientExtraConfig, c.flagClientExtraConfig, "client"); err != nil {
+		return err
+	}
+	if c.flagMetricsPort != 0 {
+		if !c.flagEnableMetrics {
+			return fmt.Errorf("-%s requires -%s", flagNameMetricsPort, flagNameEnableMetrics)
+		}
+		if c.flagMetricsPort < 1 || c.flagMetricsPort > 65535 {
+			return fmt.Errorf("-%s must be between 1 and 65535", flagNameMetricsPort)
+		}
+	}
+	if c.flagDNSClusterIP != "" {
+		if !c.flagDNSEnabled {
+			return fmt.Errorf("-%s requires -%s", flagNameDNSClusterIP, flagNameDNSEnabled)
+		}
+		if net.ParseIP(c.flagDNSClusterIP) == nil {
+			return fmt.Errorf("-%s: invalid IP address %q", flagNameDNSClusterIP, c.flagDNSClusterIP)
+		}
+	}
+	if c.flagMirroringPrefix != "" && !c.flagEnableNamespaceMirroring {
+		return fmt.Errorf("-%s requires -%s", flagNameMirroringPrefix, flagNameEnableNamespaceMirroring)
+	}
+
+	if c.flagCAFile != "" {
+		if err := validatePEMBundle(c.flagCAFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePEMBundle checks that the file contains at least one PEM-encoded certificate.
+func validatePEMBundle(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("unable to read -%s: %s", flagNameCAFile, err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return fmt.Errorf("-%s %q does not contain any PEM-encoded certificates", flagNameCAFile, filename)
 	}
 	return nil
 }
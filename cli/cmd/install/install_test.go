@@ -1,16 +1,54 @@
 package install
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/repo"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sversion "k8s.io/apimachinery/pkg/version"
+	cliresource "k8s.io/cli-runtime/pkg/resource"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	restclient "k8s.io/client-go/rest"
+	restfake "k8s.io/client-go/rest/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
 )
 
 func TestCheckForPreviousPVCs(t *testing.T) {
@@ -28,13 +66,13 @@ func TestCheckForPreviousPVCs(t *testing.T) {
 	}
 	c.kubernetes.CoreV1().PersistentVolumeClaims("default").Create(context.Background(), pvc, metav1.CreateOptions{})
 	c.kubernetes.CoreV1().PersistentVolumeClaims("default").Create(context.Background(), pvc2, metav1.CreateOptions{})
-	err := c.checkForPreviousPVCs()
+	err := c.checkForPreviousPVCs("")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "found PVCs from previous installations (default/consul-server-test1,default/consul-server-test2), delete before re-installing")
 
 	// Clear out the client and make sure the check now passes.
 	c.kubernetes = fake.NewSimpleClientset()
-	err = c.checkForPreviousPVCs()
+	err = c.checkForPreviousPVCs("")
 	require.NoError(t, err)
 
 	// Add a new irrelevant PVC and make sure the check continues to pass.
@@ -44,10 +82,67 @@ func TestCheckForPreviousPVCs(t *testing.T) {
 		},
 	}
 	c.kubernetes.CoreV1().PersistentVolumeClaims("default").Create(context.Background(), pvc, metav1.CreateOptions{})
-	err = c.checkForPreviousPVCs()
+	err = c.checkForPreviousPVCs("")
 	require.NoError(t, err)
 }
 
+// TestCheckForPreviousPVCs_Reuse checks that a leftover server PVC does not fail the check when -reuse-pvcs is set.
+func TestCheckForPreviousPVCs_Reuse(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset()
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "data-consul-consul-server-0",
+		},
+	}
+	c.kubernetes.CoreV1().PersistentVolumeClaims("consul").Create(context.Background(), pvc, metav1.CreateOptions{})
+
+	require.NoError(t, c.validateFlags([]string{"-reuse-pvcs"}))
+	require.NoError(t, c.checkForPreviousPVCs(""))
+}
+
+// TestConsulResourceNames checks that the names match those created by the chart's templates.
+func TestConsulResourceNames(t *testing.T) {
+	cases := map[string]ResourceNames{
+		"consul": {
+			Fullname:                "consul",
+			ServerStatefulSet:       "consul-server",
+			ServerService:           "consul-server",
+			ClientDaemonSet:         "consul",
+			ServerACLInitJob:        "consul-server-acl-init",
+			BootstrapACLTokenSecret: "consul-bootstrap-acl-token",
+			ConnectInjectDeployment: "consul-connect-injector-webhook-deployment",
+			DNSService:              "consul-dns",
+		},
+		"prod": {
+			Fullname:                "prod",
+			ServerStatefulSet:       "prod-server",
+			ServerService:           "prod-server",
+			ClientDaemonSet:         "prod",
+			ServerACLInitJob:        "prod-server-acl-init",
+			BootstrapACLTokenSecret: "prod-bootstrap-acl-token",
+			ConnectInjectDeployment: "prod-connect-injector-webhook-deployment",
+			DNSService:              "prod-dns",
+		},
+		// The name is truncated to 63 characters and a trailing dash is trimmed like the chart's consul.fullname.
+		strings.Repeat("a", 62) + "-b": {
+			Fullname:                strings.Repeat("a", 62),
+			ServerStatefulSet:       strings.Repeat("a", 62) + "-server",
+			ServerService:           strings.Repeat("a", 62) + "-server",
+			ClientDaemonSet:         strings.Repeat("a", 62),
+			ServerACLInitJob:        strings.Repeat("a", 62) + "-server-acl-init",
+			BootstrapACLTokenSecret: strings.Repeat("a", 62) + "-bootstrap-acl-token",
+			ConnectInjectDeployment: strings.Repeat("a", 62) + "-connect-injector-webhook-deployment",
+			DNSService:              strings.Repeat("a", 62) + "-dns",
+		},
+	}
+	for releaseName, expected := range cases {
+		t.Run(releaseName, func(t *testing.T) {
+			require.Equal(t, expected, consulResourceNames(releaseName))
+		})
+	}
+}
+
 func TestCheckForPreviousSecrets(t *testing.T) {
 	c := getInitializedCommand(t)
 	c.kubernetes = fake.NewSimpleClientset()
@@ -57,13 +152,13 @@ func TestCheckForPreviousSecrets(t *testing.T) {
 		},
 	}
 	c.kubernetes.CoreV1().Secrets("default").Create(context.Background(), secret, metav1.CreateOptions{})
-	err := c.checkForPreviousSecrets()
+	err := c.checkForPreviousSecrets("")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "found consul-acl-bootstrap-token secret from previous installations: \"test-consul-bootstrap-acl-token\" in namespace \"default\". To delete, run kubectl delete secret test-consul-bootstrap-acl-token --namespace default")
 
 	// Clear out the client and make sure the check now passes.
 	c.kubernetes = fake.NewSimpleClientset()
-	err = c.checkForPreviousSecrets()
+	err = c.checkForPreviousSecrets("")
 	require.NoError(t, err)
 
 	// Add a new irrelevant secret and make sure the check continues to pass.
@@ -73,10 +168,36 @@ func TestCheckForPreviousSecrets(t *testing.T) {
 		},
 	}
 	c.kubernetes.CoreV1().Secrets("default").Create(context.Background(), secret, metav1.CreateOptions{})
-	err = c.checkForPreviousSecrets()
+	err = c.checkForPreviousSecrets("")
 	require.NoError(t, err)
 }
 
+// TestCheckForPreviousSecrets_CustomPatterns checks that -bootstrap-secret-pattern replaces the secret names the check
+// looks for.
+func TestCheckForPreviousSecrets_CustomPatterns(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme-acl-bootstrap", Namespace: "default"},
+	}
+
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset(secret)
+	require.NoError(t, c.validateFlags([]string{}))
+	require.NoError(t, c.checkForPreviousSecrets(""))
+
+	c = getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset(secret)
+	require.NoError(t, c.validateFlags([]string{"-bootstrap-secret-pattern", "other-token",
+		"-bootstrap-secret-pattern", "acl-bootstrap"}))
+	err := c.checkForPreviousSecrets("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"acme-acl-bootstrap" in namespace "default"`)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-bootstrap-secret-pattern", ""})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "-bootstrap-secret-pattern must not be empty")
+}
+
 // TestValidateFlags tests the validate flags function.
 func TestValidateFlags(t *testing.T) {
 	// The following cases should all error, if they fail to this test fails.
@@ -108,6 +229,22 @@ func TestValidateFlags(t *testing.T) {
 			"Should have errored on a non-existant file.",
 			[]string{"-f=\"does_not_exist.txt\""},
 		},
+		{
+			"Should error on -verify without -version.",
+			[]string{"-verify", "-keyring=fixtures/provenance/helm-test-key.pub"},
+		},
+		{
+			"Should error on -verify without -keyring.",
+			[]string{"-verify", "-version=0.2.0"},
+		},
+		{
+			"Should error on -keyring without -verify.",
+			[]string{"-version=0.2.0", "-keyring=fixtures/provenance/helm-test-key.pub"},
+		},
+		{
+			"Should error on a non-existent keyring.",
+			[]string{"-verify", "-version=0.2.0", "-keyring=does_not_exist.gpg"},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -168,22 +305,2292 @@ func TestValidLabel(t *testing.T) {
 	}
 }
 
-// getInitializedCommand sets up a command struct for tests.
-func getInitializedCommand(t *testing.T) *Command {
+// TestCAFile checks that values files are downloaded with the -ca-file CA trusted and that the CA is added to the values.
+func TestCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("global:\n  datacenter: dc2\n"))
+	}))
+	defer server.Close()
+
+	caFile, err := ioutil.TempFile("", "ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	err = pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, err)
+	require.NoError(t, caFile.Close())
+	caCert, err := ioutil.ReadFile(caFile.Name())
+	require.NoError(t, err)
+
+	// Without the CA the download fails since the server's certificate is self-signed.
+	c := getInitializedCommand(t)
+	c.flagValueFiles = []string{server.URL + "/values.yaml"}
+	_, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.Error(t, err)
+
+	c.flagCAFile = caFile.Name()
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{
+			"datacenter": "dc2",
+		},
+		"client": map[string]interface{}{
+			"snapshotAgent": map[string]interface{}{
+				"caCert": string(caCert),
+			},
+		},
+	}, vals)
+}
+
+// TestRun_CAFileSummary checks that the summary states that only the snapshot agent trusts the -ca-file CA.
+func TestRun_CAFileSummary(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE",
+		Bytes: server.Certificate().Raw}), 0600))
+
+	c := getInitializedCommand(t)
+	c.kubernetes = newSupportedClientset()
+	c.Ctx = context.Background()
+	ui := &recordingUI{UI: c.UI}
+	c.UI = ui
+	// The command is initialized already, and initializing it again in Run would replace the UI.
+	c.once.Do(func() {})
+
+	require.Equal(t, exitCodeSuccess, c.Run([]string{"-dry-run", "-kubeconfig", "/nonexistent/kubeconfig",
+		"-ca-file", caFile}))
+	require.Contains(t, ui.messages, fmt.Sprintf("CA file: %s (trusted by the snapshot agent only, not by the "+
+		"Consul servers, clients or control plane)", caFile))
+}
+
+// TestSetLiteral checks that -set-literal values containing dots, commas and equals signs are kept intact and take
+// precedence over -set.
+func TestSetLiteral(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{
+		"-set", "global.datacenter=dc1",
+		"-set-literal", "global.datacenter=dc.2,dc=3",
+		"-set-literal", `server.extraConfig={"log_level": "DEBUG", "limits": {"http_max_conns_per_client": 1.5}}`,
+		"-set-literal", `global.annotations.example\.com/owner=team.a,team.b`,
+	})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{
+			"datacenter": "dc.2,dc=3",
+			"annotations": map[string]interface{}{
+				"example.com/owner": "team.a,team.b",
+			},
+		},
+		"server": map[string]interface{}{
+			"extraConfig": `{"log_level": "DEBUG", "limits": {"http_max_conns_per_client": 1.5}}`,
+		},
+	}, vals)
+
+	_, err = literalValues(map[string]string{"global..name": "consul"})
+	require.EqualError(t, err, `invalid -set-literal key "global..name"`)
+}
+
+// TestWatchEvents checks that notable warning events created while waiting for the installation are reported.
+func TestWatchEvents(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset()
+
+	// An event from before the wait started should not be reported.
+	createEvent(t, c, "old", "consul-server-0", v1.EventTypeWarning, "FailedScheduling", time.Now().Add(-time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reported := make(chan string, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.watchEvents(ctx, "consul", 10*time.Millisecond, func(event v1.Event) {
+			reported <- event.Name
+		})
+	}()
+
+	createEvent(t, c, "image", "consul-client-abcde", v1.EventTypeWarning, "BackOff", time.Now())
+	createEvent(t, c, "normal", "consul-server-0", v1.EventTypeNormal, "Scheduled", time.Now())
+	createEvent(t, c, "other-release", "vault-0", v1.EventTypeWarning, "BackOff", time.Now())
+	createEvent(t, c, "scheduling", "consul-server-0", v1.EventTypeWarning, "FailedScheduling", time.Now())
+
+	var names []string
+	for len(names) < 2 {
+		select {
+		case name := <-reported:
+			names = append(names, name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, got %v", names)
+		}
+	}
+	require.ElementsMatch(t, []string{"image", "scheduling"}, names)
+
+	// Events are only reported once.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	require.Empty(t, reported)
+}
+
+// createEvent creates an event for the pod named involved in the consul namespace.
+func createEvent(t *testing.T, c *Command, name, involved, eventType, reason string, timestamp time.Time) {
 	t.Helper()
-	log := hclog.New(&hclog.LoggerOptions{
-		Name:   "cli",
-		Level:  hclog.Info,
-		Output: os.Stdout,
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "consul",
+			UID:       types.UID(name),
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Pod",
+			Name:      involved,
+			Namespace: "consul",
+		},
+		Type:          eventType,
+		Reason:        reason,
+		Message:       "message",
+		Count:         1,
+		LastTimestamp: metav1.NewTime(timestamp),
+	}
+	_, err := c.kubernetes.CoreV1().Events("consul").Create(context.Background(), event, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
+
+// TestCheckClusterResources checks that a warning is returned when the cluster's nodes cannot fit the requested
+// resources.
+func TestCheckClusterResources(t *testing.T) {
+	manifest := `---
+# Source: consul/templates/server-statefulset.yaml
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: consul-server
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: consul
+          resources:
+            requests:
+              cpu: 500m
+              memory: 1Gi
+---
+# Source: consul/templates/client-daemonset.yaml
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: consul
+spec:
+  template:
+    spec:
+      containers:
+        - name: consul
+          resources:
+            requests:
+              cpu: 100m
+              memory: 100Mi
+---
+# Source: consul/templates/server-service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: consul-server
+`
+
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset()
+	for _, name := range []string{"node-1", "node-2"} {
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{
+				Allocatable: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("500m"),
+					v1.ResourceMemory: resource.MustParse("4Gi"),
+				},
+			},
+		}
+		_, err := c.kubernetes.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	// The nodes have enough memory but not enough CPU.
+	warnings, err := c.checkClusterResources(manifest)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"installation requests 1700m cpu but the cluster's nodes only have 1 allocatable",
+	}, warnings)
+}
+
+// TestRun_Aborted checks that declining the confirmation prompt returns the user abort exit code.
+func TestRun_Aborted(t *testing.T) {
+	stdin, err := ioutil.TempFile("", "stdin")
+	require.NoError(t, err)
+	defer os.Remove(stdin.Name())
+	_, err = stdin.WriteString("n\n")
+	require.NoError(t, err)
+	_, err = stdin.Seek(0, 0)
+	require.NoError(t, err)
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	c := getInitializedCommand(t)
+	c.Ctx = context.Background()
+	c.kubernetes = newSupportedClientset()
+	code := c.Run([]string{"-kubeconfig", "does_not_exist.yaml"})
+	require.Equal(t, exitCodeAborted, code)
+}
+
+// TestNamespaceMirroring checks that -enable-namespace-mirroring and -mirroring-prefix set the namespace values.
+func TestNamespaceMirroring(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{
+		"-enable-namespace-mirroring",
+		"-mirroring-prefix", "k8s-",
+		"-set", "connectInject.enabled=true",
 	})
+	require.NoError(t, err)
 
-	baseCommand := &common.BaseCommand{
-		Log: log,
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{
+			"enableConsulNamespaces": true,
+		},
+		"connectInject": map[string]interface{}{
+			"enabled": true,
+			"consulNamespaces": map[string]interface{}{
+				"mirroringK8S":       true,
+				"mirroringK8SPrefix": "k8s-",
+			},
+		},
+	}, vals)
+
+	// A prefix without mirroring is rejected.
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-mirroring-prefix", "k8s-"})
+	require.EqualError(t, err, "-mirroring-prefix requires -enable-namespace-mirroring")
+}
+
+// TestCheckServerReplicas checks that server.bootstrapExpect must match the effective server.replicas.
+func TestCheckServerReplicas(t *testing.T) {
+	cases := map[string]struct {
+		vals        string
+		expectedErr string
+	}{
+		"chart defaults": {
+			vals: `{}`,
+		},
+		"replicas without bootstrapExpect": {
+			vals: `{"server": {"replicas": 5}}`,
+		},
+		"matching values": {
+			vals: `{"server": {"replicas": 5, "bootstrapExpect": 5}}`,
+		},
+		"bootstrapExpect greater than default replicas": {
+			vals:        `{"server": {"bootstrapExpect": 5}}`,
+			expectedErr: "server.bootstrapExpect (5) does not match server.replicas (3)",
+		},
+		"bootstrapExpect lower than replicas": {
+			vals:        `{"server": {"replicas": 5, "bootstrapExpect": 1}}`,
+			expectedErr: "server.bootstrapExpect (1) does not match server.replicas (5)",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := checkServerReplicas(embeddedChart(t), convert(tc.vals))
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expectedErr)
+			}
+		})
 	}
+}
 
-	c := &Command{
-		BaseCommand: baseCommand,
+// TestClientOnly checks the values for a client-only install and that external server hosts are required.
+func TestClientOnly(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-client-only", "-external-servers", "consul-1.example.com,consul-2.example.com"})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"enabled": false,
+		},
+		"externalServers": map[string]interface{}{
+			"enabled": true,
+			"hosts":   []interface{}{"consul-1.example.com", "consul-2.example.com"},
+		},
+		"client": map[string]interface{}{
+			"join": []interface{}{"consul-1.example.com", "consul-2.example.com"},
+		},
+	}, vals)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-client-only"})
+	require.EqualError(t, err, "-client-only requires the hosts of the external Consul servers to be set with -external-servers")
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-external-servers", "consul.example.com"})
+	require.EqualError(t, err, "-external-servers requires -client-only")
+}
+
+// TestResources checks that -server-resources and -client-resources produce the chart's resources values.
+func TestResources(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{
+		"-server-resources", "cpu=500m,mem=1Gi",
+		"-client-resources", "mem=100Mi",
+	})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": "500m", "memory": "1Gi"},
+				"limits":   map[string]interface{}{"cpu": "500m", "memory": "1Gi"},
+			},
+		},
+		"client": map[string]interface{}{
+			"resources": map[string]interface{}{
+				"requests": map[string]interface{}{"memory": "100Mi"},
+				"limits":   map[string]interface{}{"memory": "100Mi"},
+			},
+		},
+	}, vals)
+
+	invalid := map[string]string{
+		"cpu":                "expected cpu=<quantity>,mem=<quantity>",
+		"disk=1Gi":           `unknown resource "disk"`,
+		"cpu=lots":           `invalid cpu quantity "lots"`,
+		"cpu=100m,cpu=200m":  "cpu is set more than once",
+		"mem=1Gi,memory=2Gi": "memory is set more than once",
+	}
+	for resources, expErr := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags([]string{"-server-resources", resources})
+		require.Error(t, err, resources)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+// TestExtraConfig checks that -server-extra-config and -client-extra-config set the chart's extraConfig values from
+// a file and from literal JSON.
+func TestExtraConfig(t *testing.T) {
+	file, err := ioutil.TempFile("", "extra-config")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("{\"log_level\": \"DEBUG\"}\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	c := getInitializedCommand(t)
+	err = c.validateFlags([]string{
+		"-server-extra-config", file.Name(),
+		"-client-extra-config", `{"leave_on_terminate": true}`,
+	})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"extraConfig": `{"log_level": "DEBUG"}`,
+		},
+		"client": map[string]interface{}{
+			"extraConfig": `{"leave_on_terminate": true}`,
+		},
+	}, vals)
+
+	invalid := map[string]string{
+		`{"log_level": }`:         "extra config is not a valid JSON object",
+		"/nonexistent/extra.json": "error reading extra config",
+	}
+	for extraConfig, expErr := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags([]string{"-client-extra-config", extraConfig})
+		require.Error(t, err, extraConfig)
+		require.Contains(t, err.Error(), "-client-extra-config: "+expErr)
+	}
+}
+
+// TestConsulLogLevel checks that -consul-log-level sets log_level in the extra config of the servers and clients.
+func TestConsulLogLevel(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-consul-log-level", "debug"}))
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"extraConfig": `{"log_level":"DEBUG"}`,
+		},
+		"client": map[string]interface{}{
+			"extraConfig": `{"log_level":"DEBUG"}`,
+		},
+	}, vals)
+
+	// The log level is added to any other extra config.
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-consul-log-level", "trace",
+		"-client-extra-config", `{"leave_on_terminate": true}`}))
+	vals, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"extraConfig": `{"log_level":"TRACE"}`,
+		},
+		"client": map[string]interface{}{
+			"extraConfig": `{"leave_on_terminate":true,"log_level":"TRACE"}`,
+		},
+	}, vals)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-consul-log-level", "info", "-server-extra-config", `{"log_level": "DEBUG"}`})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "-consul-log-level cannot be used with -server-extra-config setting log_level")
+
+	c = getInitializedCommand(t)
+	require.Error(t, c.validateFlags([]string{"-consul-log-level", "verbose"}))
+}
+
+// TestDNS checks that -dns-enabled and -dns-cluster-ip set the chart values and that the IP of the DNS service is
+// output with the CoreDNS configuration.
+func TestDNS(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-dns-enabled", "-dns-cluster-ip", "10.96.0.53"}))
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"dns": map[string]interface{}{
+			"enabled":   true,
+			"type":      "ClusterIP",
+			"clusterIP": "10.96.0.53",
+		},
+	}, vals)
+
+	c.kubernetes = fake.NewSimpleClientset(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "consul-dns", Namespace: "consul"},
+		Spec:       v1.ServiceSpec{ClusterIP: "10.96.0.53"},
+	})
+	c.Ctx = context.Background()
+	ui := &recordingUI{UI: c.UI}
+	c.UI = ui
+	require.NoError(t, c.outputDNS("consul"))
+	require.Len(t, ui.messages, 3)
+	require.Contains(t, ui.messages[1], `"consul-dns" has cluster IP 10.96.0.53`)
+	require.Equal(t, "consul {\n  errors\n  cache 30\n  forward . 10.96.0.53\n}", ui.messages[2])
+
+	err = c.outputDNS("other")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `error reading the Consul DNS service "consul-dns"`)
+
+	invalid := map[string][]string{
+		"-dns-cluster-ip requires -dns-enabled":     {"-dns-cluster-ip", "10.96.0.53"},
+		`-dns-cluster-ip: invalid IP address "dns"`: {"-dns-enabled", "-dns-cluster-ip", "dns"},
+	}
+	for expErr, args := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags(args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+// TestOutputACLTokens checks that the secrets holding the ACL tokens are listed, the bootstrap token first, when the
+// chart manages the ACLs.
+func TestOutputACLTokens(t *testing.T) {
+	chrt := embeddedChart(t)
+	require.False(t, aclsManaged(chrt, map[string]interface{}{}))
+	require.True(t, aclsManaged(chrt, Presets()[PresetSecure]))
+
+	secret := func(name string) *v1.Secret {
+		return &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "consul"}}
+	}
+	c := getInitializedCommand(t)
+	c.Ctx = context.Background()
+	c.kubernetes = fake.NewSimpleClientset(
+		secret("consul-client-acl-token"),
+		secret("consul-bootstrap-acl-token"),
+		secret("consul-connect-inject-acl-token"),
+		secret("consul-ca-cert"),
+		secret("vault-acl-token"),
+	)
+	ui := &recordingUI{UI: c.UI}
+	c.UI = ui
+	require.NoError(t, c.outputACLTokens("consul"))
+	require.Equal(t, []string{
+		"ACL Tokens",
+		`The ACL tokens are stored in these secrets in namespace "consul":`,
+		"consul-bootstrap-acl-token",
+		"consul-client-acl-token",
+		"consul-connect-inject-acl-token",
+		"To read a token, run: kubectl get secret <name> --namespace consul --output jsonpath='{.data.token}' | base64 --decode",
+		"The bootstrap token can also be printed with: consul-k8s acl bootstrap-token --namespace consul",
+	}, ui.messages)
+
+	// Before the server-acl-init job completes, there are no secrets yet.
+	ui.messages = nil
+	require.NoError(t, c.outputACLTokens("other"))
+	require.Equal(t, []string{
+		"ACL Tokens",
+		`The ACL tokens will be stored in secrets named consul-<component>-acl-token in namespace "other" once the consul-server-acl-init job completes.`,
+	}, ui.messages)
+}
+
+// TestWaitForJobs checks that with -wait-for-jobs, the chart's hooks and jobs are waited for with -hook-timeout while
+// the other resources of the installation are waited for with -timeout, and that a job still running when
+// -hook-timeout expires fails the install.
+func TestWaitForJobs(t *testing.T) {
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.1.0"},
+		Templates: []*chart.File{
+			{Name: "templates/tls-init-job.yaml", Data: []byte("{{- if .Values.hook }}\napiVersion: batch/v1\nkind: Job\nmetadata:\n  name: consul-tls-init\n  annotations:\n    \"helm.sh/hook\": pre-install\n{{- end }}\n")},
+			{Name: "templates/server-acl-init-job.yaml", Data: []byte("apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: consul-server-acl-init\n")},
+			{Name: "templates/server-statefulset.yaml", Data: []byte("apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: consul-server\n")},
+		},
+	}
+	cases := map[string]struct {
+		args        []string
+		hook        bool
+		expTimeouts map[string]time.Duration
+		expErr      string
+	}{
+		"jobs complete within -hook-timeout": {
+			args: []string{"-timeout", "30s", "-wait-for-jobs", "-hook-timeout", "5m"},
+			hook: true,
+			expTimeouts: map[string]time.Duration{
+				"consul-tls-init":        5 * time.Minute,
+				"consul-server-acl-init": 5 * time.Minute,
+				"consul-server":          30 * time.Second,
+			},
+		},
+		"hook still running": {
+			args:   []string{"-timeout", "10m", "-wait-for-jobs", "-hook-timeout", "30s"},
+			hook:   true,
+			expErr: "error waiting for hook with -hook-timeout 30s: timed out waiting for the condition",
+		},
+		"job still running": {
+			args:   []string{"-timeout", "10m", "-wait-for-jobs", "-hook-timeout", "30s"},
+			expErr: "error waiting for jobs with -hook-timeout 30s: timed out waiting for the condition",
+		},
+		"without -wait-for-jobs": {
+			args: []string{"-timeout", "10m"},
+			hook: true,
+			expTimeouts: map[string]time.Duration{
+				"consul-tls-init":        10 * time.Minute,
+				"consul-server-acl-init": 10 * time.Minute,
+				"consul-server":          10 * time.Minute,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			require.NoError(t, c.validateFlags(tc.args))
+			kubeClient := &jobsKubeClient{
+				PrintingKubeClient: kubefake.PrintingKubeClient{Out: ioutil.Discard},
+				jobDuration:        time.Minute,
+				timeouts:           map[string]time.Duration{},
+			}
+			actionConfig := &action.Configuration{
+				Releases:     storage.Init(driver.NewMemory()),
+				KubeClient:   kubeClient,
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          t.Logf,
+			}
+
+			_, err := c.newInstallAction(actionConfig).Run(chrt, map[string]interface{}{"hook": tc.hook})
+			if tc.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			for name, timeout := range tc.expTimeouts {
+				require.Equal(t, timeout, kubeClient.timeouts[name], name)
+			}
+		})
+	}
+
+	invalid := map[string][]string{
+		"-wait-for-jobs requires -wait":         {"-wait=false", "-wait-for-jobs"},
+		"-hook-timeout requires -wait-for-jobs": {"-hook-timeout", "5m"},
+		"unable to parse -hook-timeout":         {"-wait-for-jobs", "-hook-timeout", "soon"},
+		"-hook-timeout must be positive":        {"-wait-for-jobs", "-hook-timeout", "0s"},
+	}
+	for expErr, args := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags(args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+
+	// Without -hook-timeout, the hooks and jobs are waited for with -timeout.
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-timeout", "3m", "-wait-for-jobs"}))
+	require.Equal(t, 3*time.Minute, c.hookTimeoutDuration)
+}
+
+// jobsKubeClient builds the resources of the manifests it is given, and records the timeout each resource is waited
+// for with by name. Its jobs run for jobDuration, so waiting for them to complete with a shorter timeout fails.
+type jobsKubeClient struct {
+	kubefake.PrintingKubeClient
+	jobDuration time.Duration
+	timeouts    map[string]time.Duration
+}
+
+func (k *jobsKubeClient) Build(reader io.Reader, _ bool) (kube.ResourceList, error) {
+	manifest, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var resources kube.ResourceList
+	for _, doc := range releaseutil.SplitManifests(string(manifest)) {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			return nil, err
+		}
+		if obj.Object == nil {
+			continue
+		}
+		// None of the resources exist yet, which Helm checks before installing.
+		gvk := obj.GroupVersionKind()
+		resources = append(resources, &cliresource.Info{
+			Name:      obj.GetName(),
+			Namespace: "consul",
+			Object:    obj,
+			Client: &restfake.RESTClient{
+				NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+				Resp:                 &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader(""))},
+			},
+			Mapping: &meta.RESTMapping{
+				Resource:         gvk.GroupVersion().WithResource(strings.ToLower(gvk.Kind) + "s"),
+				GroupVersionKind: gvk,
+				Scope:            meta.RESTScopeNamespace,
+			},
+		})
+	}
+	return resources, nil
+}
+
+func (k *jobsKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	k.wait(resources, timeout, false)
+	return nil
+}
+
+func (k *jobsKubeClient) WaitWithJobs(resources kube.ResourceList, timeout time.Duration) error {
+	return k.wait(resources, timeout, true)
+}
+
+func (k *jobsKubeClient) WatchUntilReady(resources kube.ResourceList, timeout time.Duration) error {
+	return k.wait(resources, timeout, true)
+}
+
+func (k *jobsKubeClient) wait(resources kube.ResourceList, timeout time.Duration, jobs bool) error {
+	for _, r := range resources {
+		k.timeouts[r.Name] = timeout
+		if jobs && r.Object.GetObjectKind().GroupVersionKind().Kind == "Job" && timeout < k.jobDuration {
+			return errors.New("timed out waiting for the condition")
+		}
+	}
+	return nil
+}
+
+// TestPollRaftPeers checks that waiting for the Consul servers succeeds once enough servers have joined the Raft
+// cluster, and times out otherwise.
+func TestPollRaftPeers(t *testing.T) {
+	// Each poll returns the next response, repeating the last one.
+	responses := []peersResponse{
+		{err: errors.New("no endpoints available for service \"consul-server\"")},
+		{body: `["10.0.0.1:8300"]`},
+		{body: `["10.0.0.1:8300","10.0.0.2:8300","10.0.0.3:8300"]`},
+	}
+	newClient := func(t *testing.T, responses []peersResponse) (*fake.Clientset, *int) {
+		client := fake.NewSimpleClientset()
+		polls := 0
+		client.PrependProxyReactor("services", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+			proxy := action.(k8stesting.ProxyGetAction)
+			require.Equal(t, "consul-server", proxy.GetName())
+			require.Equal(t, "https", proxy.GetScheme())
+			require.Equal(t, "8501", proxy.GetPort())
+			require.Equal(t, "/v1/status/peers", proxy.GetPath())
+			resp := responses[len(responses)-1]
+			if polls < len(responses) {
+				resp = responses[polls]
+			}
+			polls++
+			return true, resp, nil
+		})
+		return client, &polls
+	}
+
+	c := getInitializedCommand(t)
+	client, polls := newClient(t, responses)
+	c.kubernetes = client
+	require.NoError(t, c.pollRaftPeers(context.Background(), "consul", "https", 3, time.Millisecond))
+	require.Equal(t, 3, *polls)
+
+	c = getInitializedCommand(t)
+	client, _ = newClient(t, responses[:2])
+	c.kubernetes = client
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.pollRaftPeers(ctx, "consul", "https", 3, time.Millisecond)
+	require.EqualError(t, err, "timed out waiting for 3 Consul server(s) to join the Raft cluster: 1 of 3 servers have joined")
+}
+
+// TestExpectedServers checks the number of servers and the scheme of their HTTP API derived from the values.
+func TestExpectedServers(t *testing.T) {
+	cases := map[string]struct {
+		vals      string
+		expected  int
+		expScheme string
+	}{
+		"chart defaults":             {vals: ``, expected: 3, expScheme: "http"},
+		"replicas":                   {vals: `{"server": {"replicas": 5}}`, expected: 5, expScheme: "http"},
+		"bootstrap expect":           {vals: `{"server": {"replicas": 5, "bootstrapExpect": 5}}`, expected: 5, expScheme: "http"},
+		"TLS":                        {vals: `{"global": {"tls": {"enabled": true}}}`, expected: 3, expScheme: "https"},
+		"TLS not https only":         {vals: `{"global": {"tls": {"enabled": true, "httpsOnly": false}}}`, expected: 3, expScheme: "http"},
+		"servers disabled":           {vals: `{"server": {"enabled": false}}`},
+		"globally disabled":          {vals: `{"global": {"enabled": false}}`},
+		"servers enabled explicitly": {vals: `{"global": {"enabled": false}, "server": {"enabled": true}}`, expected: 3, expScheme: "http"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			vals := map[string]interface{}{}
+			if tc.vals != "" {
+				require.NoError(t, json.Unmarshal([]byte(tc.vals), &vals))
+			}
+			expected, scheme, err := expectedServers(embeddedChart(t), vals)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, expected)
+			if tc.expected != 0 {
+				require.Equal(t, tc.expScheme, scheme)
+			}
+		})
+	}
+}
+
+// peersResponse is the response of the Consul servers to a request for the Raft peers through the service proxy.
+type peersResponse struct {
+	body string
+	err  error
+}
+
+func (r peersResponse) DoRaw(context.Context) ([]byte, error) {
+	return []byte(r.body), r.err
+}
+
+func (r peersResponse) Stream(context.Context) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(r.body)), r.err
+}
+
+// TestEnableMetrics checks that -enable-metrics and -metrics-port set the metrics values and that agent metrics are
+// rejected with HTTPS only TLS.
+func TestEnableMetrics(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-enable-metrics", "-metrics-port", "20300"}))
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{
+			"metrics": map[string]interface{}{
+				"enabled":            true,
+				"enableAgentMetrics": true,
+			},
+		},
+		"connectInject": map[string]interface{}{
+			"metrics": map[string]interface{}{
+				"defaultEnabled":              true,
+				"defaultPrometheusScrapePort": 20300,
+			},
+		},
+	}, vals)
+	require.NoError(t, checkAgentMetrics(embeddedChart(t), vals))
+
+	// The secure preset enables HTTPS only TLS.
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-enable-metrics", "-preset", "secure"}))
+	vals, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	err = checkAgentMetrics(embeddedChart(t), vals)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot be enabled with HTTPS only TLS")
+
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-enable-metrics", "-preset", "secure",
+		"-set", "global.tls.httpsOnly=false"}))
+	vals, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.NoError(t, checkAgentMetrics(embeddedChart(t), vals))
+
+	invalid := map[string][]string{
+		"-metrics-port requires -enable-metrics":    {"-metrics-port", "20300"},
+		"-metrics-port must be between 1 and 65535": {"-enable-metrics", "-metrics-port", "70000"},
+	}
+	for expErr, args := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags(args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+// TestBaseValues checks that -base-values has the lowest precedence: base < preset < file < set.
+func TestBaseValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "base-values")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base.yaml")
+	require.NoError(t, ioutil.WriteFile(base, []byte(`
+global:
+  name: base
+  datacenter: base
+  image: base
+server:
+  replicas: 5
+  storage: base
+`), 0644))
+	file := filepath.Join(dir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`
+global:
+  datacenter: file
+  image: file
+`), 0644))
+
+	// The demo preset sets global.name and server.replicas.
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-base-values", base, "-preset", "demo", "-set", "server.storage=set"}))
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	global := vals["global"].(map[string]interface{})
+	server := vals["server"].(map[string]interface{})
+	require.Equal(t, "consul", global["name"])
+	require.Equal(t, "base", global["datacenter"])
+	require.Equal(t, float64(1), server["replicas"])
+	require.Equal(t, "set", server["storage"])
+
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-base-values", base, "-f", file, "-set", "global.image=set"}))
+	vals, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	global = vals["global"].(map[string]interface{})
+	server = vals["server"].(map[string]interface{})
+	require.Equal(t, "base", global["name"])
+	require.Equal(t, "file", global["datacenter"])
+	require.Equal(t, "set", global["image"])
+	require.Equal(t, float64(5), server["replicas"])
+	require.Equal(t, "base", server["storage"])
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-base-values", filepath.Join(dir, "missing.yaml")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not exist")
+}
+
+// TestClientEnv checks that -client-env sets the chart's extra environment variables of the clients.
+func TestClientEnv(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-client-env", "GOMAXPROCS=2", "-client-env", "HTTPS_PROXY=http://proxy:3128"})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"client": map[string]interface{}{
+			"extraEnvironmentVars": map[string]interface{}{
+				"GOMAXPROCS":  "2",
+				"HTTPS_PROXY": "http://proxy:3128",
+			},
+		},
+	}, vals)
+
+	// Explicitly set values take precedence.
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-client-env", "GOMAXPROCS=2", "-set", "client.extraEnvironmentVars.GOMAXPROCS=4"})
+	require.NoError(t, err)
+	vals, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"client": map[string]interface{}{
+			"extraEnvironmentVars": map[string]interface{}{
+				"GOMAXPROCS": int64(4),
+			},
+		},
+	}, vals)
+
+	for _, key := range []string{"1ST", "HAS SPACE", ""} {
+		c := getInitializedCommand(t)
+		err := c.validateFlags([]string{"-client-env", key + "=value"})
+		require.Error(t, err, key)
+		require.Contains(t, err.Error(), fmt.Sprintf("-client-env: invalid environment variable name %q", key))
+	}
+}
+
+// TestApplyPodSecurityLabels checks that the PodSecurity labels are applied to new and existing namespaces.
+func TestApplyPodSecurityLabels(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.Ctx = context.Background()
+	c.kubernetes = fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Labels: map[string]string{"team": "a"}},
+	})
+
+	require.NoError(t, c.applyPodSecurityLabels("new", podSecurityBaseline))
+	ns, err := c.kubernetes.CoreV1().Namespaces().Get(context.Background(), "new", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"pod-security.kubernetes.io/enforce": "baseline",
+		"pod-security.kubernetes.io/audit":   "baseline",
+		"pod-security.kubernetes.io/warn":    "baseline",
+	}, ns.Labels)
+
+	require.NoError(t, c.applyPodSecurityLabels("existing", podSecurityRestricted))
+	ns, err = c.kubernetes.CoreV1().Namespaces().Get(context.Background(), "existing", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"team":                               "a",
+		"pod-security.kubernetes.io/enforce": "restricted",
+		"pod-security.kubernetes.io/audit":   "restricted",
+		"pod-security.kubernetes.io/warn":    "restricted",
+	}, ns.Labels)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-pod-security-level", "strict"})
+	require.Error(t, err)
+}
+
+// TestServerPriorityClass checks that -server-priority-class sets the chart value and that the priority class is
+// created when requested.
+func TestServerPriorityClass(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-server-priority-class", "consul-critical", "-create-priority-class",
+		"-priority-class-value", "2000"})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"priorityClassName": "consul-critical",
+		},
+	}, vals)
+
+	c.kubernetes = fake.NewSimpleClientset()
+	c.Ctx = context.Background()
+	require.NoError(t, c.ensurePriorityClass("consul-critical", 2000))
+	class, err := c.kubernetes.SchedulingV1().PriorityClasses().Get(context.Background(), "consul-critical", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2000), class.Value)
+
+	// An existing priority class is left as is.
+	require.NoError(t, c.ensurePriorityClass("consul-critical", 3000))
+	class, err = c.kubernetes.SchedulingV1().PriorityClasses().Get(context.Background(), "consul-critical", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2000), class.Value)
+
+	invalid := map[string][]string{
+		`invalid priority class name "Not_Valid"`:                {"-server-priority-class", "Not_Valid"},
+		"-create-priority-class requires -server-priority-class": {"-create-priority-class"},
+		"-priority-class-value must be between":                  {"-server-priority-class", "a", "-priority-class-value", "2000000000"},
+	}
+	for expErr, args := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags(args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+// TestRenderManifest checks that the dry run manifest includes the chart's hooks and templates.
+func TestRenderManifest(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-dry-run"}))
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.1.0"},
+		Templates: []*chart.File{
+			{Name: "templates/server-service.yaml", Data: []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: {{ .Values.global.name }}-server\n")},
+			{Name: "templates/tls-init-job.yaml", Data: []byte("apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: tls-init\n  annotations:\n    \"helm.sh/hook\": pre-install\n")},
+		},
+	}
+	manifest, err := c.renderManifest(chrt, map[string]interface{}{
+		"global": map[string]interface{}{"name": "consul"},
+	}, t.Logf)
+	require.NoError(t, err)
+	require.Equal(t, `---
+# Source: consul/templates/tls-init-job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: tls-init
+  annotations:
+    "helm.sh/hook": pre-install
+---
+# Source: consul/templates/server-service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: consul-server
+`, manifest)
+
+	// The embedded chart renders with the values of the presets.
+	embedded, err := loadChart()
+	require.NoError(t, err)
+	manifest, err = c.renderManifest(embedded, common.MergeMaps(convert(globalNameConsul), Presets()[PresetSecure]), t.Logf)
+	require.NoError(t, err)
+	require.Contains(t, manifest, "# Source: consul/templates/server-statefulset.yaml")
+	require.Contains(t, manifest, "# Source: consul/templates/server-acl-init-job.yaml")
+}
+
+// TestOutputJSON checks that -output=json outputs the result document to stdout and the text to stderr, and that it
+// requires -auto-approve or -dry-run since the confirmation prompt would be output with the document.
+func TestOutputJSON(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-output", "json"})
+	require.EqualError(t, err, "-output=json requires -auto-approve or -dry-run")
+
+	c = getInitializedCommand(t)
+	ui := &writersUI{UI: c.UI}
+	c.UI = ui
+	require.NoError(t, c.validateFlags([]string{"-output", "json", "-dry-run"}))
+	require.Empty(t, ui.stdout.String())
+	require.Contains(t, ui.stderr.String(), "Performing dry run installation.")
+
+	exitCode := c.outputResult(installResult{
+		Name:         "consul",
+		Namespace:    "consul",
+		ChartVersion: "0.1.0",
+		Values:       map[string]interface{}{"global": map[string]interface{}{"name": "consul"}},
+		Status:       statusDryRun,
+		Manifest:     "---\n# Source: consul/templates/server-service.yaml\n",
+	}, exitCodeSuccess)
+	require.Equal(t, exitCodeSuccess, exitCode)
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(ui.stdout.Bytes(), &result))
+	require.Equal(t, map[string]interface{}{
+		"name":         "consul",
+		"namespace":    "consul",
+		"chartVersion": "0.1.0",
+		"values":       map[string]interface{}{"global": map[string]interface{}{"name": "consul"}},
+		"status":       "dry-run",
+		"manifest":     "---\n# Source: consul/templates/server-service.yaml\n",
+	}, result)
+
+	// The text output is unchanged by default.
+	c = getInitializedCommand(t)
+	ui = &writersUI{UI: c.UI}
+	c.UI = ui
+	require.NoError(t, c.validateFlags([]string{"-dry-run"}))
+	require.Same(t, ui, c.UI)
+}
+
+// TestLocateChart checks that the chart embedded in the CLI is installed unless -version is set.
+func TestLocateChart(t *testing.T) {
+	embedded, err := loadChart()
+	require.NoError(t, err)
+
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags(nil))
+	chrt, err := c.LocateChart(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, embedded.Metadata.Version, chrt.Metadata.Version)
+}
+
+// TestLocateChart_HelmRepoURL checks that -version downloads the chart from the repository set by -helm-repo-url or,
+// as a fallback, CONSUL_K8S_HELM_REPO_URL.
+func TestLocateChart_HelmRepoURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	// Serve a repository with version 0.2.0 of the chart.
+	metadata := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.2.0"}
+	archive, err := chartutil.Save(&chart.Chart{Metadata: metadata}, dir)
+	require.NoError(t, err)
+	index := repo.NewIndexFile()
+	require.NoError(t, index.MustAdd(metadata, filepath.Base(archive), server.URL, ""))
+	require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0644))
+
+	settings := helmCLI.New()
+	settings.RepositoryCache = filepath.Join(dir, "cache")
+	settings.RepositoryConfig = filepath.Join(dir, "repositories.yaml")
+
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-version", "0.2.0", "-helm-repo-url", server.URL}))
+	chrt, err := c.LocateChart(settings)
+	require.NoError(t, err)
+	require.Equal(t, "0.2.0", chrt.Metadata.Version)
+
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-version", "0.3.0", "-helm-repo-url", server.URL}))
+	_, err = c.LocateChart(settings)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf(`error downloading version "0.3.0" of the Consul Helm chart from %s`, server.URL))
+
+	// The environment variable is only used if the flag is not set.
+	os.Setenv(envHelmRepoURL, server.URL)
+	defer os.Unsetenv(envHelmRepoURL)
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-version", "0.2.0"}))
+	require.Equal(t, server.URL, c.flagHelmRepoURL)
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-helm-repo-url", "https://mirror.example.com/consul"}))
+	require.Equal(t, "https://mirror.example.com/consul", c.flagHelmRepoURL)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-helm-repo-url", "mirror.example.com"})
+	require.EqualError(t, err, `-helm-repo-url: invalid Helm repository URL "mirror.example.com", it must be an http or https URL`)
+}
+
+// TestLocateChart_CAFile checks that -version downloads the chart from an HTTPS repository with the -ca-file CA
+// trusted, both for the repository's index and for the chart archive.
+func TestLocateChart_CAFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm-repo")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	server := httptest.NewTLSServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	metadata := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.2.0"}
+	archive, err := chartutil.Save(&chart.Chart{Metadata: metadata}, dir)
+	require.NoError(t, err)
+	index := repo.NewIndexFile()
+	require.NoError(t, index.MustAdd(metadata, filepath.Base(archive), server.URL, ""))
+	require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0644))
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, caCert, 0644))
+
+	settings := helmCLI.New()
+	settings.RepositoryCache = filepath.Join(dir, "cache")
+	settings.RepositoryConfig = filepath.Join(dir, "repositories.yaml")
+
+	// Without the CA the download fails since the server's certificate is self-signed.
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-version", "0.2.0", "-helm-repo-url", server.URL}))
+	_, err = c.LocateChart(settings)
+	require.Error(t, err)
+
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-version", "0.2.0", "-helm-repo-url", server.URL, "-ca-file", caFile}))
+	chrt, err := c.LocateChart(settings)
+	require.NoError(t, err)
+	require.Equal(t, "0.2.0", chrt.Metadata.Version)
+}
+
+// TestLocateChart_Verify checks that with -verify the downloaded chart is only used if its provenance file is signed
+// by a key of -keyring and matches the chart.
+func TestLocateChart_Verify(t *testing.T) {
+	cases := map[string]struct {
+		unsigned bool
+		tampered bool
+		expErr   string
+	}{
+		"signed":   {},
+		"unsigned": {unsigned: true, expErr: "failed to fetch provenance"},
+		"tampered": {tampered: true, expErr: "sha256 sum does not match"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "helm-repo")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+			defer server.Close()
+
+			metadata := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.2.0"}
+			archive, err := chartutil.Save(&chart.Chart{Metadata: metadata}, dir)
+			require.NoError(t, err)
+			if !tc.unsigned {
+				signer, err := provenance.NewFromFiles("fixtures/provenance/helm-test-key.secret",
+					"fixtures/provenance/helm-test-key.pub")
+				require.NoError(t, err)
+				prov, err := signer.ClearSign(archive)
+				require.NoError(t, err)
+				require.NoError(t, ioutil.WriteFile(archive+".prov", []byte(prov), 0644))
+			}
+			if tc.tampered {
+				tampered := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.2.0",
+					Description: "tampered"}
+				_, err := chartutil.Save(&chart.Chart{Metadata: tampered}, dir)
+				require.NoError(t, err)
+			}
+			index := repo.NewIndexFile()
+			require.NoError(t, index.MustAdd(metadata, filepath.Base(archive), server.URL, ""))
+			require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0644))
+
+			settings := helmCLI.New()
+			settings.RepositoryCache = filepath.Join(dir, "cache")
+			settings.RepositoryConfig = filepath.Join(dir, "repositories.yaml")
+
+			c := getInitializedCommand(t)
+			require.NoError(t, c.validateFlags([]string{"-version", "0.2.0", "-helm-repo-url", server.URL, "-verify",
+				"-keyring", "fixtures/provenance/helm-test-key.pub"}))
+			chrt, err := c.LocateChart(settings)
+			if tc.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "0.2.0", chrt.Metadata.Version)
+		})
+	}
+}
+
+// TestValuesSchema checks that a custom schema set by -values-schema replaces the chart's schema, and that a schema
+// that isn't valid is rejected.
+func TestValuesSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values-schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The schema allows the chart's top-level values but no others.
+	chrt, err := loadChart()
+	require.NoError(t, err)
+	properties := map[string]interface{}{}
+	for key := range chrt.Values {
+		properties[key] = map[string]interface{}{}
+	}
+	schema, err := json.Marshal(map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	})
+	require.NoError(t, err)
+	schemaFile := filepath.Join(dir, "values.schema.json")
+	require.NoError(t, ioutil.WriteFile(schemaFile, schema, 0600))
+
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-values-schema", schemaFile}))
+	require.NoError(t, c.validateValues(chrt, map[string]interface{}{
+		"server": map[string]interface{}{"replicas": 1},
+	}))
+	require.Equal(t, schema, chrt.Schema)
+
+	err = c.validateValues(chrt, map[string]interface{}{"unknownKey": true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "values don't match the schema of -values-schema")
+	require.Contains(t, err.Error(), "Additional property unknownKey is not allowed")
+
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalidFile, []byte(`{"type": 1}`), 0600))
+	notJSONFile := filepath.Join(dir, "not-json.json")
+	require.NoError(t, ioutil.WriteFile(notJSONFile, []byte(`type: object`), 0600))
+	invalid := map[string]string{
+		invalidFile:                     "is not a valid JSON schema",
+		notJSONFile:                     "is not a valid JSON schema",
+		filepath.Join(dir, "none.json"): "does not exist",
+	}
+	for file, expErr := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags([]string{"-values-schema", file})
+		require.Error(t, err, file)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+// TestStorageClass checks that a missing storage class set by server.storageClass is reported and that the storage
+// class is created when requested.
+func TestStorageClass(t *testing.T) {
+	chrt := embeddedChart(t)
+	require.Equal(t, "", effectiveStorageClass(chrt, map[string]interface{}{}))
+	storageClass := effectiveStorageClass(chrt, map[string]interface{}{
+		"server": map[string]interface{}{"storageClass": "fast"},
+	})
+	require.Equal(t, "fast", storageClass)
+
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-create-storage-class", "-storage-class-provisioner", "ebs.csi.aws.com",
+		"-storage-class-parameter", "type=gp3"})
+	require.NoError(t, err)
+	c.kubernetes = fake.NewSimpleClientset()
+	c.Ctx = context.Background()
+
+	err = c.checkStorageClass("fast")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `storage class "fast" set by server.storageClass does not exist`)
+
+	require.NoError(t, c.ensureStorageClass("fast", c.flagStorageClassProvisioner, c.flagStorageClassParameters))
+	class, err := c.kubernetes.StorageV1().StorageClasses().Get(context.Background(), "fast", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "ebs.csi.aws.com", class.Provisioner)
+	require.Equal(t, map[string]string{"type": "gp3"}, class.Parameters)
+	require.NoError(t, c.checkStorageClass("fast"))
+
+	// An existing storage class is left as is.
+	require.NoError(t, c.ensureStorageClass("fast", "kubernetes.io/no-provisioner", nil))
+	class, err = c.kubernetes.StorageV1().StorageClasses().Get(context.Background(), "fast", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "ebs.csi.aws.com", class.Provisioner)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-create-storage-class"})
+	require.EqualError(t, err, "-create-storage-class requires -storage-class-provisioner")
+}
+
+// TestServiceAccountAnnotations checks that the service account annotation flags set the chart's serviceAccount values
+// and are kept apart from the pod annotations.
+func TestServiceAccountAnnotations(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{
+		"-server-service-account-annotations", "eks.amazonaws.com/role-arn=arn:aws:iam::123456789012:role/consul-server",
+		"-client-service-account-annotations", "iam.gke.io/gcp-service-account=consul@project.iam.gserviceaccount.com",
+		"-server-annotations", "example.com/pod=true",
+	})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"annotations": "example.com/pod: \"true\"\n",
+			"serviceAccount": map[string]interface{}{
+				"annotations": "eks.amazonaws.com/role-arn: arn:aws:iam::123456789012:role/consul-server\n",
+			},
+		},
+		"client": map[string]interface{}{
+			"serviceAccount": map[string]interface{}{
+				"annotations": "iam.gke.io/gcp-service-account: consul@project.iam.gserviceaccount.com\n",
+			},
+		},
+	}, vals)
+
+	c = getInitializedCommand(t)
+	err = c.validateFlags([]string{"-server-service-account-annotations", "bad key=value"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `-server-service-account-annotations: invalid annotation key "bad key"`)
+}
+
+// TestMarshalValues checks that the values are marshalled with sorted keys at every level and that identical flags
+// produce byte-identical YAML.
+func TestMarshalValues(t *testing.T) {
+	out, err := marshalValues(map[string]interface{}{
+		"server": map[string]interface{}{
+			"replicas": 3,
+			"extraConfig": map[string]interface{}{
+				"z": "last",
+				"a": "first",
+			},
+		},
+		"global": map[string]interface{}{
+			"tls": map[string]interface{}{"enabled": true},
+			"acls": map[string]interface{}{
+				"manageSystemACLs": true,
+			},
+		},
+		"client": map[string]interface{}{
+			"join": []interface{}{"c", "a", "b"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `client:
+  join:
+  - c
+  - a
+  - b
+global:
+  acls:
+    manageSystemACLs: true
+  tls:
+    enabled: true
+server:
+  extraConfig:
+    a: first
+    z: last
+  replicas: 3
+`, string(out))
+
+	args := []string{
+		"-preset", PresetSecure,
+		"-set", "server.extraConfig.b=2", "-set", "server.extraConfig.a=1",
+		"-server-annotations", "b.example.com/x=1", "-server-annotations", "a.example.com/x=2",
+		"-client-env", "B=1", "-client-env", "A=2",
+		"-client-resources", "mem=100Mi,cpu=100m",
+		"-topology-spread",
+	}
+	var first []byte
+	for i := 0; i < 20; i++ {
+		c := getInitializedCommand(t)
+		require.NoError(t, c.validateFlags(args))
+		vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+		require.NoError(t, err)
+		out, err := marshalValues(vals)
+		require.NoError(t, err)
+		if first == nil {
+			first = out
+			continue
+		}
+		require.Equal(t, string(first), string(out))
+	}
+}
+
+// TestEffectiveDatacenter checks that the datacenter defaults to the chart's and that invalid names are rejected.
+func TestEffectiveDatacenter(t *testing.T) {
+	chrt := embeddedChart(t)
+	datacenter, err := effectiveDatacenter(chrt, map[string]interface{}{})
+	require.NoError(t, err)
+	require.Equal(t, "dc1", datacenter)
+
+	datacenter, err = effectiveDatacenter(chrt, map[string]interface{}{
+		"global": map[string]interface{}{"datacenter": "us_east-1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "us_east-1", datacenter)
+
+	for _, name := range []string{"us.east", "dc 1", ""} {
+		_, err := effectiveDatacenter(chrt, map[string]interface{}{
+			"global": map[string]interface{}{"datacenter": name},
+		})
+		require.EqualError(t, err, fmt.Sprintf("global.datacenter %q is invalid: it may only contain alphanumeric "+
+			"characters, underscores and dashes", name))
+	}
+}
+
+// TestRun_InvalidDatacenter checks that an install with an invalid datacenter fails before anything is installed.
+func TestRun_InvalidDatacenter(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.kubernetes = newSupportedClientset()
+	c.Ctx = context.Background()
+
+	code := c.Run([]string{"-set", "global.datacenter=dc.1", "-auto-approve"})
+	require.Equal(t, exitCodeError, code)
+
+	// The same dry run with a valid datacenter succeeds.
+	c = getInitializedCommand(t)
+	c.kubernetes = newSupportedClientset()
+	c.Ctx = context.Background()
+	code = c.Run([]string{"-set", "global.datacenter=dc-1", "-auto-approve", "-dry-run"})
+	require.Equal(t, exitCodeSuccess, code)
+}
+
+// TestFederationRole checks the detection of whether the datacenter is a federation primary or secondary.
+func TestFederationRole(t *testing.T) {
+	cases := map[string]struct {
+		vals       string
+		datacenter string
+		expRole    string
+		expErr     string
+	}{
+		"federation disabled": {
+			vals:       "",
+			datacenter: "dc1",
+			expRole:    "",
+		},
+		"primary": {
+			vals: `
+global:
+  federation:
+    enabled: true
+    createFederationSecret: true`,
+			datacenter: "dc1",
+			expRole:    "federation primary",
+		},
+		"primary with primary_datacenter set to itself": {
+			vals: `
+global:
+  federation:
+    enabled: true
+server:
+  extraConfig: '{"primary_datacenter": "dc1"}'`,
+			datacenter: "dc1",
+			expRole:    "federation primary",
+		},
+		"secondary": {
+			vals: `
+global:
+  federation:
+    enabled: true
+server:
+  extraConfig: '{"primary_datacenter": "dc1", "primary_gateways": ["1.2.3.4:443"]}'`,
+			datacenter: "dc2",
+			expRole:    "federation secondary of dc1",
+		},
+		"secondary creating the federation secret": {
+			vals: `
+global:
+  federation:
+    enabled: true
+    createFederationSecret: true
+server:
+  extraConfig: '{"primary_datacenter": "dc1"}'`,
+			datacenter: "dc2",
+			expErr:     `global.federation.createFederationSecret is only supported in the primary datacenter, but server.extraConfig sets the primary datacenter to "dc1" instead of "dc2"`,
+		},
+		"invalid extraConfig": {
+			vals: `
+global:
+  federation:
+    enabled: true
+server:
+  extraConfig: 'not json'`,
+			datacenter: "dc1",
+			expErr:     "server.extraConfig is not valid JSON",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			vals := convert(tc.vals)
+			if vals == nil {
+				vals = map[string]interface{}{}
+			}
+			role, err := federationRole(embeddedChart(t), vals, tc.datacenter)
+			if tc.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expRole, role)
+		})
+	}
+}
+
+// TestCheckExistingPrimary checks that installing a federation primary fails if Consul servers reachable in any
+// namespace belong to another primary datacenter.
+func TestCheckExistingPrimary(t *testing.T) {
+	unreachable := peersResponse{err: errors.New("services \"consul-server\" not found")}
+	cases := map[string]struct {
+		https      peersResponse
+		http       peersResponse
+		token      string
+		datacenter string
+		expErr     string
+	}{
+		"no servers": {
+			https:      unreachable,
+			http:       unreachable,
+			datacenter: "dc1",
+		},
+		"same primary over https": {
+			https:      peersResponse{body: `{"Config": {"Datacenter": "dc1", "PrimaryDatacenter": "dc1"}}`},
+			http:       unreachable,
+			datacenter: "dc1",
+		},
+		"other primary over http": {
+			https:      unreachable,
+			http:       peersResponse{body: `{"Config": {"Datacenter": "dc1", "PrimaryDatacenter": "dc1"}}`},
+			datacenter: "dc2",
+			expErr:     `the Consul servers already running in namespace "other" belong to primary datacenter "dc1", so installing "dc2" as a federation primary would create a second primary`,
+		},
+		"secondary of another primary": {
+			https:      peersResponse{body: `{"Config": {"Datacenter": "dc2", "PrimaryDatacenter": "dc1"}}`},
+			datacenter: "dc2",
+			expErr:     `belong to primary datacenter "dc1"`,
+		},
+		"datacenter without primary datacenter": {
+			https:      peersResponse{body: `{"Config": {"Datacenter": "dc1"}}`},
+			datacenter: "dc1",
+		},
+		"with the bootstrap token": {
+			https:      peersResponse{body: `{"Config": {"Datacenter": "dc1", "PrimaryDatacenter": "dc1"}}`},
+			token:      "bootstrap-token",
+			datacenter: "dc1",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			objects := []runtime.Object{consulServerService("other")}
+			if tc.token != "" {
+				objects = append(objects, &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: "other"},
+					Data:       map[string][]byte{"token": []byte(tc.token)},
+				})
+			}
+			c := getInitializedCommand(t)
+			c.kubernetes = fake.NewSimpleClientset(objects...)
+			c.proxyClient = serverProxyClient(t, func(req *http.Request) peersResponse {
+				// The token must not end up in the URL, which is logged by the API server and proxies.
+				require.Empty(t, req.URL.RawQuery)
+				require.Equal(t, tc.token, req.Header.Get("X-Consul-Token"))
+				switch req.URL.Path {
+				case "/api/v1/namespaces/other/services/https:consul-server:8501/proxy/v1/agent/self":
+					return tc.https
+				case "/api/v1/namespaces/other/services/http:consul-server:8500/proxy/v1/agent/self":
+					return tc.http
+				}
+				t.Fatalf("unexpected request to %s", req.URL.Path)
+				return peersResponse{}
+			})
+
+			err := c.checkExistingPrimary(context.Background(), tc.datacenter)
+			if tc.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestRun_ExistingPrimary checks that installing a federation primary next to the servers of another primary
+// datacenter fails before the pre-install checks refuse or uninstall the existing installation.
+func TestRun_ExistingPrimary(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.Ctx = context.Background()
+	c.kubernetes = newSupportedClientset(consulServerService("consul"))
+	c.proxyClient = serverProxyClient(t, func(*http.Request) peersResponse {
+		return peersResponse{body: `{"Config": {"Datacenter": "dc1", "PrimaryDatacenter": "dc1"}}`}
+	})
+	c.checkForInstallations = func(*helmCLI.EnvSettings, action.DebugLog) (string, string, error) {
+		t.Fatal("the existing primary must be detected before the pre-install checks")
+		return "", "", nil
+	}
+
+	exitCode := c.Run([]string{
+		"-auto-approve", "-dry-run", "-kubeconfig", "/nonexistent/kubeconfig", "-force-reinstall",
+		"-set", "global.federation.enabled=true", "-set", "global.datacenter=dc2",
+	})
+	require.Equal(t, exitCodePreflight, exitCode)
+}
+
+// consulServerService returns the server service of a Consul installation in namespace.
+func consulServerService(namespace string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "consul-server",
+			Namespace: namespace,
+			Labels:    map[string]string{"app": "consul", "component": "server"},
+		},
+	}
+}
+
+// serverProxyClient returns a REST client that answers the requests to the service proxy with respond.
+func serverProxyClient(t *testing.T, respond func(*http.Request) peersResponse) *restfake.RESTClient {
+	t.Helper()
+	return &restfake.RESTClient{
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		GroupVersion:         v1.SchemeGroupVersion,
+		VersionedAPIPath:     "/api/v1",
+		Client: restfake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			resp := respond(req)
+			if resp.err != nil {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: ioutil.NopCloser(strings.NewReader(resp.err.Error()))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(resp.body))}, nil
+		}),
+	}
+}
+
+// TestSecurityAdvice checks the security features reported as disabled compared to the secure preset.
+func TestSecurityAdvice(t *testing.T) {
+	cases := map[string]struct {
+		args     []string
+		expected []string
+	}{
+		"demo preset": {
+			args:     []string{"-preset", PresetDemo},
+			expected: []string{"ACLs disabled", "TLS disabled", "gossip encryption disabled"},
+		},
+		"secure preset": {
+			args:     []string{"-preset", PresetSecure},
+			expected: nil,
+		},
+		"TLS without auto-encrypt and a gossip key secret": {
+			args: []string{"-set", "global.tls.enabled=true", "-set", "global.acls.manageSystemACLs=true",
+				"-set", "global.gossipEncryption.secretName=gossip"},
+			expected: []string{"TLS auto-encrypt disabled"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			require.NoError(t, c.validateFlags(tc.args))
+			vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expected, securityAdvice(embeddedChart(t), vals))
+		})
+	}
+}
+
+// TestAnnotations checks that -server-annotations and -client-annotations produce the chart's annotations values.
+func TestAnnotations(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{
+		"-server-annotations", "vault.hashicorp.com/agent-inject=true",
+		"-server-annotations", "prometheus.io/port=8500",
+		"-client-annotations", "example.com/owner=team a",
+	})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"annotations": "prometheus.io/port: \"8500\"\nvault.hashicorp.com/agent-inject: \"true\"\n",
+		},
+		"client": map[string]interface{}{
+			"annotations": "example.com/owner: team a\n",
+		},
+	}, vals)
+
+	for _, key := range []string{"-leading-dash", "example.com/", "a/b/c", "has space"} {
+		c := getInitializedCommand(t)
+		err := c.validateFlags([]string{"-client-annotations", key + "=value"})
+		require.Error(t, err, key)
+		require.Contains(t, err.Error(), fmt.Sprintf("-client-annotations: invalid annotation key %q", key))
+	}
+}
+
+// TestTopologySpread checks the server topology spread constraints set by -topology-spread.
+func TestTopologySpread(t *testing.T) {
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-topology-spread", "-topology-max-skew", "2", "-topology-when-unsatisfiable", "ScheduleAnyway"})
+	require.NoError(t, err)
+
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"server": map[string]interface{}{
+			"topologySpreadConstraints": `- maxSkew: 2
+  topologyKey: topology.kubernetes.io/zone
+  whenUnsatisfiable: ScheduleAnyway
+  labelSelector:
+    matchLabels:
+      app: {{ template "consul.name" . }}
+      release: "{{ .Release.Name }}"
+      component: server
+`,
+		},
+	}, vals)
+
+	invalid := map[string][]string{
+		"-topology-max-skew must be at least 1": {"-topology-spread", "-topology-max-skew", "0"},
+		"-topology-when-unsatisfiable must be DoNotSchedule or ScheduleAnyway": {"-topology-spread",
+			"-topology-when-unsatisfiable", "Sometimes"},
+		"require -topology-spread": {"-topology-max-skew", "2"},
+	}
+	for expErr, args := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags(args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+// TestPruneReleaseHistory checks that only the newest entries of the release history remain after pruning, and
+// that the bound is kept by subsequent releases.
+func TestPruneReleaseHistory(t *testing.T) {
+	releases := storage.Init(driver.NewMemory())
+	for version := 1; version <= 5; version++ {
+		require.NoError(t, releases.Create(&release.Release{
+			Name:      common.DefaultReleaseName,
+			Namespace: "default",
+			Version:   version,
+			Info:      &release.Info{Status: release.StatusUninstalled},
+		}))
+	}
+	// Releases with other names are left alone.
+	require.NoError(t, releases.Create(&release.Release{
+		Name:      "other",
+		Namespace: "default",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+	}))
+
+	// Make space for the new release, as Run does with -history-max=3.
+	require.NoError(t, pruneReleaseHistory(releases, common.DefaultReleaseName, 2))
+	releases.MaxHistory = 3
+	require.NoError(t, releases.Create(&release.Release{
+		Name:      common.DefaultReleaseName,
+		Namespace: "default",
+		Version:   6,
+		Info:      &release.Info{Status: release.StatusDeployed},
+	}))
+
+	history, err := releases.History(common.DefaultReleaseName)
+	require.NoError(t, err)
+	var versions []int
+	for _, rel := range history {
+		versions = append(versions, rel.Version)
+	}
+	require.ElementsMatch(t, []int{4, 5, 6}, versions)
+
+	other, err := releases.History("other")
+	require.NoError(t, err)
+	require.Len(t, other, 1)
+
+	// A release without history is not an error.
+	require.NoError(t, pruneReleaseHistory(releases, "missing", 3))
+}
+
+// TestValidatePEMBundle checks that -ca-file must contain a PEM-encoded certificate.
+func TestValidatePEMBundle(t *testing.T) {
+	notPEM, err := ioutil.TempFile("", "ca")
+	require.NoError(t, err)
+	defer os.Remove(notPEM.Name())
+	_, err = notPEM.WriteString("not a certificate")
+	require.NoError(t, err)
+	require.NoError(t, notPEM.Close())
+
+	err = validatePEMBundle(notPEM.Name())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not contain any PEM-encoded certificates")
+
+	err = validatePEMBundle("does_not_exist.pem")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to read -ca-file")
+}
+
+// getInitializedCommand sets up a command struct for tests.
+// newSupportedClientset returns a fake clientset of a cluster whose Kubernetes version the chart supports.
+func newSupportedClientset(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &k8sversion.Info{GitVersion: "v1.22.0"}
+	return client
+}
+
+// embeddedChart returns the chart embedded in the CLI.
+func embeddedChart(t *testing.T) *chart.Chart {
+	t.Helper()
+	chrt, err := loadChart()
+	require.NoError(t, err)
+	return chrt
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
+
+// TestReleaseDescription checks that -release-description is set on the install action and recorded on the release.
+func TestReleaseDescription(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse([]string{"-release-description", "CONSUL-123 owned by platform"}))
+
+	actionConfig := &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          t.Logf,
+	}
+	install := c.newInstallAction(actionConfig)
+	require.Equal(t, "CONSUL-123 owned by platform", install.Description)
+
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.1.0"},
+	}
+	_, err := install.Run(chrt, map[string]interface{}{})
+	require.NoError(t, err)
+	rel, err := actionConfig.Releases.Last(common.DefaultReleaseName)
+	require.NoError(t, err)
+	require.Equal(t, "CONSUL-123 owned by platform", rel.Info.Description)
+}
+
+// TestRun_Confirmation checks that the installation only proceeds past the confirmation prompt when it is confirmed.
+func TestRun_Confirmation(t *testing.T) {
+	for answer, expCode := range map[string]int{"": exitCodeAborted, "n": exitCodeAborted, " Yes ": exitCodeHelm} {
+		t.Run(fmt.Sprintf("answer=%q", answer), func(t *testing.T) {
+			c := getInitializedCommand(t)
+			c.kubernetes = newSupportedClientset()
+			c.Ctx = context.Background()
+			// Mark the command as initialized so that Run keeps the UI.
+			c.once.Do(func() {})
+			c.UI = &recordingUI{UI: c.UI, answer: answer}
+
+			// The installation fails setting up Helm, after the confirmation, since the kubeconfig doesn't exist.
+			require.Equal(t, expCode, c.Run([]string{"-kubeconfig", "/nonexistent/kubeconfig"}))
+		})
+	}
+}
+
+// TestOutputNotes checks that the notes of the installed release are output unless -no-notes is set.
+func TestOutputNotes(t *testing.T) {
+	for _, noNotes := range []bool{false, true} {
+		t.Run(fmt.Sprintf("no-notes=%t", noNotes), func(t *testing.T) {
+			c := getInitializedCommand(t)
+			if noNotes {
+				require.NoError(t, c.set.Parse([]string{"-no-notes"}))
+			}
+			ui := &recordingUI{UI: c.UI}
+			c.UI = ui
+
+			actionConfig := &action.Configuration{
+				Releases:     storage.Init(driver.NewMemory()),
+				KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          t.Logf,
+			}
+			chrt := &chart.Chart{
+				Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.1.0"},
+				Templates: []*chart.File{
+					{Name: "templates/NOTES.txt", Data: []byte("Thank you for installing {{ .Chart.Name }}, 100% done.\n")},
+				},
+			}
+			rel, err := c.newInstallAction(actionConfig).Run(chrt, map[string]interface{}{})
+			require.NoError(t, err)
+
+			c.outputNotes(rel)
+			if noNotes {
+				require.Empty(t, ui.messages)
+			} else {
+				require.Equal(t, []string{"Notes", "Thank you for installing consul, 100% done."}, ui.messages)
+			}
+		})
+	}
+}
+
+// recordingUI records the messages that are output and answers every input with answer.
+type recordingUI struct {
+	terminal.UI
+	messages []string
+	answer   string
+}
+
+func (u *recordingUI) Input(*terminal.Input) (string, error) {
+	return u.answer, nil
+}
+
+func (u *recordingUI) Output(msg string, raw ...interface{}) {
+	msg, _, _ = terminal.Interpret(msg, raw...)
+	u.messages = append(u.messages, msg)
+}
+
+// writersUI returns buffers as its stdout and stderr, and outputs messages to stdout unless another writer is given.
+type writersUI struct {
+	terminal.UI
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+func (u *writersUI) Output(msg string, raw ...interface{}) {
+	u.UI.Output(msg, append([]interface{}{terminal.WithWriter(&u.stdout)}, raw...)...)
+}
+
+func (u *writersUI) OutputWriters() (io.Writer, io.Writer, error) {
+	return &u.stdout, &u.stderr, nil
+}
+
+// TestCheckKubernetesVersion checks the Kubernetes version of the cluster against the requirement of the chart.
+func TestCheckKubernetesVersion(t *testing.T) {
+	cases := map[string]string{
+		"v1.16.15":         "Kubernetes v1.16.15 is not supported, the Consul chart requires Kubernetes >=1.17.0-0",
+		"v1.17.0":          "",
+		"v1.21.2-gke.1200": "",
+		"v1.22.0":          "",
+	}
+	for version, expErr := range cases {
+		t.Run(version, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			client := fake.NewSimpleClientset()
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &k8sversion.Info{GitVersion: version}
+			c.kubernetes = client
+
+			err := c.checkKubernetesVersion(embeddedChart(t))
+			if expErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, expErr)
+			}
+		})
+	}
+
+	// The requirement of the chart being installed, e.g. another version set by -version, is checked.
+	c := getInitializedCommand(t)
+	client := fake.NewSimpleClientset()
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &k8sversion.Info{GitVersion: "v1.21.2-gke.1200"}
+	c.kubernetes = client
+	err := c.checkKubernetesVersion(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.2.0", KubeVersion: ">=1.22.0-0"},
+	})
+	require.EqualError(t, err, "Kubernetes v1.21.2-gke.1200 is not supported, the Consul chart requires Kubernetes >=1.22.0-0")
+}
+
+// TestRun_UnsupportedKubernetesVersion checks that an unsupported Kubernetes version fails the pre-install checks,
+// which Helm would fail the installation on anyway, and that it isn't checked with -skip-pre-install-checks.
+func TestRun_UnsupportedKubernetesVersion(t *testing.T) {
+	cases := map[string]struct {
+		args         []string
+		expCode      int
+		expDiscovery bool
+	}{
+		"default":                  {expCode: exitCodePreflight, expDiscovery: true},
+		"-strict":                  {args: []string{"-strict"}, expCode: exitCodePreflight, expDiscovery: true},
+		"-skip-pre-install-checks": {args: []string{"-skip-pre-install-checks"}, expCode: exitCodeSuccess},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			client := fake.NewSimpleClientset()
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &k8sversion.Info{GitVersion: "v1.16.0"}
+			c.kubernetes = client
+			c.Ctx = context.Background()
+
+			args := append([]string{"-auto-approve", "-dry-run", "-kubeconfig", "/nonexistent/kubeconfig"}, tc.args...)
+			require.Equal(t, tc.expCode, c.Run(args))
+			discovered := false
+			for _, action := range client.Actions() {
+				if action.GetResource().Resource == "version" {
+					discovered = true
+				}
+			}
+			require.Equal(t, tc.expDiscovery, discovered)
+		})
+	}
+}
+
+// TestRun_ServerReplicasMismatch checks that a mismatch between server.replicas and server.bootstrapExpect is a
+// warning, and a pre-install check failure with -strict.
+func TestRun_ServerReplicasMismatch(t *testing.T) {
+	cases := map[string]struct {
+		args    []string
+		expCode int
+	}{
+		"default": {expCode: exitCodeSuccess},
+		"-strict": {args: []string{"-strict"}, expCode: exitCodePreflight},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			c.kubernetes = newSupportedClientset()
+			c.Ctx = context.Background()
+
+			args := append([]string{"-auto-approve", "-dry-run", "-kubeconfig", "/nonexistent/kubeconfig",
+				"-set", "server.replicas=3", "-set", "server.bootstrapExpect=5"}, tc.args...)
+			require.Equal(t, tc.expCode, c.Run(args))
+		})
+	}
+}
+
+// TestPreInstallChecks_Skip checks that leftover PVCs and secrets fail the pre-install checks unless
+// -skip-pre-install-checks is set.
+func TestPreInstallChecks_Skip(t *testing.T) {
+	leftovers := []runtime.Object{
+		&v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-default-consul-server-0", Namespace: "default"},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: "default"},
+		},
+	}
+	// Point the Helm settings at a kubeconfig that doesn't exist so that no existing installation is found.
+	settings := helmCLI.New()
+	settings.KubeConfig = "/nonexistent/kubeconfig"
+	logger := func(string, ...interface{}) {}
+
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset(leftovers...)
+	err := c.preInstallChecks(settings, logger)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "found PVCs from previous installations")
+
+	c = getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset(leftovers...)
+	require.NoError(t, c.set.Parse([]string{"-skip-pre-install-checks"}))
+	require.NoError(t, c.preInstallChecks(settings, logger))
+}
+
+// TestRun_DebugLogs checks that a dry run logs each step at debug level only with -log-level debug.
+func TestRun_DebugLogs(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		t.Run(fmt.Sprintf("debug=%t", debug), func(t *testing.T) {
+			var buf bytes.Buffer
+			c := getInitializedCommand(t)
+			c.Log = hclog.New(&hclog.LoggerOptions{
+				Name:   "cli",
+				Level:  hclog.Info,
+				Output: &buf,
+			})
+			c.kubernetes = newSupportedClientset()
+			c.Ctx = context.Background()
+
+			args := []string{"-auto-approve", "-dry-run", "-kubeconfig", "/nonexistent/kubeconfig"}
+			if debug {
+				args = append(args, "-log-level", "debug")
+			}
+			require.Equal(t, exitCodeSuccess, c.Run(args))
+
+			logs := buf.String()
+			if !debug {
+				require.Empty(t, logs)
+				return
+			}
+			require.Contains(t, logs, "[DEBUG] install: running pre-install checks: namespace=consul")
+			require.Contains(t, logs, "[DEBUG] install: merged values: preset=\"\" value_files=0 datacenter=dc1")
+			require.Contains(t, logs, "[DEBUG] install: dry run complete")
+		})
+	}
+}
+
+// TestPreInstallChecks_ForceReinstall checks that an existing installation is uninstalled by the pre-install checks,
+// and so before installing, only with -force-reinstall.
+func TestPreInstallChecks_ForceReinstall(t *testing.T) {
+	settings := helmCLI.New()
+	logger := func(string, ...interface{}) {}
+	checkForInstallations := func(*helmCLI.EnvSettings, action.DebugLog) (string, string, error) {
+		return "consul", "consul-old", nil
+	}
+
+	leftovers := func(namespace string) []runtime.Object {
+		return []runtime.Object{
+			&v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data-consul-server-0", Namespace: namespace}},
+			&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "consul-bootstrap-acl-token", Namespace: namespace}},
+		}
+	}
+
+	cases := map[string]struct {
+		args         []string
+		objects      []runtime.Object
+		expUninstall bool
+		expErr       string
+	}{
+		"without -force-reinstall": {
+			args:   []string{"-auto-approve"},
+			expErr: "existing Consul installation found (name=consul, namespace=consul-old)",
+		},
+		"with -force-reinstall": {
+			args:         []string{"-auto-approve", "-force-reinstall"},
+			expUninstall: true,
+		},
+		"dry run": {
+			args: []string{"-auto-approve", "-force-reinstall", "-dry-run"},
+			// The PVCs and secrets of the existing installation would be deleted by the uninstall.
+			objects: leftovers("consul-old"),
+		},
+		"dry run with leftovers of another installation": {
+			args:    []string{"-auto-approve", "-force-reinstall", "-dry-run"},
+			objects: leftovers("default"),
+			expErr:  "found PVCs from previous installations (default/data-consul-server-0)",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			c.kubernetes = fake.NewSimpleClientset(tc.objects...)
+			require.NoError(t, c.validateFlags(tc.args))
+			c.checkForInstallations = checkForInstallations
+			var uninstalled []string
+			c.uninstall = func(name, namespace string) error {
+				uninstalled = append(uninstalled, namespace+"/"+name)
+				return nil
+			}
+
+			err := c.preInstallChecks(settings, logger)
+			if tc.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.expErr)
+			} else {
+				require.NoError(t, err)
+			}
+			if tc.expUninstall {
+				require.Equal(t, []string{"consul-old/consul"}, uninstalled)
+			} else {
+				require.Empty(t, uninstalled)
+			}
+		})
+	}
+
+	c := getInitializedCommand(t)
+	err := c.validateFlags([]string{"-force-reinstall", "-skip-pre-install-checks"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "-force-reinstall cannot be used with -skip-pre-install-checks")
+}
+
+// TestRunUninstall_UI checks that the uninstall run by -force-reinstall outputs to the UI of the install, and keeps it.
+func TestRunUninstall_UI(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.Ctx = context.Background()
+	ui := &stderrUI{UI: &recordingUI{UI: c.UI}}
+	c.UI = ui
+	require.NoError(t, c.validateFlags([]string{"-auto-approve", "-force-reinstall", "-kubeconfig", "/nonexistent/kubeconfig"}))
+
+	// The uninstall fails since the kubeconfig doesn't exist.
+	require.Error(t, c.runUninstall("consul", "consul-old"))
+	require.Same(t, ui, c.UI)
+	require.NotEmpty(t, ui.UI.(*recordingUI).messages)
+}
+
+// TestImagePullSecrets checks that -image-pull-secret references existing secrets and that -create-pull-secret creates
+// a docker-registry secret that is referenced too.
+func TestImagePullSecrets(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-image-pull-secret", "registry-a", "-image-pull-secret", "registry-b"}))
+	vals, err := c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{
+			"imagePullSecrets": []interface{}{
+				map[string]interface{}{"name": "registry-a"},
+				map[string]interface{}{"name": "registry-b"},
+			},
+		},
+	}, vals)
+
+	c = getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-image-pull-secret", "registry-a", "-create-pull-secret", "registry-new",
+		"-registry-server", "registry.example.com", "-registry-username", "user", "-registry-password", "pass"}))
+	vals, err = c.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{
+			"imagePullSecrets": []interface{}{
+				map[string]interface{}{"name": "registry-a"},
+				map[string]interface{}{"name": "registry-new"},
+			},
+		},
+	}, vals)
+
+	c.kubernetes = fake.NewSimpleClientset()
+	c.Ctx = context.Background()
+	require.NoError(t, c.ensurePullSecret("registry-new", "consul"))
+	secret, err := c.kubernetes.CoreV1().Secrets("consul").Get(context.Background(), "registry-new", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, v1.SecretTypeDockerConfigJson, secret.Type)
+	require.JSONEq(t, `{"auths":{"registry.example.com":{"username":"user","password":"pass","auth":"dXNlcjpwYXNz"}}}`,
+		string(secret.Data[v1.DockerConfigJsonKey]))
+	_, err = c.kubernetes.CoreV1().Namespaces().Get(context.Background(), "consul", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// An existing secret is left as is.
+	c.flagRegistryPassword = "other"
+	require.NoError(t, c.ensurePullSecret("registry-new", "consul"))
+	secret, err = c.kubernetes.CoreV1().Secrets("consul").Get(context.Background(), "registry-new", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(secret.Data[v1.DockerConfigJsonKey]), `"password":"pass"`)
+
+	invalid := map[string][]string{
+		`invalid image pull secret name "Not_Valid"`: {"-image-pull-secret", "Not_Valid"},
+		"-registry-username must be set":             {"-create-pull-secret", "s", "-registry-password", "p"},
+		"-registry-password must be set":             {"-create-pull-secret", "s", "-registry-username", "u"},
+		"-registry-username must not contain ':'": {"-create-pull-secret", "s", "-registry-username", "u:v",
+			"-registry-password", "p"},
+		"-registry-server must be set": {"-create-pull-secret", "s", "-registry-server", "", "-registry-username", "u",
+			"-registry-password", "p"},
+		"require -create-pull-secret": {"-registry-username", "u"},
+	}
+	for expErr, args := range invalid {
+		c := getInitializedCommand(t)
+		err := c.validateFlags(args)
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
 	}
-	c.init()
-	return c
 }
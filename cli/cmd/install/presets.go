@@ -1,6 +1,10 @@
 package install
 
-import "sigs.k8s.io/yaml"
+import (
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
 
 const (
 	PresetDemo   = "demo"
@@ -60,6 +64,25 @@ global:
   name: consul
 `
 
+// Presets returns the pre-configured helm values of every preset, keyed by preset name. The values are parsed
+// anew on each call so callers are free to modify them.
+func Presets() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		PresetDemo:   convert(demo),
+		PresetSecure: convert(secure),
+	}
+}
+
+// PresetNames returns the names of the presets, sorted.
+func PresetNames() []string {
+	var names []string
+	for name := range Presets() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // convert is a helper function that converts a YAML string to a map.
 func convert(s string) map[string]interface{} {
 	var m map[string]interface{}
@@ -0,0 +1,40 @@
+package install
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+// TestPresets_Golden compares the values of every preset against its golden file, so that any change to a preset is
+// deliberate. When a preset changes, copy the .actual file written next to the golden file over it.
+func TestPresets_Golden(t *testing.T) {
+	all := Presets()
+	require.Len(t, all, len(presets), "every preset must be returned by Presets")
+	for name, vals := range all {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, presets[name], vals)
+
+			actual, err := yaml.Marshal(vals)
+			require.NoError(t, err)
+			golden := filepath.Join("fixtures", "presets", name+".golden.yaml")
+			expected, err := ioutil.ReadFile(golden)
+			require.NoError(t, err, "missing golden file for preset %q", name)
+			if string(actual) != string(expected) {
+				require.NoError(t, ioutil.WriteFile(filepath.Join("fixtures", "presets", name+".actual.yaml"), actual, 0644))
+				require.FailNow(t, "preset values changed", "preset %q does not match %s, actual values written to %s.actual.yaml",
+					name, golden, name)
+			}
+		})
+	}
+}
+
+// TestPresets_Copies checks that the values returned by Presets can be modified without affecting the presets.
+func TestPresets_Copies(t *testing.T) {
+	Presets()[PresetDemo]["global"].(map[string]interface{})["name"] = "modified"
+	require.Equal(t, "consul", Presets()[PresetDemo]["global"].(map[string]interface{})["name"])
+	require.Equal(t, "consul", presets[PresetDemo].(map[string]interface{})["global"].(map[string]interface{})["name"])
+}
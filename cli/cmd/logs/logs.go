@@ -0,0 +1,284 @@
+package logs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	flagNameNamespace = "namespace"
+
+	flagNameComponent = "component"
+	defaultComponent  = componentServer
+
+	flagNameFollow = "follow"
+	defaultFollow  = true
+
+	flagNameSince = "since"
+
+	flagNameTail = "tail"
+	defaultTail  = -1
+
+	componentServer          = "server"
+	componentClient          = "client"
+	componentConnectInjector = "connect-injector"
+)
+
+// containers maps each component to the name of the container that runs it, as set by the Helm chart.
+var containers = map[string]string{
+	componentServer:          "consul",
+	componentClient:          "consul",
+	componentConnectInjector: "sidecar-injector",
+}
+
+type Command struct {
+	*common.BaseCommand
+
+	kubernetes kubernetes.Interface
+
+	set *flag.Sets
+
+	flagNamespace string
+	flagComponent string
+	flagFollow    bool
+	flagSince     string
+	flagTail      int
+
+	sinceDuration time.Duration
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage:   "Namespace of the Consul installation.",
+	})
+	f.EnumSingleVar(&flag.EnumSingleVar{
+		Name:    flagNameComponent,
+		Target:  &c.flagComponent,
+		Default: defaultComponent,
+		Values:  []string{componentServer, componentClient, componentConnectInjector},
+		Usage:   "Consul component to print the logs of.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameFollow,
+		Target:  &c.flagFollow,
+		Default: defaultFollow,
+		Usage:   "Keep streaming the logs as they are written.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:   flagNameSince,
+		Target: &c.flagSince,
+		Usage:  "Only print logs newer than this duration, e.g. 5m or 1h. Defaults to all logs.",
+	})
+	f.IntVar(&flag.IntVar{
+		Name:    flagNameTail,
+		Target:  &c.flagTail,
+		Default: defaultTail,
+		Usage:   "Number of recent log lines to print from each pod. Defaults to all lines.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to logs so log lines would be prefixed with logs.
+	c.Log.ResetNamed("logs")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if err := c.validateFlags(); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	pods, err := c.componentPods()
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(pods) == 0 {
+		c.UI.Output("No %s pods found in namespace %q", c.flagComponent, c.flagNamespace, terminal.WithErrorStyle())
+		return 1
+	}
+
+	stdout, _, err := c.UI.OutputWriters()
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if err := c.streamLogs(pods, stdout); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	return 0
+}
+
+// validateFlags checks the flags and parses -since.
+func (c *Command) validateFlags() error {
+	if len(c.set.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	if c.flagSince != "" {
+		duration, err := time.ParseDuration(c.flagSince)
+		if err != nil {
+			return fmt.Errorf("unable to parse -%s: %s", flagNameSince, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("-%s must be positive", flagNameSince)
+		}
+		c.sinceDuration = duration
+	}
+	if c.flagTail < -1 {
+		return fmt.Errorf("-%s must be -1 or greater", flagNameTail)
+	}
+	return nil
+}
+
+// componentPods returns the pods of the -component, sorted by name.
+func (c *Command) componentPods() ([]v1.Pod, error) {
+	selector := fmt.Sprintf("app=%s,component=%s", common.DefaultReleaseName, c.flagComponent)
+	pods, err := c.kubernetes.CoreV1().Pods(c.flagNamespace).List(c.Ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s pods: %s", c.flagComponent, err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	return pods.Items, nil
+}
+
+// streamLogs writes the logs of the pods to w concurrently, prefixing each line with the name of its pod. With
+// -follow, it returns once all streams end, e.g. because the pods are deleted or the command is interrupted.
+func (c *Command) streamLogs(pods []v1.Pod, w io.Writer) error {
+	opts := &v1.PodLogOptions{
+		Container: containers[c.flagComponent],
+		Follow:    c.flagFollow,
+	}
+	if c.sinceDuration > 0 {
+		seconds := int64(c.sinceDuration.Seconds())
+		opts.SinceSeconds = &seconds
+	}
+	if c.flagTail >= 0 {
+		tail := int64(c.flagTail)
+		opts.TailLines = &tail
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errs := make([]error, len(pods))
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod v1.Pod) {
+			defer wg.Done()
+			stream, err := c.kubernetes.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).Stream(c.Ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("error streaming logs of pod %s: %s", pod.Name, err)
+				return
+			}
+			defer stream.Close()
+			scanner := bufio.NewScanner(stream)
+			for scanner.Scan() {
+				mu.Lock()
+				fmt.Fprintf(w, "[%s] %s\n", pod.Name, scanner.Text())
+				mu.Unlock()
+			}
+			if err := scanner.Err(); err != nil && c.Ctx.Err() == nil {
+				errs[i] = fmt.Errorf("error reading logs of pod %s: %s", pod.Name, err)
+			}
+		}(i, pod)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.kubernetes == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s logs [flags]" + "\n" + "Print the logs of the pods of a Consul component." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Print the logs of Consul components."
+}
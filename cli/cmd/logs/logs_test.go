@@ -0,0 +1,111 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestComponentPods creates fake pods of each component and checks that only the pods of the selected component are
+// selected.
+func TestComponentPods(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		pod("consul-server-1", "consul", "server"),
+		pod("consul-server-0", "consul", "server"),
+		pod("consul-abcde", "consul", "client"),
+		pod("consul-connect-injector-webhook-deployment-xyz", "consul", "connect-injector"),
+		pod("consul-server-elsewhere", "other", "server"),
+	)
+
+	cases := map[string][]string{
+		componentServer:          {"consul-server-0", "consul-server-1"},
+		componentClient:          {"consul-abcde"},
+		componentConnectInjector: {"consul-connect-injector-webhook-deployment-xyz"},
+	}
+	for component, expected := range cases {
+		t.Run(component, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			c.kubernetes = client
+			require.NoError(t, c.set.Parse([]string{"-component", component}))
+
+			pods, err := c.componentPods()
+			require.NoError(t, err)
+			var names []string
+			for _, pod := range pods {
+				names = append(names, pod.Name)
+			}
+			require.Equal(t, expected, names)
+		})
+	}
+}
+
+// TestStreamLogs checks that log lines are prefixed with the name of their pod.
+func TestStreamLogs(t *testing.T) {
+	c := getInitializedCommand(t)
+	c.kubernetes = fake.NewSimpleClientset()
+	require.NoError(t, c.set.Parse([]string{"-follow=false", "-tail", "10", "-since", "5m"}))
+	require.NoError(t, c.validateFlags())
+
+	var out bytes.Buffer
+	err := c.streamLogs([]v1.Pod{*pod("consul-server-0", "consul", "server")}, &out)
+	require.NoError(t, err)
+	// The fake clientset returns "fake logs" for any pod.
+	require.Equal(t, "[consul-server-0] fake logs\n", out.String())
+}
+
+func TestValidateFlags(t *testing.T) {
+	cases := map[string][]string{
+		"unable to parse -since":            {"-since", "yesterday"},
+		"-since must be positive":           {"-since", "-5m"},
+		"-tail must be -1 or greater":       {"-tail", "-2"},
+		"should have no non-flag arguments": {"extra"},
+	}
+	for expErr, args := range cases {
+		c := getInitializedCommand(t)
+		require.NoError(t, c.set.Parse(args))
+		err := c.validateFlags()
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+func pod(name, namespace, component string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":       "consul",
+				"component": component,
+			},
+		},
+	}
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
@@ -106,8 +106,11 @@ func (c *Command) init() {
 
 	c.help = c.set.Help()
 
-	// c.Init() calls the embedded BaseCommand's initialization function.
-	c.Init()
+	// c.Init() calls the embedded BaseCommand's initialization function. A UI that is already set, e.g. by install
+	// -force-reinstall running this command, is kept.
+	if c.UI == nil {
+		c.Init()
+	}
 }
 
 func (c *Command) Run(args []string) int {
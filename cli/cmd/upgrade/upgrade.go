@@ -0,0 +1,286 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/cmd/install"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+const (
+	flagNameName = "name"
+
+	flagNameNamespace = "namespace"
+
+	flagNameDryRun = "dry-run"
+	defaultDryRun  = false
+
+	flagNameAutoApprove = "auto-approve"
+	defaultAutoApprove  = false
+
+	flagNameTimeout = "timeout"
+	defaultTimeout  = "10m"
+
+	flagNameWait = "wait"
+	defaultWait  = true
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	set *flag.Sets
+
+	flagName        string
+	flagNamespace   string
+	flagDryRun      bool
+	flagAutoApprove bool
+	flagTimeout     string
+	timeoutDuration time.Duration
+	flagWait        bool
+
+	// values holds the flags shared with the install command that select the chart and set its values, and merges
+	// them with install's logic.
+	values *install.Command
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameName,
+		Target:  &c.flagName,
+		Default: common.DefaultReleaseName,
+		Usage:   "Name of the Helm release to upgrade.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage:   "Namespace of the Consul installation.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameAutoApprove,
+		Target:  &c.flagAutoApprove,
+		Default: defaultAutoApprove,
+		Usage:   "Skip confirmation prompt.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameDryRun,
+		Target:  &c.flagDryRun,
+		Default: defaultDryRun,
+		Usage:   "Display the summary of the upgrade, including the changes to the values, without upgrading.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameTimeout,
+		Target:  &c.flagTimeout,
+		Default: defaultTimeout,
+		Usage:   "Timeout to wait for the upgrade to be ready.",
+	})
+	f.BoolVar(&flag.BoolVar{
+		Name:    flagNameWait,
+		Target:  &c.flagWait,
+		Default: defaultWait,
+		Usage:   "Determines whether to wait for the upgraded resources to be ready before exiting command.",
+	})
+	c.values = &install.Command{BaseCommand: c.BaseCommand}
+	c.values.AddValuesFlags(f)
+	c.values.AddHistoryMaxFlag(f)
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to upgrade so log lines would be prefixed with upgrade.
+	c.Log = c.Log.ResetNamed("upgrade")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.validateFlags(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used by the Helm Go SDK calls.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	// Helm library logs are only useful when debugging, so they are only logged at the debug level.
+	var helmLogger = func(s string, args ...interface{}) {
+		c.Log.Debug(fmt.Sprintf(s, args...))
+	}
+
+	actionConfig := new(action.Configuration)
+	actionConfig, err := common.InitActionConfig(actionConfig, c.flagNamespace, settings, helmLogger)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	rel, err := c.findRelease(actionConfig)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	current := rel.Config
+	if current == nil {
+		current = map[string]interface{}{}
+	}
+	c.values.SetCurrentValues(current)
+	changes, err := c.values.MergeValuesFlagsWithPrecedence(settings)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	proposed := common.MergeMaps(current, changes)
+	diff, err := common.ValuesDiff(current, proposed)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	c.UI.Output("Consul Upgrade Summary", terminal.WithHeaderStyle())
+	c.UI.Output("Installation name: %s", rel.Name, terminal.WithInfoStyle())
+	c.UI.Output("Namespace: %s", rel.Namespace, terminal.WithInfoStyle())
+	c.UI.Output("Current revision: %d", rel.Version, terminal.WithInfoStyle())
+	if len(diff) == 0 {
+		c.UI.Output("Value changes: none", terminal.WithInfoStyle())
+	} else {
+		c.UI.Output("Value changes:\n%s", strings.Join(diff, "\n"), terminal.WithInfoStyle())
+	}
+
+	if c.flagDryRun {
+		c.UI.Output("Dry run complete - upgrade can proceed.", terminal.WithInfoStyle())
+		return 0
+	}
+
+	if !c.flagAutoApprove {
+		confirmed, err := terminal.Confirm(c.UI, "Proceed with upgrade?", false)
+		if err != nil {
+			c.UI.Output(err.Error(), terminal.WithErrorStyle())
+			return 1
+		}
+		if !confirmed {
+			c.UI.Output("Upgrade aborted.", terminal.WithInfoStyle())
+			return 1
+		}
+	}
+
+	c.UI.Output("Running Upgrade", terminal.WithHeaderStyle())
+	chrt, err := c.values.LocateChart(settings)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	upgraded, err := c.upgrade(actionConfig, chrt, proposed)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	c.UI.Output("Consul upgraded in namespace %q to revision %d", upgraded.Namespace, upgraded.Version,
+		terminal.WithSuccessStyle())
+	return 0
+}
+
+// findRelease returns the Consul release to upgrade, or an error if there is no Consul release with the name in the
+// namespace.
+func (c *Command) findRelease(actionConfig *action.Configuration) (*release.Release, error) {
+	rel, err := action.NewGet(actionConfig).Run(c.flagName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("no Consul installation named %q found in namespace %q - run consul-k8s install to "+
+			"install Consul", c.flagName, c.flagNamespace)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting release %q in namespace %q: %s", c.flagName, c.flagNamespace, err)
+	}
+	if rel.Chart == nil || rel.Chart.Metadata == nil || rel.Chart.Metadata.Name != "consul" {
+		return nil, fmt.Errorf("release %q in namespace %q is not a Consul installation", c.flagName, c.flagNamespace)
+	}
+	return rel, nil
+}
+
+// upgrade upgrades the release to chrt with vals.
+func (c *Command) upgrade(actionConfig *action.Configuration, chrt *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
+	upgrade := action.NewUpgrade(actionConfig)
+	upgrade.Namespace = c.flagNamespace
+	upgrade.Wait = c.flagWait
+	upgrade.Timeout = c.timeoutDuration
+	upgrade.MaxHistory = c.values.HistoryMax()
+	rel, err := upgrade.Run(c.flagName, chrt, vals)
+	if err != nil {
+		return nil, fmt.Errorf("error upgrading release %q in namespace %q: %s", c.flagName, c.flagNamespace, err)
+	}
+	return rel, nil
+}
+
+// validateFlags parses args and checks the flags.
+func (c *Command) validateFlags(args []string) error {
+	if err := c.set.Parse(args); err != nil {
+		return err
+	}
+	if len(c.set.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	if err := c.values.ValidateValuesFlags(); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(c.flagTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to parse -%s: %s", flagNameTimeout, err)
+	}
+	c.timeoutDuration = duration
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s upgrade [flags]" + "\n" + "Upgrade a Consul installation to the CLI's chart version, or the version set by -version, and change its values." + "\n\n" +
+		"The values of the installation are kept, and the values set by the flags are merged on top of them." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Upgrade Consul on Kubernetes."
+}
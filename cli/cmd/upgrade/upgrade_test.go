@@ -0,0 +1,219 @@
+package upgrade
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func TestMergeValues_Preset(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-preset", "demo", "-set", "global.name=other"}))
+
+	vals, err := c.values.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, "other", vals["global"].(map[string]interface{})["name"])
+	require.EqualValues(t, 1, vals["server"].(map[string]interface{})["replicas"])
+}
+
+// TestMergeValues_InstallFlags checks that the values are merged by install's logic, including the flags that only
+// install supported before.
+func TestMergeValues_InstallFlags(t *testing.T) {
+	base, err := ioutil.TempFile(t.TempDir(), "base-*.yaml")
+	require.NoError(t, err)
+	_, err = base.WriteString("server:\n  replicas: 5\nclient:\n  enabled: false\n")
+	require.NoError(t, err)
+	require.NoError(t, base.Close())
+
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{
+		"-base-values", base.Name(),
+		"-set", "client.enabled=true",
+		"-set-literal", "global.image=registry/consul:1.10,latest",
+		"-server-priority-class", "consul-critical",
+	}))
+
+	vals, err := c.values.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{"image": "registry/consul:1.10,latest"},
+		"server": map[string]interface{}{"replicas": float64(5), "priorityClassName": "consul-critical"},
+		"client": map[string]interface{}{"enabled": true},
+	}, vals)
+}
+
+func TestValidateFlags(t *testing.T) {
+	cases := map[string][]string{
+		"'nope' is not a valid preset":           {"-preset", "nope"},
+		"File 'nope.yaml' does not exist.":       {"-f", "nope.yaml"},
+		"unable to parse -timeout":               {"-timeout", "soon"},
+		"-metrics-port requires -enable-metrics": {"-metrics-port", "9102"},
+		"should have no non-flag arguments":      {"consul"},
+	}
+	for expErr, args := range cases {
+		t.Run(expErr, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			err := c.validateFlags(args)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), expErr)
+		})
+	}
+}
+
+// TestFindRelease checks that only an existing Consul release is found.
+func TestFindRelease(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags(nil))
+	actionConfig := newActionConfig(t)
+
+	_, err := c.findRelease(actionConfig)
+	require.EqualError(t, err, `no Consul installation named "consul" found in namespace "consul" - run consul-k8s install to install Consul`)
+
+	require.NoError(t, actionConfig.Releases.Create(&release.Release{
+		Name:      common.DefaultReleaseName,
+		Namespace: common.DefaultReleaseNamespace,
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "vault"}},
+	}))
+	_, err = c.findRelease(actionConfig)
+	require.EqualError(t, err, `release "consul" in namespace "consul" is not a Consul installation`)
+
+	require.NoError(t, actionConfig.Releases.Create(&release.Release{
+		Name:      common.DefaultReleaseName,
+		Namespace: common.DefaultReleaseNamespace,
+		Version:   2,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "consul"}},
+	}))
+	rel, err := c.findRelease(actionConfig)
+	require.NoError(t, err)
+	require.Equal(t, 2, rel.Version)
+}
+
+// TestUpgrade checks that the release is upgraded with the merged values.
+func TestUpgrade(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-set", "server.replicas=5", "-wait=false"}))
+	actionConfig := newActionConfig(t)
+
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.1.0"},
+	}
+	require.NoError(t, actionConfig.Releases.Create(&release.Release{
+		Name:      common.DefaultReleaseName,
+		Namespace: common.DefaultReleaseNamespace,
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     chrt,
+		Config: map[string]interface{}{
+			"global": map[string]interface{}{"name": "consul"},
+		},
+	}))
+
+	rel, err := c.findRelease(actionConfig)
+	require.NoError(t, err)
+	changes, err := c.values.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	upgraded, err := c.upgrade(actionConfig, chrt, common.MergeMaps(rel.Config, changes))
+	require.NoError(t, err)
+	require.Equal(t, 2, upgraded.Version)
+	require.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{"name": "consul"},
+		"server": map[string]interface{}{"replicas": int64(5)},
+	}, upgraded.Config)
+}
+
+// TestUpgrade_HistoryMax checks that -history-max bounds the history of the upgraded release.
+func TestUpgrade_HistoryMax(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{"-history-max", "2", "-wait=false"}))
+	actionConfig := newActionConfig(t)
+
+	chrt := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "consul", Version: "0.1.0"},
+	}
+	for version, status := range map[int]release.Status{1: release.StatusSuperseded, 2: release.StatusDeployed} {
+		require.NoError(t, actionConfig.Releases.Create(&release.Release{
+			Name:      common.DefaultReleaseName,
+			Namespace: common.DefaultReleaseNamespace,
+			Version:   version,
+			Info:      &release.Info{Status: status},
+			Chart:     chrt,
+		}))
+	}
+
+	_, err := c.upgrade(actionConfig, chrt, map[string]interface{}{})
+	require.NoError(t, err)
+	history, err := actionConfig.Releases.History(common.DefaultReleaseName)
+	require.NoError(t, err)
+	var versions []int
+	for _, rel := range history {
+		versions = append(versions, rel.Version)
+	}
+	require.ElementsMatch(t, []int{2, 3}, versions)
+}
+
+// TestMergeValues_CurrentExtraConfig checks that -consul-log-level and the extra config flags are merged into the
+// extraConfig of the upgraded release instead of replacing it.
+func TestMergeValues_CurrentExtraConfig(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.validateFlags([]string{
+		"-consul-log-level", "debug",
+		"-client-extra-config", `{"telemetry": {"disable_hostname": true}}`,
+	}))
+	current := map[string]interface{}{
+		"server": map[string]interface{}{"extraConfig": `{"primary_datacenter": "dc1", "log_level": "INFO"}`},
+		"client": map[string]interface{}{"extraConfig": `{"telemetry": {"prometheus_retention_time": "1m"}}`},
+	}
+	c.values.SetCurrentValues(current)
+
+	changes, err := c.values.MergeValuesFlagsWithPrecedence(helmCLI.New())
+	require.NoError(t, err)
+	proposed := common.MergeMaps(current, changes)
+	require.JSONEq(t, `{"primary_datacenter": "dc1", "log_level": "DEBUG"}`,
+		proposed["server"].(map[string]interface{})["extraConfig"].(string))
+	require.JSONEq(t, `{"telemetry": {"prometheus_retention_time": "1m", "disable_hostname": true}, "log_level": "DEBUG"}`,
+		proposed["client"].(map[string]interface{})["extraConfig"].(string))
+}
+
+func newActionConfig(t *testing.T) *action.Configuration {
+	t.Helper()
+	return &action.Configuration{
+		Releases:     storage.Init(driver.NewMemory()),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          t.Logf,
+	}
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
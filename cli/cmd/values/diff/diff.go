@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	"github.com/hashicorp/consul-k8s/cli/cmd/install"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+const (
+	flagNameSetA = "set-a"
+	flagNameSetB = "set-b"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	set *flag.Sets
+
+	flagSetA []string
+	flagSetB []string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameSetA,
+		Target: &c.flagSetA,
+		Usage:  "Set a value on top of the first values source. Can be specified multiple times.",
+	})
+	f.StringSliceVar(&flag.StringSliceVar{
+		Name:   flagNameSetB,
+		Target: &c.flagSetB,
+		Usage:  "Set a value on top of the second values source. Can be specified multiple times.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to values-diff so log lines would be prefixed with values-diff.
+	c.Log = c.Log.ResetNamed("values-diff")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if len(c.set.Args()) != 2 {
+		c.UI.Output("expected two values sources, a preset name or the path to a values file", terminal.WithErrorStyle())
+		return 1
+	}
+	a, b := c.set.Args()[0], c.set.Args()[1]
+
+	providers := getter.All(helmCLI.New())
+	diff, err := c.diff(a, b, providers)
+	if err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	c.UI.Output("Values Diff", terminal.WithHeaderStyle())
+	c.UI.Output("Changes from %s to %s:", a, b, terminal.WithInfoStyle())
+	if len(diff) == 0 {
+		c.UI.Output("No differences", terminal.WithInfoStyle())
+		return 0
+	}
+	c.UI.Output("%s", strings.Join(diff, "\n"), terminal.WithInfoStyle())
+	return 0
+}
+
+// diff loads the values sources a and b, with -set-a and -set-b on top of them, and returns the changes from a to b.
+func (c *Command) diff(a, b string, providers getter.Providers) ([]string, error) {
+	aVals, err := loadValues(a, c.flagSetA, providers)
+	if err != nil {
+		return nil, err
+	}
+	bVals, err := loadValues(b, c.flagSetB, providers)
+	if err != nil {
+		return nil, err
+	}
+	return common.ValuesDiff(aVals, bVals)
+}
+
+// loadValues returns the values of source, which is the name of a preset or the path to a values file, with the
+// values set by sets merged on top of them.
+func loadValues(source string, sets []string, providers getter.Providers) (map[string]interface{}, error) {
+	opts := &values.Options{Values: sets}
+	preset, isPreset := install.Presets()[source]
+	if !isPreset {
+		if _, err := os.Stat(source); err != nil && os.IsNotExist(err) {
+			return nil, fmt.Errorf("%q is neither a preset, one of %s, nor a values file", source,
+				strings.Join(install.PresetNames(), ", "))
+		}
+		opts.ValueFiles = []string{source}
+	}
+	vals, err := opts.MergeValues(providers)
+	if err != nil {
+		return nil, fmt.Errorf("error loading values from %s: %s", source, err)
+	}
+	if isPreset {
+		vals = common.MergeMaps(preset, vals)
+	}
+	return vals, nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s values diff [flags] <a> <b>" + "\n" + "Show the differences between two sets of Consul Helm chart values." + "\n\n" +
+		"Each of a and b is the name of a preset or the path to a values file. Added values are prefixed with +, " +
+		"removed values with - and changed values with ~." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Show the differences between two presets or values files."
+}
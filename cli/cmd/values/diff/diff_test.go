@@ -0,0 +1,79 @@
+package diff
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// TestDiff_Presets checks that the security features of the secure preset show as added when diffing the demo and
+// secure presets.
+func TestDiff_Presets(t *testing.T) {
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse([]string{"demo", "secure"}))
+
+	diff, err := c.diff("demo", "secure", getter.Providers{})
+	require.NoError(t, err)
+	require.Contains(t, diff, "+ global.acls.manageSystemACLs: true")
+	require.Contains(t, diff, "+ global.tls.enabled: true")
+	require.Contains(t, diff, "+ global.tls.enableAutoEncrypt: true")
+	require.Contains(t, diff, "+ global.gossipEncryption.autoGenerate: true")
+	require.Contains(t, diff, "- prometheus.enabled: true")
+	require.NotContains(t, diff, "server.replicas")
+}
+
+// TestDiff_FilesAndSets checks that values files can be diffed, and that -set-a and -set-b override each side.
+func TestDiff_FilesAndSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values-diff")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("server:\n  replicas: 3\n"), 0600))
+
+	c := getInitializedCommand(t)
+	require.NoError(t, c.set.Parse([]string{"-set-a", "global.name=consul", "-set-b", "server.replicas=5"}))
+	diff, err := c.diff(file, file, getter.Providers{})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"- global.name: \"consul\"",
+		"~ server.replicas: 3 -> 5",
+	}, diff)
+
+	_, err = c.diff("demo", filepath.Join(dir, "none.yaml"), getter.Providers{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is neither a preset, one of demo, secure, nor a values file")
+}
+
+func TestRun_Args(t *testing.T) {
+	for _, args := range [][]string{nil, {"demo"}, {"demo", "secure", "demo"}} {
+		c := getInitializedCommand(t)
+		require.Equal(t, 1, c.Run(args))
+	}
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
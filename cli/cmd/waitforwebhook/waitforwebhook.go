@@ -0,0 +1,231 @@
+package waitforwebhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/flag"
+	"github.com/hashicorp/consul-k8s/cli/cmd/common/terminal"
+	helmCLI "helm.sh/helm/v3/pkg/cli"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	flagNameNamespace = "namespace"
+
+	flagNameTimeout = "timeout"
+	defaultTimeout  = "5m"
+
+	// pollInterval is how often the webhook resources are checked.
+	pollInterval = 2 * time.Second
+)
+
+var (
+	// webhookConfigName is the name of the MutatingWebhookConfiguration created by the Helm chart.
+	webhookConfigName = common.DefaultReleaseName + "-connect-injector-cfg"
+	// webhookDeploymentName is the name of the connect injector deployment created by the Helm chart.
+	webhookDeploymentName = common.DefaultReleaseName + "-connect-injector-webhook-deployment"
+)
+
+type Command struct {
+	*common.BaseCommand
+
+	kubernetes kubernetes.Interface
+
+	set *flag.Sets
+
+	flagNamespace string
+	flagTimeout   string
+
+	timeoutDuration time.Duration
+
+	flagKubeConfig  string
+	flagKubeContext string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.set = flag.NewSets()
+	f := c.set.NewSet("Command Options")
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameNamespace,
+		Target:  &c.flagNamespace,
+		Default: common.DefaultReleaseNamespace,
+		Usage:   "Namespace of the Consul installation.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    flagNameTimeout,
+		Target:  &c.flagTimeout,
+		Default: defaultTimeout,
+		Usage:   "Timeout to wait for the connect injector webhook to be serving.",
+	})
+
+	f = c.set.NewSet("Global Options")
+	f.StringVar(&flag.StringVar{
+		Name:    "kubeconfig",
+		Aliases: []string{"c"},
+		Target:  &c.flagKubeConfig,
+		Default: "",
+		Usage:   "Path to kubeconfig file.",
+	})
+	f.StringVar(&flag.StringVar{
+		Name:    "context",
+		Target:  &c.flagKubeContext,
+		Default: "",
+		Usage:   "Kubernetes context to use.",
+	})
+
+	c.help = c.set.Help()
+
+	// c.Init() calls the embedded BaseCommand's initialization function.
+	c.Init()
+}
+
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+
+	// The logger is initialized in main with the name cli. Here, we reset the name to wait-for-webhook so log lines would be prefixed with wait-for-webhook.
+	c.Log.ResetNamed("wait-for-webhook")
+
+	defer common.CloseWithError(c.BaseCommand)
+
+	if err := c.set.Parse(args); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	if err := c.validateFlags(); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	// helmCLI.New() will create a settings object which is used to build the Kubernetes client.
+	settings := helmCLI.New()
+	if c.flagKubeConfig != "" {
+		settings.KubeConfig = c.flagKubeConfig
+	}
+	if c.flagKubeContext != "" {
+		settings.KubeContext = c.flagKubeContext
+	}
+
+	if err := c.setupKubeClient(settings); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+
+	c.UI.Output("Waiting for the connect injector webhook to be serving", terminal.WithHeaderStyle())
+	ctx, cancel := context.WithTimeout(c.Ctx, c.timeoutDuration)
+	defer cancel()
+	if err := c.waitForWebhook(ctx, pollInterval); err != nil {
+		c.UI.Output(err.Error(), terminal.WithErrorStyle())
+		return 1
+	}
+	c.UI.Output("Connect injector webhook is serving", terminal.WithSuccessStyle())
+	return 0
+}
+
+// validateFlags checks the flags and parses -timeout.
+func (c *Command) validateFlags() error {
+	if len(c.set.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	duration, err := time.ParseDuration(c.flagTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to parse -%s: %s", flagNameTimeout, err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("-%s must be positive", flagNameTimeout)
+	}
+	c.timeoutDuration = duration
+	return nil
+}
+
+// waitForWebhook polls the webhook resources every interval until webhookReady reports that the webhook is serving.
+// It returns an error including the last reason the webhook wasn't ready if ctx is done first.
+func (c *Command) waitForWebhook(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reason, err := c.webhookReady(ctx)
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			return nil
+		}
+		c.Log.Debug("webhook not ready", "reason", reason)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the connect injector webhook: %s", reason)
+		case <-ticker.C:
+		}
+	}
+}
+
+// webhookReady returns an empty reason if the webhook is serving, i.e. its MutatingWebhookConfiguration has been
+// patched with a CA bundle and all replicas of its deployment are ready. Otherwise, it returns why it isn't. Resources
+// that don't exist yet are reported as a reason rather than an error since they may still be created.
+func (c *Command) webhookReady(ctx context.Context) (string, error) {
+	config, err := c.kubernetes.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, webhookConfigName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Sprintf("mutating webhook configuration %s not found", webhookConfigName), nil
+	} else if err != nil {
+		return "", fmt.Errorf("error getting mutating webhook configuration %s: %s", webhookConfigName, err)
+	}
+	if len(config.Webhooks) == 0 {
+		return fmt.Sprintf("mutating webhook configuration %s has no webhooks", webhookConfigName), nil
+	}
+	for _, webhook := range config.Webhooks {
+		if len(webhook.ClientConfig.CABundle) == 0 {
+			return fmt.Sprintf("webhook %s has no CA bundle", webhook.Name), nil
+		}
+	}
+
+	deployment, err := c.kubernetes.AppsV1().Deployments(c.flagNamespace).Get(ctx, webhookDeploymentName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Sprintf("deployment %s not found", webhookDeploymentName), nil
+	} else if err != nil {
+		return "", fmt.Errorf("error getting deployment %s: %s", webhookDeploymentName, err)
+	}
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	if desired == 0 || deployment.Status.ReadyReplicas < desired {
+		return fmt.Sprintf("deployment %s has %d/%d ready replicas", webhookDeploymentName, deployment.Status.ReadyReplicas, desired), nil
+	}
+	return "", nil
+}
+
+// setupKubeClient to use for calls to the Kubernetes API.
+func (c *Command) setupKubeClient(settings *helmCLI.EnvSettings) error {
+	if c.kubernetes == nil {
+		restConfig, err := settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			return fmt.Errorf("retrieving Kubernetes auth: %v", err)
+		}
+		c.kubernetes, err = kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("initializing Kubernetes client: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	s := "Usage: consul-k8s wait-for-webhook [flags]" + "\n" + "Wait until the connect injector webhook is serving." + "\n\n" + c.help
+	return s
+}
+
+func (c *Command) Synopsis() string {
+	return "Wait for the connect injector webhook to be serving."
+}
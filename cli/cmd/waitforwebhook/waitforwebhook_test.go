@@ -0,0 +1,152 @@
+package waitforwebhook
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestWaitForWebhook creates a webhook configuration without a CA bundle and a deployment without ready replicas and
+// checks that waitForWebhook only returns once both have been updated to be ready.
+func TestWaitForWebhook(t *testing.T) {
+	c := getInitializedCommand(t)
+	client := fake.NewSimpleClientset(webhookConfig(nil), webhookDeployment(0))
+	c.kubernetes = client
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.waitForWebhook(ctx, 10*time.Millisecond)
+	}()
+
+	// Patch the CA bundle first, as the webhook-cert-manager would.
+	_, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(ctx, webhookConfig([]byte("ca")), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	select {
+	case err := <-done:
+		t.Fatalf("returned before the deployment was ready: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = client.AppsV1().Deployments(common.DefaultReleaseNamespace).Update(ctx, webhookDeployment(1), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for waitForWebhook to return")
+	}
+}
+
+func TestWaitForWebhook_Timeout(t *testing.T) {
+	cases := map[string]struct {
+		objects   []runtime.Object
+		expReason string
+	}{
+		"no webhook configuration": {
+			expReason: "mutating webhook configuration consul-connect-injector-cfg not found",
+		},
+		"no CA bundle": {
+			objects:   []runtime.Object{webhookConfig(nil)},
+			expReason: "webhook consul-connect-injector.consul.hashicorp.com has no CA bundle",
+		},
+		"no deployment": {
+			objects:   []runtime.Object{webhookConfig([]byte("ca"))},
+			expReason: "deployment consul-connect-injector-webhook-deployment not found",
+		},
+		"deployment not ready": {
+			objects:   []runtime.Object{webhookConfig([]byte("ca")), webhookDeployment(0)},
+			expReason: "deployment consul-connect-injector-webhook-deployment has 0/1 ready replicas",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := getInitializedCommand(t)
+			c.kubernetes = fake.NewSimpleClientset(tc.objects...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := c.waitForWebhook(ctx, 10*time.Millisecond)
+			require.EqualError(t, err, "timed out waiting for the connect injector webhook: "+tc.expReason)
+		})
+	}
+}
+
+func TestValidateFlags(t *testing.T) {
+	cases := map[string][]string{
+		"unable to parse -timeout":          {"-timeout", "soon"},
+		"-timeout must be positive":         {"-timeout", "0s"},
+		"should have no non-flag arguments": {"extra"},
+	}
+	for expErr, args := range cases {
+		c := getInitializedCommand(t)
+		require.NoError(t, c.set.Parse(args))
+		err := c.validateFlags()
+		require.Error(t, err, args)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
+func webhookConfig(caBundle []byte) *admissionv1.MutatingWebhookConfiguration {
+	return &admissionv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: webhookConfigName,
+		},
+		Webhooks: []admissionv1.MutatingWebhook{
+			{
+				Name: "consul-connect-injector.consul.hashicorp.com",
+				ClientConfig: admissionv1.WebhookClientConfig{
+					CABundle: caBundle,
+				},
+			},
+		},
+	}
+}
+
+func webhookDeployment(readyReplicas int32) *appsv1.Deployment {
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      webhookDeploymentName,
+			Namespace: common.DefaultReleaseNamespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: appsv1.DeploymentStatus{
+			ReadyReplicas: readyReplicas,
+		},
+	}
+}
+
+func getInitializedCommand(t *testing.T) *Command {
+	t.Helper()
+	log := hclog.New(&hclog.LoggerOptions{
+		Name:   "cli",
+		Level:  hclog.Info,
+		Output: os.Stdout,
+	})
+
+	baseCommand := &common.BaseCommand{
+		Ctx: context.Background(),
+		Log: log,
+	}
+
+	c := &Command{
+		BaseCommand: baseCommand,
+	}
+	c.init()
+	return c
+}
@@ -3,11 +3,22 @@ package main
 import (
 	"context"
 
+	aclbootstraptoken "github.com/hashicorp/consul-k8s/cli/cmd/acl/bootstraptoken"
+	clientsrestart "github.com/hashicorp/consul-k8s/cli/cmd/clients/restart"
 	"github.com/hashicorp/consul-k8s/cli/cmd/common"
+	connecttoggle "github.com/hashicorp/consul-k8s/cli/cmd/connect/toggle"
+	connectvalidate "github.com/hashicorp/consul-k8s/cli/cmd/connect/validate"
+	crdinstall "github.com/hashicorp/consul-k8s/cli/cmd/crd/install"
+	"github.com/hashicorp/consul-k8s/cli/cmd/getvalues"
+	"github.com/hashicorp/consul-k8s/cli/cmd/initconfig"
 	"github.com/hashicorp/consul-k8s/cli/cmd/install"
+	"github.com/hashicorp/consul-k8s/cli/cmd/logs"
 	"github.com/hashicorp/consul-k8s/cli/cmd/status"
 	"github.com/hashicorp/consul-k8s/cli/cmd/uninstall"
+	"github.com/hashicorp/consul-k8s/cli/cmd/upgrade"
+	valuesdiff "github.com/hashicorp/consul-k8s/cli/cmd/values/diff"
 	cmdversion "github.com/hashicorp/consul-k8s/cli/cmd/version"
+	"github.com/hashicorp/consul-k8s/cli/cmd/waitforwebhook"
 	"github.com/hashicorp/consul-k8s/cli/version"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mitchellh/cli"
@@ -26,6 +37,11 @@ func initializeCommands(ctx context.Context, log hclog.Logger) (*common.BaseComm
 				BaseCommand: baseCommand,
 			}, nil
 		},
+		"upgrade": func() (cli.Command, error) {
+			return &upgrade.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
 		"uninstall": func() (cli.Command, error) {
 			return &uninstall.Command{
 				BaseCommand: baseCommand,
@@ -36,6 +52,62 @@ func initializeCommands(ctx context.Context, log hclog.Logger) (*common.BaseComm
 				BaseCommand: baseCommand,
 			}, nil
 		},
+		"acl bootstrap-token": func() (cli.Command, error) {
+			return &aclbootstraptoken.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"clients restart": func() (cli.Command, error) {
+			return &clientsrestart.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"connect validate": func() (cli.Command, error) {
+			return &connectvalidate.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"connect enable": func() (cli.Command, error) {
+			return &connecttoggle.Command{
+				BaseCommand: baseCommand,
+				Enable:      true,
+			}, nil
+		},
+		"connect disable": func() (cli.Command, error) {
+			return &connecttoggle.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"crd install": func() (cli.Command, error) {
+			return &crdinstall.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"get-values": func() (cli.Command, error) {
+			return &getvalues.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"values diff": func() (cli.Command, error) {
+			return &valuesdiff.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"logs": func() (cli.Command, error) {
+			return &logs.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"wait-for-webhook": func() (cli.Command, error) {
+			return &waitforwebhook.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
+		"init-config": func() (cli.Command, error) {
+			return &initconfig.Command{
+				BaseCommand: baseCommand,
+			}, nil
+		},
 		"version": func() (cli.Command, error) {
 			return &cmdversion.Command{
 				BaseCommand: baseCommand,
@@ -4,6 +4,8 @@ import (
 	"os"
 
 	cmdACLInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/acl-init"
+	cmdCARotate "github.com/hashicorp/consul-k8s/control-plane/subcommand/ca-rotate"
+	cmdCheck "github.com/hashicorp/consul-k8s/control-plane/subcommand/check"
 	cmdConnectInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/connect-init"
 	cmdConsulSidecar "github.com/hashicorp/consul-k8s/control-plane/subcommand/consul-sidecar"
 	cmdController "github.com/hashicorp/consul-k8s/control-plane/subcommand/controller"
@@ -11,10 +13,15 @@ import (
 	cmdDeleteCompletedJob "github.com/hashicorp/consul-k8s/control-plane/subcommand/delete-completed-job"
 	cmdGetConsulClientCA "github.com/hashicorp/consul-k8s/control-plane/subcommand/get-consul-client-ca"
 	cmdGossipEncryptionAutogenerate "github.com/hashicorp/consul-k8s/control-plane/subcommand/gossip-encryption-autogenerate"
+	cmdGossipList "github.com/hashicorp/consul-k8s/control-plane/subcommand/gossip-list"
+	cmdGossipRotate "github.com/hashicorp/consul-k8s/control-plane/subcommand/gossip-rotate"
+	cmdGossipValidateKey "github.com/hashicorp/consul-k8s/control-plane/subcommand/gossip-validate-key"
 	cmdInjectConnect "github.com/hashicorp/consul-k8s/control-plane/subcommand/inject-connect"
 	cmdPartitionInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/partition-init"
 	cmdServerACLInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/server-acl-init"
 	cmdServiceAddress "github.com/hashicorp/consul-k8s/control-plane/subcommand/service-address"
+	cmdSnapshotRestore "github.com/hashicorp/consul-k8s/control-plane/subcommand/snapshot-restore"
+	cmdSnapshotSave "github.com/hashicorp/consul-k8s/control-plane/subcommand/snapshot-save"
 	cmdSyncCatalog "github.com/hashicorp/consul-k8s/control-plane/subcommand/sync-catalog"
 	cmdTLSInit "github.com/hashicorp/consul-k8s/control-plane/subcommand/tls-init"
 	cmdVersion "github.com/hashicorp/consul-k8s/control-plane/subcommand/version"
@@ -93,6 +100,46 @@ func init() {
 		"gossip-encryption-autogenerate": func() (cli.Command, error) {
 			return &cmdGossipEncryptionAutogenerate.Command{UI: ui}, nil
 		},
+
+		"gossip list": func() (cli.Command, error) {
+			return &cmdGossipList.Command{UI: ui}, nil
+		},
+
+		"gossip rotate": func() (cli.Command, error) {
+			return &cmdGossipRotate.Command{UI: ui}, nil
+		},
+
+		"gossip validate-key": func() (cli.Command, error) {
+			return &cmdGossipValidateKey.Command{UI: ui}, nil
+		},
+
+		"check": func() (cli.Command, error) {
+			return &cmdCheck.Command{UI: ui}, nil
+		},
+
+		"ca rotate": func() (cli.Command, error) {
+			return &cmdCARotate.Command{UI: ui}, nil
+		},
+
+		"snapshot save": func() (cli.Command, error) {
+			return &cmdSnapshotSave.Command{UI: ui}, nil
+		},
+
+		"snapshot restore": func() (cli.Command, error) {
+			return &cmdSnapshotRestore.Command{UI: ui}, nil
+		},
+	}
+
+	// Every subcommand prints the version when run with -version.
+	for name, factory := range Commands {
+		factory := factory
+		Commands[name] = func() (cli.Command, error) {
+			cmd, err := factory()
+			if err != nil {
+				return nil, err
+			}
+			return &cmdVersion.FlagCommand{Command: cmd, UI: ui, Version: version.GetHumanVersion()}, nil
+		}
 	}
 }
 
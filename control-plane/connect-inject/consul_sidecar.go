@@ -27,6 +27,9 @@ func (h *Handler) consulSidecar(pod corev1.Pod) (corev1.Container, error) {
 		fmt.Sprintf("-log-level=%s", h.LogLevel),
 		fmt.Sprintf("-log-json=%t", h.LogJSON),
 	}
+	if serviceName := pod.Annotations[annotationService]; serviceName != "" {
+		command = append(command, fmt.Sprintf("-service-name=%s", serviceName))
+	}
 
 	return corev1.Container{
 		Name:  "consul-sidecar",
@@ -42,4 +42,36 @@ func TestConsulSidecar_MetricsFlags(t *testing.T) {
 	require.Contains(t, container.Command, "-merged-metrics-port=20100")
 	require.Contains(t, container.Command, "-service-metrics-port=8080")
 	require.Contains(t, container.Command, "-service-metrics-path=/metrics")
+	require.NotContains(t, container.Command, "-service-name=")
+}
+
+// Test that the service name annotation is passed to consul sidecar so that
+// it can identify the service in the merged metrics.
+func TestConsulSidecar_ServiceName(t *testing.T) {
+	handler := Handler{
+		Log:            logrtest.TestLogger{T: t},
+		ImageConsulK8S: "hashicorp/consul-k8s:9.9.9",
+		MetricsConfig: MetricsConfig{
+			DefaultEnableMetrics:        true,
+			DefaultEnableMetricsMerging: true,
+		},
+	}
+	container, err := handler.consulSidecar(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationService:            "web",
+				annotationServiceMetricsPort: "8080",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "web",
+				},
+			},
+		},
+	})
+
+	require.NoError(t, err)
+	require.Contains(t, container.Command, "-service-name=web")
 }
@@ -887,7 +887,7 @@ func (r *EndpointsController) remoteConsulClient(ip string, namespace string) (*
 	localConfig := r.ConsulClientCfg
 	localConfig.Address = newAddr
 	localConfig.Namespace = namespace
-	return consul.NewClient(localConfig)
+	return consul.NewNamedClient(localConfig, "endpoints-controller")
 }
 
 // shouldIgnore ignores namespaces where we don't connect-inject.
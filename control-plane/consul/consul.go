@@ -10,10 +10,26 @@ import (
 // NewClient returns a Consul API client. It adds a required User-Agent
 // header that describes the version of consul-k8s making the call.
 func NewClient(config *capi.Config) (*capi.Client, error) {
+	return NewNamedClient(config, "")
+}
+
+// NewNamedClient returns a Consul API client like NewClient, but also appends
+// the name of the consul-k8s component making the call to the User-Agent
+// header, e.g. "consul-k8s/0.33.0 (sync-catalog)".
+func NewNamedClient(config *capi.Config, component string) (*capi.Client, error) {
 	client, err := capi.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
-	client.AddHeader("User-Agent", fmt.Sprintf("consul-k8s/%s", version.GetHumanVersion()))
+	client.AddHeader("User-Agent", userAgent(component))
 	return client, nil
 }
+
+// userAgent returns the User-Agent header for the given component.
+func userAgent(component string) string {
+	ua := fmt.Sprintf("consul-k8s/%s", version.GetHumanVersion())
+	if component != "" {
+		ua = fmt.Sprintf("%s (%s)", ua, component)
+	}
+	return ua
+}
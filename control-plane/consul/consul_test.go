@@ -43,3 +43,18 @@ func TestNewClient(t *testing.T) {
 		UserAgentHeader: fmt.Sprintf("consul-k8s/%s", version.GetHumanVersion()),
 	}, consulAPICalls[0])
 }
+
+func TestNewNamedClient(t *testing.T) {
+	var userAgent string
+	consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		fmt.Fprintln(w, "\"leader\"")
+	}))
+	defer consulServer.Close()
+
+	client, err := NewNamedClient(&capi.Config{Address: consulServer.URL}, "sync-catalog")
+	require.NoError(t, err)
+	_, err = client.Status().Leader()
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("consul-k8s/%s (sync-catalog)", version.GetHumanVersion()), userAgent)
+}
@@ -0,0 +1,48 @@
+package consul
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	capi "github.com/hashicorp/consul/api"
+)
+
+// RetryConfig bounds how often an operation is attempted and how long to
+// wait between attempts.
+type RetryConfig struct {
+	// Attempts is the maximum number of attempts. Values below 1 are treated as 1.
+	Attempts int
+	// Interval is the time to wait between attempts.
+	Interval time.Duration
+}
+
+// WaitForPrimaryKey polls the keyring until key is the primary gossip
+// encryption key on every node of every keyring. It returns an error if that
+// is still not the case after the configured number of attempts. The key
+// itself is never included in the error.
+func WaitForPrimaryKey(client *capi.Client, key string, retry RetryConfig) error {
+	attempts := retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var attempt int
+	err := backoff.Retry(func() error {
+		attempt++
+		keyrings, err := client.Operator().KeyringList(nil)
+		if err != nil {
+			return fmt.Errorf("listing keys: %s", err)
+		}
+		for _, keyring := range keyrings {
+			if keyring.PrimaryKeys[key] < keyring.NumNodes {
+				return fmt.Errorf("key is the primary key on %d of %d nodes in datacenter %q",
+					keyring.PrimaryKeys[key], keyring.NumNodes, keyring.Datacenter)
+			}
+		}
+		return nil
+	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(retry.Interval), uint64(attempts-1)))
+	if err != nil {
+		return fmt.Errorf("key did not become the primary key after %d attempts: %s", attempt, err)
+	}
+	return nil
+}
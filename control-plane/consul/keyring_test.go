@@ -0,0 +1,57 @@
+package consul
+
+import (
+	"testing"
+	"time"
+
+	capi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	primaryKey   = "Ib6wrnOmO/5kV1Px5O5DXqcoa0Il/3AR7aZSIk0hUAE="
+	secondaryKey = "8UkJdcYzwbl1OpW3aAbI6Lwt9pRwNqbK1PUXX0Udb+Y="
+)
+
+func TestWaitForPrimaryKey(t *testing.T) {
+	t.Parallel()
+	server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.Encrypt = primaryKey
+	})
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+
+	client, err := NewClient(&capi.Config{Address: server.HTTPAddr})
+	require.NoError(t, err)
+	require.NoError(t, client.Operator().KeyringInstall(secondaryKey, nil))
+
+	retry := RetryConfig{Attempts: 3, Interval: 10 * time.Millisecond}
+
+	// The current primary key is found immediately.
+	require.NoError(t, WaitForPrimaryKey(client, primaryKey, retry))
+
+	// A key that is installed but not primary times out.
+	err = WaitForPrimaryKey(client, secondaryKey, retry)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "key did not become the primary key after 3 attempts")
+	require.Contains(t, err.Error(), "key is the primary key on 0 of 1 nodes")
+
+	// A key that becomes primary while polling is found eventually.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = client.Operator().KeyringUse(secondaryKey, nil)
+	}()
+	require.NoError(t, WaitForPrimaryKey(client, secondaryKey, RetryConfig{Attempts: 50, Interval: 50 * time.Millisecond}))
+}
+
+func TestWaitForPrimaryKey_Unreachable(t *testing.T) {
+	t.Parallel()
+	client, err := NewClient(&capi.Config{Address: "127.0.0.1:1"})
+	require.NoError(t, err)
+
+	err = WaitForPrimaryKey(client, primaryKey, RetryConfig{Attempts: 2, Interval: time.Millisecond})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "after 2 attempts: listing keys:")
+}
@@ -22,7 +22,10 @@ type Controller struct {
 	Log      hclog.Logger
 	Resource Resource
 
-	informer cache.SharedIndexInformer
+	// informerLock guards informer since HasSynced may be called, e.g. by
+	// a readiness check, while Run is starting.
+	informerLock sync.RWMutex
+	informer     cache.SharedIndexInformer
 }
 
 // Event is something that occurred to the resources we're watching.
@@ -48,7 +51,9 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 
 	// Create an informer so we can keep track of all service changes.
 	informer := c.Resource.Informer()
+	c.informerLock.Lock()
 	c.informer = informer
+	c.informerLock.Unlock()
 
 	// Create a queue for storing items to process from the informer.
 	var queueOnce sync.Once
@@ -136,6 +141,8 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 
 // HasSynced implements cache.Controller
 func (c *Controller) HasSynced() bool {
+	c.informerLock.RLock()
+	defer c.informerLock.RUnlock()
 	if c.informer == nil {
 		return false
 	}
@@ -145,6 +152,8 @@ func (c *Controller) HasSynced() bool {
 
 // LastSyncResourceVersion implements cache.Controller
 func (c *Controller) LastSyncResourceVersion() string {
+	c.informerLock.RLock()
+	defer c.informerLock.RUnlock()
 	if c.informer == nil {
 		return ""
 	}
@@ -22,6 +22,29 @@ func TestController_impl(t *testing.T) {
 	var _ cache.Controller = &Controller{}
 }
 
+// Test that HasSynced is false until the informer cache has synced
+func TestController_hasSynced(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset()
+	resource, _, _, _ := testResource(client)
+	c := &Controller{Log: hclog.Default(), Resource: resource}
+	require.False(t, c.HasSynced())
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		c.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	require.Eventually(t, c.HasSynced, 5*time.Second, 10*time.Millisecond)
+}
+
 // Test that data that exists before is synced
 func TestController_initialData(t *testing.T) {
 	t.Parallel()
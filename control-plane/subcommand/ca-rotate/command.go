@@ -0,0 +1,207 @@
+package carotate
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/helper/cert"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+)
+
+// consulProvider is the name of Consul's built-in CA provider, the only
+// provider this command can rotate.
+const consulProvider = "consul"
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+
+	flagDryRun bool
+
+	once sync.Once
+	help string
+}
+
+// root is what the command reports about a Connect CA root.
+type root struct {
+	ID       string
+	Name     string
+	Serial   string
+	NotAfter time.Time
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.BoolVar(&c.flagDryRun, "dry-run", false,
+		"Only print the active CA root without rotating it.")
+
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run rotates the Connect CA of the built-in Consul provider by configuring it
+// with a new private key, and prints the active root before and after.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+
+	consulClient, err := c.http.NamedAPIClient("ca-rotate")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating Consul client: %s", err))
+		return 1
+	}
+
+	current, err := activeRoot(consulClient)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error getting the active CA root: %s", err))
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("Current CA: %s", current))
+
+	config, _, err := consulClient.Connect().CAGetConfig(nil)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error getting the CA configuration: %s", err))
+		return 1
+	}
+	if config.Provider != consulProvider {
+		c.UI.Error(fmt.Sprintf("CA provider %q is not supported, only the %q provider can be rotated", config.Provider, consulProvider))
+		return 1
+	}
+	if c.flagDryRun {
+		return 0
+	}
+
+	key, err := privateKey()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error generating a private key: %s", err))
+		return 1
+	}
+	newConfig := &api.CAConfig{
+		Provider: consulProvider,
+		Config:   rotatedConfig(config.Config, key),
+	}
+	if _, err := consulClient.Connect().CASetConfig(newConfig, nil); err != nil {
+		c.UI.Error(fmt.Sprintf("Error setting the CA configuration: %s", err))
+		return 1
+	}
+
+	rotated, err := activeRoot(consulClient)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error getting the active CA root: %s", err))
+		return 1
+	}
+	if rotated.ID == current.ID {
+		c.UI.Error("The active CA root did not change")
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("Rotated CA: %s", rotated))
+	return 0
+}
+
+// rotatedConfig returns a copy of the provider configuration with the private
+// key replaced by key. The root certificate is removed so Consul generates a
+// new one signed by key.
+func rotatedConfig(config map[string]interface{}, key string) map[string]interface{} {
+	rotated := make(map[string]interface{}, len(config)+1)
+	for k, v := range config {
+		rotated[k] = v
+	}
+	delete(rotated, "RootCert")
+	rotated["PrivateKey"] = key
+	return rotated
+}
+
+// activeRoot returns the active Connect CA root.
+func activeRoot(client *api.Client) (root, error) {
+	roots, _, err := client.Connect().CARoots(nil)
+	if err != nil {
+		return root{}, fmt.Errorf("error getting the CA roots: %s", err)
+	}
+	for _, r := range roots.Roots {
+		if !r.Active {
+			continue
+		}
+		caCert, err := cert.ParseCert([]byte(r.RootCertPEM))
+		if err != nil {
+			return root{}, fmt.Errorf("error parsing the root certificate %s: %s", r.ID, err)
+		}
+		return root{
+			ID:       r.ID,
+			Name:     r.Name,
+			Serial:   hexString(caCert.SerialNumber.Bytes()),
+			NotAfter: caCert.NotAfter,
+		}, nil
+	}
+	return root{}, errors.New("no active CA root")
+}
+
+func (r root) String() string {
+	return fmt.Sprintf("%s (ID %s, serial %s, expires %s)", r.Name, r.ID, r.Serial, r.NotAfter.Format(time.RFC3339))
+}
+
+// hexString formats bytes as colon-separated hex like Consul formats serial numbers.
+func hexString(bs []byte) string {
+	parts := make([]string, len(bs))
+	for i, b := range bs {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// privateKey returns a new PEM-encoded ECDSA private key.
+func privateKey() (string, error) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	bs, err := x509.MarshalECPrivateKey(pk)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: bs}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Rotate the Consul Connect CA."
+const help = `
+Usage: consul-k8s-control-plane ca rotate [options]
+
+  Rotates the Connect CA of Consul's built-in CA provider by configuring
+  it with a new private key. Consul generates a new root certificate,
+  cross-signed by the previous one so existing certificates stay trusted
+  while they are reissued. The active root is printed before and after.
+
+  With -dry-run, only the active root is printed.
+
+`
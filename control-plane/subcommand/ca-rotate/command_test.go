@@ -0,0 +1,79 @@
+package carotate
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"extra"})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), "Should have no non-flag arguments.")
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.Connect = map[string]interface{}{"enabled": true}
+	})
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+
+	// The CA is initialized asynchronously after the leader is elected.
+	var current string
+	retry.Run(t, func(r *retry.R) {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		code := cmd.Run([]string{"-http-addr", server.HTTPAddr, "-dry-run"})
+		require.Equal(r, 0, code, ui.ErrorWriter.String())
+		current = caID(r, ui.OutputWriter.String(), "Current CA")
+	})
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-http-addr", server.HTTPAddr})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	output := ui.OutputWriter.String()
+	require.Equal(t, current, caID(t, output, "Current CA"))
+	rotated := caID(t, output, "Rotated CA")
+	require.NotEqual(t, current, rotated)
+
+	// The rotated root is now the active one.
+	ui = cli.NewMockUi()
+	cmd = Command{UI: ui}
+	code = cmd.Run([]string{"-http-addr", server.HTTPAddr, "-dry-run"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Equal(t, rotated, caID(t, ui.OutputWriter.String(), "Current CA"))
+}
+
+func TestRotatedConfig(t *testing.T) {
+	t.Parallel()
+	config := map[string]interface{}{
+		"LeafCertTTL": "72h",
+		"RootCert":    "old-cert",
+		"PrivateKey":  "old-key",
+	}
+	rotated := rotatedConfig(config, "new-key")
+	require.Equal(t, map[string]interface{}{
+		"LeafCertTTL": "72h",
+		"PrivateKey":  "new-key",
+	}, rotated)
+	// The original configuration is not modified.
+	require.Equal(t, "old-key", config["PrivateKey"])
+}
+
+// caID returns the ID of the CA root reported on the line starting with prefix.
+func caID(t require.TestingT, output, prefix string) string {
+	matches := regexp.MustCompile(prefix + `: .* \(ID (\S+), serial [0-9a-f:]+, expires \S+\)`).FindStringSubmatch(output)
+	require.Len(t, matches, 2, output)
+	return matches[1]
+}
@@ -0,0 +1,144 @@
+package check
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/mitchellh/cli"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+
+	flagOutput string
+
+	once sync.Once
+	help string
+}
+
+// result is what the check reports about the Consul agent it reached.
+type result struct {
+	NodeName      string `json:"nodeName"`
+	Datacenter    string `json:"datacenter"`
+	Server        bool   `json:"server"`
+	ServerVersion string `json:"serverVersion"`
+	Leader        string `json:"leader"`
+	// ACLsEnabled is nil if the agent did not report whether ACLs are enabled.
+	ACLsEnabled *bool `json:"aclsEnabled,omitempty"`
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagOutput, "output", outputText,
+		fmt.Sprintf("Output format, one of %q or %q.", outputText, outputJSON))
+
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run checks that the Consul API is reachable and that the cluster has a leader.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+	if c.flagOutput != outputText && c.flagOutput != outputJSON {
+		c.UI.Error(fmt.Sprintf("-output must be one of %q or %q", outputText, outputJSON))
+		return 1
+	}
+
+	consulClient, err := c.http.NamedAPIClient("check")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating Consul client: %s", err))
+		return 1
+	}
+
+	self, err := consulClient.Agent().Self()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reaching the Consul agent: %s", err))
+		return 1
+	}
+	leader, err := consulClient.Status().Leader()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error getting the Consul leader: %s", err))
+		return 1
+	}
+	if leader == "" {
+		c.UI.Error("Consul has no leader")
+		return 1
+	}
+	res := parseSelf(self)
+	res.Leader = leader
+
+	if c.flagOutput == outputJSON {
+		out, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error marshalling result: %s", err))
+			return 1
+		}
+		c.UI.Output(string(out))
+		return 0
+	}
+
+	aclStatus := "unknown"
+	if res.ACLsEnabled != nil {
+		aclStatus = "disabled"
+		if *res.ACLsEnabled {
+			aclStatus = "enabled"
+		}
+	}
+	c.UI.Output(fmt.Sprintf("Node:       %s (server: %t)", res.NodeName, res.Server))
+	c.UI.Output(fmt.Sprintf("Datacenter: %s", res.Datacenter))
+	c.UI.Output(fmt.Sprintf("Version:    %s", res.ServerVersion))
+	c.UI.Output(fmt.Sprintf("Leader:     %s", res.Leader))
+	c.UI.Output(fmt.Sprintf("ACLs:       %s", aclStatus))
+	return 0
+}
+
+// parseSelf reads the result fields from the response of the agent's self endpoint.
+// Fields missing from the response are left empty.
+func parseSelf(self map[string]map[string]interface{}) result {
+	var res result
+	config := self["Config"]
+	res.NodeName, _ = config["NodeName"].(string)
+	res.Datacenter, _ = config["Datacenter"].(string)
+	res.Server, _ = config["Server"].(bool)
+	res.ServerVersion, _ = config["Version"].(string)
+	if enabled, ok := self["DebugConfig"]["ACLsEnabled"].(bool); ok {
+		res.ACLsEnabled = &enabled
+	}
+	return res
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Check connectivity to the Consul API."
+const help = `
+Usage: consul-k8s-control-plane check [options]
+
+  Checks that the Consul API can be reached and that the cluster has a
+  leader, reporting the datacenter, Consul version, leader and whether
+  ACLs are enabled. Exits with a non-zero code if the check fails.
+
+`
@@ -0,0 +1,87 @@
+package check
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-output", "yaml"})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), `-output must be one of "text" or "json"`)
+}
+
+func TestRun_Unreachable(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-http-addr", "127.0.0.1:1"})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), "Error reaching the Consul agent")
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+
+	t.Run("text", func(t *testing.T) {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		code := cmd.Run([]string{"-http-addr", server.HTTPAddr})
+		require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+		output := ui.OutputWriter.String()
+		require.Contains(t, output, "Datacenter: dc1")
+		require.Regexp(t, `Leader:\s+\S+`, output)
+		require.Contains(t, output, "ACLs:       disabled")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		code := cmd.Run([]string{"-http-addr", server.HTTPAddr, "-output", "json"})
+		require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+		var res result
+		require.NoError(t, json.Unmarshal([]byte(ui.OutputWriter.String()), &res))
+		require.NotEmpty(t, res.Leader)
+		require.Equal(t, "dc1", res.Datacenter)
+		require.True(t, res.Server)
+		require.NotEmpty(t, res.ServerVersion)
+	})
+}
+
+func TestParseSelf(t *testing.T) {
+	t.Parallel()
+	res := parseSelf(map[string]map[string]interface{}{
+		"Config": {
+			"NodeName":   "node1",
+			"Datacenter": "dc2",
+			"Server":     false,
+			"Version":    "1.10.3",
+		},
+		"DebugConfig": {
+			"ACLsEnabled": true,
+		},
+	})
+	require.Equal(t, "node1", res.NodeName)
+	require.Equal(t, "dc2", res.Datacenter)
+	require.False(t, res.Server)
+	require.Equal(t, "1.10.3", res.ServerVersion)
+	require.NotNil(t, res.ACLsEnabled)
+	require.True(t, *res.ACLsEnabled)
+
+	// ACL status is unknown when the agent does not report it.
+	res = parseSelf(map[string]map[string]interface{}{})
+	require.Nil(t, res.ACLsEnabled)
+}
@@ -2,6 +2,9 @@
 package common
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -126,3 +129,27 @@ func GetResolvedServerAddresses(serverAddresses []string, providers map[string]d
 	}
 	return godiscover.ConsulServerAddresses(serverAddresses[0], providers, logger)
 }
+
+// GossipKeyFingerprint returns a short, non-reversible identifier for a gossip
+// encryption key so that keys can be referred to in output and logs without
+// exposing the key material.
+func GossipKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// ValidateGossipKey returns an error if key is not a valid gossip encryption
+// key, i.e. the base64 encoding of 16, 24 or 32 bytes. The error never
+// contains the key material.
+func ValidateGossipKey(key string) error {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("gossip key is not valid base64: %s", err)
+	}
+	switch len(decoded) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("gossip key must be 16, 24 or 32 bytes, got %d bytes", len(decoded))
+	}
+}
@@ -211,6 +211,40 @@ func TestGetResolvedServerAddresses(t *testing.T) {
 	}
 }
 
+func TestGossipKeyFingerprint(t *testing.T) {
+	t.Parallel()
+	key := "Ib6wrnOmO/5kV1Px5O5DXqcoa0Il/3AR7aZSIk0hUAE="
+	fingerprint := GossipKeyFingerprint(key)
+	require.Len(t, fingerprint, 16)
+	require.NotContains(t, key, fingerprint)
+	require.Equal(t, fingerprint, GossipKeyFingerprint(key))
+	require.NotEqual(t, fingerprint, GossipKeyFingerprint("8UkJdcYzwbl1OpW3aAbI6Lwt9pRwNqbK1PUXX0Udb+Y="))
+}
+
+func TestValidateGossipKey(t *testing.T) {
+	t.Parallel()
+	valid := []string{
+		"Ib6wrnOmO/5kV1Px5O5DXqcoa0Il/3AR7aZSIk0hUAE=", // 32 bytes
+		"AAECAwQFBgcICQoLDA0ODxAREhMUFRYX",             // 24 bytes
+		"AAECAwQFBgcICQoLDA0ODw==",                     // 16 bytes
+	}
+	for _, key := range valid {
+		require.NoError(t, ValidateGossipKey(key), key)
+	}
+
+	invalid := map[string]string{
+		"":                             "gossip key must be 16, 24 or 32 bytes, got 0 bytes",
+		"not a key":                    "gossip key is not valid base64",
+		"AAECAwQFBgcICQoLDA0ODxA=":     "gossip key must be 16, 24 or 32 bytes, got 17 bytes",
+		"Ib6wrnOmO/5kV1Px5O5DXqcoa0Il": "gossip key must be 16, 24 or 32 bytes, got 21 bytes",
+	}
+	for key, expErr := range invalid {
+		err := ValidateGossipKey(key)
+		require.Error(t, err, key)
+		require.Contains(t, err.Error(), expErr)
+	}
+}
+
 // startMockServer starts an httptest server used to mock a Consul server's
 // /v1/acl/login endpoint. apiCallCounter will be incremented on each call to /v1/acl/login.
 // It returns a consul client pointing at the server.
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// defaultMetricsServerShutdownTimeout is used when MetricsServer.ShutdownTimeout is not set.
+const defaultMetricsServerShutdownTimeout = 5 * time.Second
+
+// MetricsServer is an HTTP server used by sidecar commands to serve metrics.
+// It should be started with Start and stopped with Shutdown.
+type MetricsServer struct {
+	// Addr is the address the server listens on, e.g. "127.0.0.1:20100".
+	Addr string
+
+	// Handlers maps the paths served by the server to their handlers.
+	Handlers map[string]http.HandlerFunc
+
+	// Logger is used to log the server's lifecycle.
+	Logger hclog.Logger
+
+	// ShutdownTimeout is how long Shutdown waits for open connections to
+	// become idle before giving up. Defaults to 5 seconds.
+	ShutdownTimeout time.Duration
+
+	server *http.Server
+}
+
+// Start runs the server in a goroutine. The returned channel receives an
+// error if the server exits for any reason other than Shutdown being called.
+func (s *MetricsServer) Start() <-chan error {
+	mux := http.NewServeMux()
+	for path, handler := range s.Handlers {
+		mux.HandleFunc(path, handler)
+	}
+	s.server = &http.Server{Addr: s.Addr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	s.Logger.Info("Running metrics server", "addr", s.Addr)
+	go func() {
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+	return errCh
+}
+
+// Shutdown gracefully shuts down the server. server.Shutdown() waits
+// indefinitely for connections to turn idle, so to avoid potentially waiting
+// forever it is bounded by ShutdownTimeout.
+func (s *MetricsServer) Shutdown() error {
+	if s.server == nil {
+		return nil
+	}
+	timeout := s.ShutdownTimeout
+	if timeout == 0 {
+		timeout = defaultMetricsServerShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	s.Logger.Info("Attempting to gracefully shut down metrics server")
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		s.Logger.Error("Metrics server shutdown failed", "err", err)
+		return err
+	}
+	s.Logger.Info("Metrics server has been shut down")
+	return nil
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/freeport"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsServer(t *testing.T) {
+	t.Parallel()
+	port := freeport.MustTake(1)[0]
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	server := &MetricsServer{
+		Addr: addr,
+		Handlers: map[string]http.HandlerFunc{
+			"/metrics": func(rw http.ResponseWriter, _ *http.Request) {
+				_, _ = rw.Write([]byte("some metrics\n"))
+			},
+		},
+		Logger: hclog.NewNullLogger(),
+	}
+	errCh := server.Start()
+
+	retry.Run(t, func(r *retry.R) {
+		resp, err := http.Get(fmt.Sprintf("http://%s/metrics", addr))
+		require.NoError(r, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(r, err)
+		require.Equal(r, "some metrics\n", string(body))
+	})
+
+	// Unregistered paths are not served.
+	resp, err := http.Get(fmt.Sprintf("http://%s/other", addr))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	require.NoError(t, server.Shutdown())
+	select {
+	case err := <-errCh:
+		require.Failf(t, "unexpected server error", "%s", err)
+	default:
+	}
+	_, err = http.Get(fmt.Sprintf("http://%s/metrics", addr))
+	require.Error(t, err)
+}
+
+func TestMetricsServer_StartError(t *testing.T) {
+	t.Parallel()
+	port := freeport.MustTake(1)[0]
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+	first := &MetricsServer{Addr: addr, Logger: hclog.NewNullLogger()}
+	first.Start()
+	defer first.Shutdown()
+
+	// Wait for the first server to bind the port.
+	retry.Run(t, func(r *retry.R) {
+		resp, err := http.Get(fmt.Sprintf("http://%s/", addr))
+		require.NoError(r, err)
+		resp.Body.Close()
+	})
+
+	// A second server on the same address reports the listen error.
+	second := &MetricsServer{Addr: addr, Logger: hclog.NewNullLogger()}
+	require.Error(t, <-second.Start())
+}
+
+func TestMetricsServer_ShutdownWithoutStart(t *testing.T) {
+	t.Parallel()
+	server := &MetricsServer{Logger: hclog.NewNullLogger()}
+	require.NoError(t, server.Shutdown())
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -23,6 +24,7 @@ import (
 
 const metricsServerShutdownTimeout = 5 * time.Second
 const envoyMetricsAddr = "http://127.0.0.1:19000/stats/prometheus"
+const envoyConfigDumpTimeout = 10 * time.Second
 
 type Command struct {
 	UI cli.Ui
@@ -41,6 +43,12 @@ type Command struct {
 	flagMergedMetricsPort    string
 	flagServiceMetricsPort   string
 	flagServiceMetricsPath   string
+	flagServiceName          string
+
+	// Flags to dump the Envoy config
+	flagDumpEnvoyConfig       bool
+	flagDumpEnvoyConfigOutput string
+	flagEnvoyAdminPort        string
 
 	envoyMetricsGetter   metricsGetter
 	serviceMetricsGetter metricsGetter
@@ -63,7 +71,7 @@ func (c *Command) init() {
 	c.flagSet = flag.NewFlagSet("", flag.ContinueOnError)
 	c.flagSet.BoolVar(&c.flagEnableServiceRegistration, "enable-service-registration", true, "Enables consul sidecar to register the service with consul every sync period. Defaults to true.")
 	c.flagSet.StringVar(&c.flagServiceConfig, "service-config", "", "Path to the service config file")
-	c.flagSet.StringVar(&c.flagConsulBinary, "consul-binary", "consul", "Path to a consul binary")
+	c.flagSet.StringVar(&c.flagConsulBinary, "consul-binary", "consul", "Path to a consul binary, or its name to look it up in PATH. Relative paths are resolved against the working directory.")
 	c.flagSet.DurationVar(&c.flagSyncPeriod, "sync-period", 10*time.Second, "Time between syncing the service registration. Defaults to 10s.")
 	c.flagSet.StringVar(&c.flagLogLevel, "log-level", "info",
 		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
@@ -81,6 +89,11 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagMergedMetricsPort, "merged-metrics-port", "20100", "Port to serve merged Envoy and application metrics. Defaults to 20100.")
 	c.flagSet.StringVar(&c.flagServiceMetricsPort, "service-metrics-port", "0", "Port where application metrics are being served. Defaults to 0.")
 	c.flagSet.StringVar(&c.flagServiceMetricsPath, "service-metrics-path", "/metrics", "Path where application metrics are being served. Defaults to /metrics.")
+	c.flagSet.StringVar(&c.flagServiceName, "service-name", "", "Name of the service the sidecar runs for. If set, a consul_k8s_sidecar_info metric with a service label is added to the merged metrics.")
+
+	c.flagSet.BoolVar(&c.flagDumpEnvoyConfig, "dump-envoy-config", false, "Write Envoy's config dump from its admin endpoint to -dump-envoy-config-output and exit. All other flags except -envoy-admin-port are ignored. Defaults to false.")
+	c.flagSet.StringVar(&c.flagDumpEnvoyConfigOutput, "dump-envoy-config-output", "", "File to write the Envoy config dump to. Defaults to stdout.")
+	c.flagSet.StringVar(&c.flagEnvoyAdminPort, "envoy-admin-port", "19000", "Port of the Envoy admin endpoint used by -dump-envoy-config. Defaults to 19000.")
 	c.help = flags.Usage(help, c.flagSet)
 	c.http = &flags.HTTPFlags{}
 	flags.Merge(c.flagSet, c.http.Flags())
@@ -106,6 +119,14 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
+	if c.flagDumpEnvoyConfig {
+		if err := c.dumpEnvoyConfig(); err != nil {
+			c.UI.Error("Error: " + err.Error())
+			return 1
+		}
+		return 0
+	}
+
 	err := c.validateFlags()
 	if err != nil {
 		c.UI.Error("Error: " + err.Error())
@@ -129,6 +150,7 @@ func (c *Command) Run(args []string) int {
 		"merged-metrics-port", c.flagMergedMetricsPort,
 		"service-metrics-port", c.flagServiceMetricsPort,
 		"service-metrics-path", c.flagServiceMetricsPath,
+		"service-name", c.flagServiceName,
 	)
 
 	// signalCtx that we pass in to the main work loop, signal handling is handled in another thread
@@ -144,20 +166,13 @@ func (c *Command) Run(args []string) int {
 	// If metrics merging is enabled, run a merged metrics server in a goroutine
 	// that serves Envoy sidecar metrics and Connect service metrics. The merged
 	// metrics server will be shut down when a signal is received by the main
-	// for loop using shutdownMetricsServer().
-	var server *http.Server
-	srvExitCh := make(chan error)
+	// for loop using server.Shutdown().
+	var server *common.MetricsServer
+	var srvExitCh <-chan error
 	if c.flagEnableMetricsMerging {
 		c.logger.Info("Metrics is enabled, creating merged metrics server.")
 		server = c.createMergedMetricsServer()
-
-		// Run the merged metrics server.
-		c.logger.Info("Running merged metrics server.")
-		go func() {
-			if err = server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				srvExitCh <- err
-			}
-		}()
+		srvExitCh = server.Start()
 	}
 
 	// The work loop for re-registering the service. We continually re-register
@@ -172,16 +187,7 @@ func (c *Command) Run(args []string) int {
 
 		go func() {
 			for {
-				start := time.Now()
-				cmd := exec.CommandContext(signalCtx, c.flagConsulBinary, c.consulCommand...)
-
-				// Run the command and record the stdout and stderr output.
-				output, err := cmd.CombinedOutput()
-				if err != nil {
-					c.logger.Error("failed to sync service", "output", strings.TrimSpace(string(output)), "err", err, "duration", time.Since(start))
-				} else {
-					c.logger.Info("successfully synced service", "output", strings.TrimSpace(string(output)), "duration", time.Since(start))
-				}
+				c.syncService(signalCtx)
 				select {
 				// Re-loop after syncPeriod or exit if we receive interrupt or terminate signals.
 				case <-time.After(c.flagSyncPeriod):
@@ -200,8 +206,7 @@ func (c *Command) Run(args []string) int {
 		// to gracefully shutdown as well if it has been enabled. This can
 		// take up to metricsServerShutdownTimeout seconds.
 		if c.flagEnableMetricsMerging {
-			c.logger.Info("Attempting to shut down metrics server.")
-			c.shutdownMetricsServer(server)
+			_ = server.Shutdown()
 		}
 		return 0
 	case err := <-srvExitCh:
@@ -211,35 +216,27 @@ func (c *Command) Run(args []string) int {
 
 }
 
-// shutdownMetricsServer handles gracefully shutting down the server. This will
-// call server.Shutdown(), which will indefinitely wait for connections to turn
-// idle. To avoid potentially waiting forever, we pass a context to
-// server.Shutdown() that will timeout in metricsServerShutdownTimeout (5) seconds.
-func (c *Command) shutdownMetricsServer(server *http.Server) {
-	// The shutdownCancelFunc will be unused since it is unnecessary to call it as we
-	// are already about to call shutdown with a timeout. We'd only need to
-	// shutdownCancelFunc if we needed to trigger something to happen when the
-	// shutdownCancelFunc is called, which we do not. The reason for not
-	// discarding it with _ is for the go vet check.
-	shutdownCtx, shutdownCancelFunc := context.WithTimeout(context.Background(), metricsServerShutdownTimeout)
-	defer shutdownCancelFunc()
-
-	c.logger.Info("Merged metrics server exists, attempting to gracefully shut down server")
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		c.logger.Error(fmt.Sprintf("Server shutdown failed: %s", err))
-		return
+// syncService runs the consul command that registers the service and logs its
+// result. If ctx is canceled while the command runs, the command is killed and
+// the sync is logged as interrupted by the shutdown rather than as a failure.
+func (c *Command) syncService(ctx context.Context) {
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, c.flagConsulBinary, c.consulCommand...)
+
+	// Run the command and record the stdout and stderr output.
+	output, err := cmd.CombinedOutput()
+	switch {
+	case ctx.Err() != nil:
+		c.logger.Info("service sync interrupted by shutdown", "duration", time.Since(start))
+	case err != nil:
+		c.logger.Error("failed to sync service", "output", strings.TrimSpace(string(output)), "err", err, "duration", time.Since(start))
+	default:
+		c.logger.Info("successfully synced service", "output", strings.TrimSpace(string(output)), "duration", time.Since(start))
 	}
-	c.logger.Info("Server has been shut down")
 }
 
 // createMergedMetricsServer sets up the merged metrics server.
-func (c *Command) createMergedMetricsServer() *http.Server {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/stats/prometheus", c.mergedMetricsHandler)
-
-	mergedMetricsServerAddr := fmt.Sprintf("127.0.0.1:%s", c.flagMergedMetricsPort)
-	server := &http.Server{Addr: mergedMetricsServerAddr, Handler: mux}
-
+func (c *Command) createMergedMetricsServer() *common.MetricsServer {
 	// The default http.Client timeout is indefinite, so adding a timeout makes
 	// sure that requests don't hang.
 	client := &http.Client{
@@ -249,7 +246,14 @@ func (c *Command) createMergedMetricsServer() *http.Server {
 	c.envoyMetricsGetter = client
 	c.serviceMetricsGetter = client
 
-	return server
+	return &common.MetricsServer{
+		Addr: fmt.Sprintf("127.0.0.1:%s", c.flagMergedMetricsPort),
+		Handlers: map[string]http.HandlerFunc{
+			"/stats/prometheus": c.mergedMetricsHandler,
+		},
+		Logger:          c.logger,
+		ShutdownTimeout: metricsServerShutdownTimeout,
+	}
 }
 
 // mergedMetricsHandler has the logic to append both Envoy and service metrics
@@ -281,6 +285,13 @@ func (c *Command) mergedMetricsHandler(rw http.ResponseWriter, _ *http.Request)
 		c.logger.Error(fmt.Sprintf("Error writing envoy metrics body: %s", err.Error()))
 	}
 
+	if c.flagServiceName != "" {
+		_, err = rw.Write([]byte(sidecarInfoMetric(c.flagServiceName)))
+		if err != nil {
+			c.logger.Error(fmt.Sprintf("Error writing sidecar info metric: %s", err.Error()))
+		}
+	}
+
 	serviceMetricsAddr := fmt.Sprintf("http://127.0.0.1:%s%s", c.flagServiceMetricsPort, c.flagServiceMetricsPath)
 	serviceMetrics, err := c.serviceMetricsGetter.Get(serviceMetricsAddr)
 	if err != nil {
@@ -298,6 +309,12 @@ func (c *Command) mergedMetricsHandler(rw http.ResponseWriter, _ *http.Request)
 			c.logger.Error(fmt.Sprintf("Error closing service metrics body: %s", err.Error()))
 		}
 	}()
+	// A non-200 response body isn't in the Prometheus format, so writing it
+	// would break scraping of the Envoy metrics too.
+	if serviceMetrics.StatusCode != http.StatusOK {
+		c.logger.Warn(fmt.Sprintf("Skipping service metrics: %s returned status %d", serviceMetricsAddr, serviceMetrics.StatusCode))
+		return
+	}
 	serviceMetricsBody, err := ioutil.ReadAll(serviceMetrics.Body)
 	if err != nil {
 		c.logger.Error(fmt.Sprintf("Couldn't read service metrics: %s", err.Error()))
@@ -309,6 +326,45 @@ func (c *Command) mergedMetricsHandler(rw http.ResponseWriter, _ *http.Request)
 	}
 }
 
+// dumpEnvoyConfig fetches the config dump from Envoy's admin endpoint and
+// writes it to -dump-envoy-config-output, or to the UI if it is not set.
+func (c *Command) dumpEnvoyConfig() error {
+	client := &http.Client{
+		Timeout: envoyConfigDumpTimeout,
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%s/config_dump", c.flagEnvoyAdminPort)
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("fetching Envoy config dump: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading Envoy config dump: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching Envoy config dump from %s: unexpected status %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if c.flagDumpEnvoyConfigOutput == "" {
+		c.UI.Output(string(body))
+		return nil
+	}
+	if err := ioutil.WriteFile(c.flagDumpEnvoyConfigOutput, body, 0644); err != nil {
+		return fmt.Errorf("writing Envoy config dump to %q: %s", c.flagDumpEnvoyConfigOutput, err)
+	}
+	c.UI.Info(fmt.Sprintf("Envoy config dump written to %s", c.flagDumpEnvoyConfigOutput))
+	return nil
+}
+
+// sidecarInfoMetric returns a Prometheus gauge that identifies the service
+// the merged metrics belong to.
+func sidecarInfoMetric(serviceName string) string {
+	return "# HELP consul_k8s_sidecar_info Information about the service this consul-sidecar runs for.\n" +
+		"# TYPE consul_k8s_sidecar_info gauge\n" +
+		fmt.Sprintf("consul_k8s_sidecar_info{service=%q} 1\n", serviceName)
+}
+
 // validateFlags validates the flags.
 func (c *Command) validateFlags() error {
 	if !c.flagEnableServiceRegistration && !c.flagEnableMetricsMerging {
@@ -331,14 +387,48 @@ func (c *Command) validateFlags() error {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("-service-config file %q not found", c.flagServiceConfig)
 		}
-		_, err = exec.LookPath(c.flagConsulBinary)
+		consulBinary, err := resolveConsulBinary(c.flagConsulBinary)
 		if err != nil {
-			return fmt.Errorf("-consul-binary %q not found: %s", c.flagConsulBinary, err)
+			return err
 		}
+		c.flagConsulBinary = consulBinary
 	}
 	return nil
 }
 
+// resolveConsulBinary returns the path of the consul binary to run. A name
+// without a path separator is looked up in PATH. Any other path, absolute or
+// relative to the working directory, must be an executable file and is
+// returned as an absolute path.
+func resolveConsulBinary(binary string) (string, error) {
+	if !strings.ContainsRune(binary, os.PathSeparator) {
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			return "", fmt.Errorf("-consul-binary %q not found in PATH: %s", binary, err)
+		}
+		return path, nil
+	}
+
+	path, err := filepath.Abs(binary)
+	if err != nil {
+		return "", fmt.Errorf("-consul-binary %q could not be resolved: %s", binary, err)
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("-consul-binary %q not found", binary)
+	}
+	if err != nil {
+		return "", fmt.Errorf("-consul-binary %q could not be read: %s", binary, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("-consul-binary %q is a directory", binary)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("-consul-binary %q is not executable", binary)
+	}
+	return path, nil
+}
+
 // parseConsulFlags creates Consul client command flags
 // from command's HTTP flags and returns them as an array of strings.
 func (c *Command) parseConsulFlags() []string {
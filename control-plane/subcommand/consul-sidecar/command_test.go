@@ -2,10 +2,13 @@ package consulsidecar
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -218,18 +221,23 @@ type envoyMetrics struct {
 }
 
 func (em *envoyMetrics) Get(url string) (resp *http.Response, err error) {
-	response := &http.Response{}
+	response := &http.Response{StatusCode: http.StatusOK}
 	response.Body = ioutil.NopCloser(bytes.NewReader([]byte("envoy metrics\n")))
 	return response, nil
 }
 
 type serviceMetrics struct {
-	url string
+	url        string
+	statusCode int
 }
 
 func (sm *serviceMetrics) Get(url string) (resp *http.Response, err error) {
-	response := &http.Response{}
-	response.Body = ioutil.NopCloser(bytes.NewReader([]byte("service metrics\n")))
+	response := &http.Response{StatusCode: sm.statusCode}
+	body := "service metrics\n"
+	if sm.statusCode != http.StatusOK {
+		body = "Internal Server Error\n"
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader([]byte(body)))
 	sm.url = url
 	return response, nil
 }
@@ -239,6 +247,8 @@ func TestMergedMetricsServer(t *testing.T) {
 		name                    string
 		runEnvoyMetricsServer   bool
 		runServiceMetricsServer bool
+		serviceMetricsStatus    int
+		serviceName             string
 		expectedOutput          string
 	}{
 		{
@@ -253,12 +263,30 @@ func TestMergedMetricsServer(t *testing.T) {
 			runServiceMetricsServer: false,
 			expectedOutput:          "envoy metrics\n",
 		},
+		{
+			name:                    "service metrics returns an error status",
+			runEnvoyMetricsServer:   true,
+			runServiceMetricsServer: true,
+			serviceMetricsStatus:    http.StatusInternalServerError,
+			expectedOutput:          "envoy metrics\n",
+		},
 		{
 			name:                    "no envoy metrics",
 			runEnvoyMetricsServer:   false,
 			runServiceMetricsServer: true,
 			expectedOutput:          "",
 		},
+		{
+			name:                    "service name adds info metric",
+			runEnvoyMetricsServer:   true,
+			runServiceMetricsServer: true,
+			serviceName:             "web",
+			expectedOutput: "envoy metrics\n" +
+				"# HELP consul_k8s_sidecar_info Information about the service this consul-sidecar runs for.\n" +
+				"# TYPE consul_k8s_sidecar_info gauge\n" +
+				"consul_k8s_sidecar_info{service=\"web\"} 1\n" +
+				"service metrics\n",
+		},
 	}
 
 	for _, c := range cases {
@@ -271,6 +299,7 @@ func TestMergedMetricsServer(t *testing.T) {
 				flagMergedMetricsPort:    fmt.Sprint(randomPorts[0]),
 				flagServiceMetricsPort:   fmt.Sprint(randomPorts[1]),
 				flagServiceMetricsPath:   "/metrics",
+				flagServiceName:          c.serviceName,
 				logger:                   hclog.Default(),
 			}
 
@@ -279,7 +308,10 @@ func TestMergedMetricsServer(t *testing.T) {
 			// Override the cmd's envoyMetricsGetter and serviceMetricsGetter
 			// with stubs.
 			em := &envoyMetrics{}
-			sm := &serviceMetrics{}
+			sm := &serviceMetrics{statusCode: http.StatusOK}
+			if c.serviceMetricsStatus != 0 {
+				sm.statusCode = c.serviceMetricsStatus
+			}
 			if c.runEnvoyMetricsServer {
 				cmd.envoyMetricsGetter = em
 			}
@@ -287,10 +319,8 @@ func TestMergedMetricsServer(t *testing.T) {
 				cmd.serviceMetricsGetter = sm
 			}
 
-			go func() {
-				_ = server.ListenAndServe()
-			}()
-			defer server.Close()
+			server.Start()
+			defer server.Shutdown()
 
 			// Call the merged metrics endpoint and make assertions on the
 			// output. retry.Run times out in 7 seconds, which should give the
@@ -388,6 +418,121 @@ func TestRun_FlagValidation_ConsulBinaryMissing(t *testing.T) {
 	require.Contains(t, ui.ErrorWriter.String(), "-consul-binary \"/not/a/valid/path\" not found")
 }
 
+func TestResolveConsulBinary(t *testing.T) {
+	t.Parallel()
+
+	tmpDir, err := ioutil.TempDir("", "consul-binary")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	executable := filepath.Join(tmpDir, "consul")
+	require.NoError(t, ioutil.WriteFile(executable, []byte("#!/bin/sh\n"), 0755))
+	notExecutable := filepath.Join(tmpDir, "not-executable")
+	require.NoError(t, ioutil.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0644))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	relative, err := filepath.Rel(wd, executable)
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		binary  string
+		expPath string
+		expErr  string
+	}{
+		"absolute path": {
+			binary:  executable,
+			expPath: executable,
+		},
+		"path relative to the working directory": {
+			binary:  relative,
+			expPath: executable,
+		},
+		"not found": {
+			binary: filepath.Join(tmpDir, "does-not-exist"),
+			expErr: fmt.Sprintf("-consul-binary %q not found", filepath.Join(tmpDir, "does-not-exist")),
+		},
+		"not executable": {
+			binary: notExecutable,
+			expErr: fmt.Sprintf("-consul-binary %q is not executable", notExecutable),
+		},
+		"directory": {
+			binary: tmpDir,
+			expErr: fmt.Sprintf("-consul-binary %q is a directory", tmpDir),
+		},
+		"not in PATH": {
+			binary: "consul-binary-that-does-not-exist",
+			expErr: `-consul-binary "consul-binary-that-does-not-exist" not found in PATH`,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			path, err := resolveConsulBinary(c.binary)
+			if c.expErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expPath, path)
+		})
+	}
+}
+
+func TestRun_DumpEnvoyConfig(t *testing.T) {
+	t.Parallel()
+
+	configDump := `{"configs": [{"@type": "type.googleapis.com/envoy.admin.v3.BootstrapConfigDump"}]}`
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/config_dump" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(configDump))
+	}))
+	defer admin.Close()
+	adminURL, err := url.Parse(admin.URL)
+	require.NoError(t, err)
+
+	tmpDir, err := ioutil.TempDir("", "envoy-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	output := filepath.Join(tmpDir, "config_dump.json")
+
+	// Write the config dump to a file.
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI: ui,
+	}
+	responseCode := cmd.Run([]string{"-dump-envoy-config", "-envoy-admin-port", adminURL.Port(), "-dump-envoy-config-output", output})
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+	written, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	require.Equal(t, configDump, string(written))
+
+	// Write the config dump to stdout.
+	ui = cli.NewMockUi()
+	cmd = Command{
+		UI: ui,
+	}
+	responseCode = cmd.Run([]string{"-dump-envoy-config", "-envoy-admin-port", adminURL.Port()})
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+	require.Equal(t, configDump+"\n", ui.OutputWriter.String())
+}
+
+func TestRun_DumpEnvoyConfig_AdminUnavailable(t *testing.T) {
+	t.Parallel()
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI: ui,
+	}
+	port := freeport.MustTake(1)[0]
+	responseCode := cmd.Run([]string{"-dump-envoy-config", "-envoy-admin-port", fmt.Sprint(port)})
+	require.Equal(t, 1, responseCode)
+	require.Contains(t, ui.ErrorWriter.String(), "fetching Envoy config dump")
+}
+
 func TestRun_FlagValidation_InvalidLogLevel(t *testing.T) {
 	t.Parallel()
 
@@ -443,6 +588,54 @@ func TestRun_ServicesRegistration(t *testing.T) {
 	})
 }
 
+// Test that canceling the context while the consul command runs is logged as
+// a shutdown rather than as a failed sync.
+func TestSyncService_Shutdown(t *testing.T) {
+	t.Parallel()
+	tmpDir, err := ioutil.TempDir("", "consul-binary")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	consulBinary := filepath.Join(tmpDir, "consul")
+	require.NoError(t, ioutil.WriteFile(consulBinary, []byte("#!/bin/sh\nexec sleep 10\n"), 0755))
+
+	var logs bytes.Buffer
+	cmd := Command{
+		flagConsulBinary: consulBinary,
+		consulCommand:    []string{"services", "register"},
+		logger:           hclog.New(&hclog.LoggerOptions{Output: &logs}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	cmd.syncService(ctx)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	require.Contains(t, logs.String(), "service sync interrupted by shutdown")
+	require.NotContains(t, logs.String(), "failed to sync service")
+}
+
+// Test that a failing consul command is logged as a failed sync.
+func TestSyncService_Failure(t *testing.T) {
+	t.Parallel()
+	tmpDir, err := ioutil.TempDir("", "consul-binary")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	consulBinary := filepath.Join(tmpDir, "consul")
+	require.NoError(t, ioutil.WriteFile(consulBinary, []byte("#!/bin/sh\necho boom\nexit 1\n"), 0755))
+
+	var logs bytes.Buffer
+	cmd := Command{
+		flagConsulBinary: consulBinary,
+		consulCommand:    []string{"services", "register"},
+		logger:           hclog.New(&hclog.LoggerOptions{Output: &logs}),
+	}
+	cmd.syncService(context.Background())
+
+	require.Contains(t, logs.String(), "failed to sync service")
+	require.Contains(t, logs.String(), "boom")
+}
+
 // Test that we register services when the Consul agent is down at first.
 func TestRun_ServicesRegistration_ConsulDown(t *testing.T) {
 	t.Parallel()
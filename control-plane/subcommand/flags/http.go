@@ -101,11 +101,17 @@ func (f *HTTPFlags) Partition() string {
 }
 
 func (f *HTTPFlags) APIClient() (*api.Client, error) {
+	return f.NamedAPIClient("")
+}
+
+// NamedAPIClient returns an API client like APIClient that also identifies
+// component in its User-Agent header.
+func (f *HTTPFlags) NamedAPIClient(component string) (*api.Client, error) {
 	c := api.DefaultConfig()
 
 	f.MergeOntoConfig(c)
 
-	return consul.NewClient(c)
+	return consul.NewNamedClient(c, component)
 }
 
 func (f *HTTPFlags) MergeOntoConfig(c *api.Config) {
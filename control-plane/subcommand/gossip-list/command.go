@@ -0,0 +1,167 @@
+package gossiplist
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+
+	flagOutput string
+
+	once sync.Once
+	help string
+}
+
+// keyring is the redacted representation of a single Consul keyring.
+type keyring struct {
+	WAN        bool   `json:"wan"`
+	Datacenter string `json:"datacenter"`
+	Segment    string `json:"segment,omitempty"`
+	NumNodes   int    `json:"numNodes"`
+	Keys       []key  `json:"keys"`
+}
+
+// key identifies a gossip key by its fingerprint rather than its value.
+type key struct {
+	Fingerprint string `json:"fingerprint"`
+	Primary     bool   `json:"primary"`
+	Installed   int    `json:"installed"`
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagOutput, "output", outputText,
+		fmt.Sprintf("Output format, one of %q or %q.", outputText, outputJSON))
+
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run lists the gossip encryption keys installed in every keyring, identifying
+// each key by its fingerprint.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+	if c.flagOutput != outputText && c.flagOutput != outputJSON {
+		c.UI.Error(fmt.Sprintf("-output must be one of %q or %q", outputText, outputJSON))
+		return 1
+	}
+
+	consulClient, err := c.http.NamedAPIClient("gossip-list")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating Consul client: %s", err))
+		return 1
+	}
+
+	responses, err := consulClient.Operator().KeyringList(nil)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error listing gossip keys: %s", err))
+		return 1
+	}
+	keyrings := redact(responses)
+
+	if c.flagOutput == outputJSON {
+		out, err := json.MarshalIndent(keyrings, "", "  ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error marshalling keyrings: %s", err))
+			return 1
+		}
+		c.UI.Output(string(out))
+		return 0
+	}
+
+	for _, k := range keyrings {
+		c.UI.Output(fmt.Sprintf("%s (%d keys, %d nodes):", keyringName(k), len(k.Keys), k.NumNodes))
+		for _, key := range k.Keys {
+			primary := ""
+			if key.Primary {
+				primary = " (primary)"
+			}
+			c.UI.Output(fmt.Sprintf("  %s%s [%d/%d]", key.Fingerprint, primary, key.Installed, k.NumNodes))
+		}
+	}
+	return 0
+}
+
+// redact converts the keyring responses from Consul into keyrings that only
+// contain key fingerprints. Keys are sorted by fingerprint so the output is stable.
+func redact(responses []*api.KeyringResponse) []keyring {
+	var keyrings []keyring
+	for _, resp := range responses {
+		k := keyring{
+			WAN:        resp.WAN,
+			Datacenter: resp.Datacenter,
+			Segment:    resp.Segment,
+			NumNodes:   resp.NumNodes,
+			Keys:       []key{},
+		}
+		for value, installed := range resp.Keys {
+			_, primary := resp.PrimaryKeys[value]
+			k.Keys = append(k.Keys, key{
+				Fingerprint: common.GossipKeyFingerprint(value),
+				Primary:     primary,
+				Installed:   installed,
+			})
+		}
+		sort.Slice(k.Keys, func(i, j int) bool {
+			return k.Keys[i].Fingerprint < k.Keys[j].Fingerprint
+		})
+		keyrings = append(keyrings, k)
+	}
+	return keyrings
+}
+
+// keyringName returns a human readable name for the keyring, e.g. "LAN dc1 (segment alpha)".
+func keyringName(k keyring) string {
+	pool := "LAN"
+	if k.WAN {
+		pool = "WAN"
+	}
+	parts := []string{pool, k.Datacenter}
+	if k.Segment != "" {
+		parts = append(parts, fmt.Sprintf("(segment %s)", k.Segment))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "List the gossip encryption keyring."
+const help = `
+Usage: consul-k8s-control-plane gossip list [options]
+
+  Lists the gossip encryption keys installed in each keyring. Keys are
+  identified by a fingerprint so the key material is never printed.
+
+`
@@ -0,0 +1,96 @@
+package gossiplist
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	primaryKey   = "Ib6wrnOmO/5kV1Px5O5DXqcoa0Il/3AR7aZSIk0hUAE="
+	secondaryKey = "8UkJdcYzwbl1OpW3aAbI6Lwt9pRwNqbK1PUXX0Udb+Y="
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-output", "yaml"})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), `-output must be one of "text" or "json"`)
+}
+
+func TestRun_ListsKeys(t *testing.T) {
+	t.Parallel()
+	server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.Encrypt = primaryKey
+	})
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+
+	client, err := api.NewClient(&api.Config{Address: server.HTTPAddr})
+	require.NoError(t, err)
+	require.NoError(t, client.Operator().KeyringInstall(secondaryKey, nil))
+
+	t.Run("text", func(t *testing.T) {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		code := cmd.Run([]string{"-http-addr", server.HTTPAddr})
+		require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+		output := ui.OutputWriter.String()
+		require.Contains(t, output, "(2 keys, 1 nodes)")
+		require.Contains(t, output, common.GossipKeyFingerprint(primaryKey)+" (primary)")
+		require.Contains(t, output, common.GossipKeyFingerprint(secondaryKey))
+		require.NotContains(t, output, primaryKey)
+		require.NotContains(t, output, secondaryKey)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		code := cmd.Run([]string{"-http-addr", server.HTTPAddr, "-output", "json"})
+		require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+		var keyrings []keyring
+		require.NoError(t, json.Unmarshal([]byte(ui.OutputWriter.String()), &keyrings))
+		require.NotEmpty(t, keyrings)
+		for _, k := range keyrings {
+			require.Len(t, k.Keys, 2)
+		}
+	})
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+	keyrings := redact([]*api.KeyringResponse{
+		{
+			Datacenter:  "dc1",
+			Segment:     "alpha",
+			NumNodes:    3,
+			Keys:        map[string]int{primaryKey: 3, secondaryKey: 1},
+			PrimaryKeys: map[string]int{primaryKey: 3},
+		},
+	})
+	require.Len(t, keyrings, 1)
+	require.Equal(t, "LAN dc1 (segment alpha)", keyringName(keyrings[0]))
+	require.Len(t, keyrings[0].Keys, 2)
+	for _, k := range keyrings[0].Keys {
+		switch k.Fingerprint {
+		case common.GossipKeyFingerprint(primaryKey):
+			require.True(t, k.Primary)
+			require.Equal(t, 3, k.Installed)
+		case common.GossipKeyFingerprint(secondaryKey):
+			require.False(t, k.Primary)
+			require.Equal(t, 1, k.Installed)
+		default:
+			t.Fatalf("unexpected fingerprint %s", k.Fingerprint)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package gossiprotate
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/control-plane/consul"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+)
+
+// primaryKeyRetry bounds how long to wait for the new key to become the
+// primary key on every node before removing the old keys.
+var primaryKeyRetry = consul.RetryConfig{Attempts: 60, Interval: time.Second}
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+
+	flagKey      string
+	flagKeyFile  string
+	flagDryRun   bool
+	flagLogLevel string
+	flagLogJSON  bool
+
+	log  hclog.Logger
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagKey, "key", "",
+		"The new base64-encoded gossip encryption key. Either -key or -key-file must be set.")
+	c.flags.StringVar(&c.flagKeyFile, "key-file", "",
+		"Path to a file containing the new base64-encoded gossip encryption key.")
+	c.flags.BoolVar(&c.flagDryRun, "dry-run", false,
+		"Print the operations the rotation would perform on the current keyring without performing them.")
+	c.flags.StringVar(&c.flagLogLevel, "log-level", "info",
+		"Log verbosity level. Supported values (in order of detail) are \"trace\", "+
+			"\"debug\", \"info\", \"warn\", and \"error\".")
+	c.flags.BoolVar(&c.flagLogJSON, "log-json", false,
+		"Enable or disable JSON output format for logging.")
+
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run installs the new gossip key into the keyring, makes it the primary key
+// and removes every other key.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+	if err := c.validateFlags(); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var err error
+	c.log, err = common.Logger(c.flagLogLevel, c.flagLogJSON)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	key, err := c.readKey()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if err := common.ValidateGossipKey(key); err != nil {
+		c.UI.Error(fmt.Sprintf("Invalid gossip key: %s", err))
+		return 1
+	}
+
+	consulClient, err := c.http.NamedAPIClient("gossip-rotate")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating Consul client: %s", err))
+		return 1
+	}
+
+	if c.flagDryRun {
+		keyrings, err := consulClient.Operator().KeyringList(nil)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing gossip keys: %s", err))
+			return 1
+		}
+		plan := rotationPlan(keyrings, key)
+		if len(plan) == 0 {
+			c.UI.Info("Dry run: the gossip encryption key is already the only key, nothing to do.")
+			return 0
+		}
+		c.UI.Info("Dry run: rotating the gossip encryption key would:")
+		for _, op := range plan {
+			c.UI.Output("  " + op)
+		}
+		return 0
+	}
+
+	if err := installKey(consulClient, key, primaryKeyRetry, c.log); err != nil {
+		c.UI.Error(fmt.Sprintf("Error rotating gossip key: %s", err))
+		return 1
+	}
+	c.UI.Info("Gossip encryption key rotated successfully.")
+	return 0
+}
+
+func (c *Command) validateFlags() error {
+	if c.flagKey == "" && c.flagKeyFile == "" {
+		return errors.New("one of -key or -key-file must be set")
+	}
+	if c.flagKey != "" && c.flagKeyFile != "" {
+		return errors.New("only one of -key or -key-file may be set")
+	}
+	return nil
+}
+
+// readKey returns the new gossip key from either the -key or the -key-file flag.
+func (c *Command) readKey() (string, error) {
+	if c.flagKey != "" {
+		return c.flagKey, nil
+	}
+	data, err := ioutil.ReadFile(c.flagKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read -key-file %q: %s", c.flagKeyFile, err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("-key-file %q is empty", c.flagKeyFile)
+	}
+	return key, nil
+}
+
+// installKey installs key into every keyring, switches every keyring to use it
+// as the primary key and, once it is the primary key on every node, removes all
+// other keys. Keys are only ever logged by their fingerprint. An invalid key is
+// rejected before the keyring is modified.
+func installKey(client *api.Client, key string, retry consul.RetryConfig, log hclog.Logger) error {
+	if err := common.ValidateGossipKey(key); err != nil {
+		return err
+	}
+	log.Info("Installing new gossip encryption key", "fingerprint", common.GossipKeyFingerprint(key))
+	if err := client.Operator().KeyringInstall(key, nil); err != nil {
+		return fmt.Errorf("installing key: %s", err)
+	}
+
+	log.Info("Setting new gossip encryption key as primary")
+	if err := client.Operator().KeyringUse(key, nil); err != nil {
+		return fmt.Errorf("setting primary key: %s", err)
+	}
+	// An old key cannot be removed while it is still the primary key on any node.
+	if err := consul.WaitForPrimaryKey(client, key, retry); err != nil {
+		return err
+	}
+
+	keyrings, err := client.Operator().KeyringList(nil)
+	if err != nil {
+		return fmt.Errorf("listing keys: %s", err)
+	}
+	removed := make(map[string]bool)
+	for _, keyring := range keyrings {
+		for k := range keyring.Keys {
+			if k == key || removed[k] {
+				continue
+			}
+			log.Info("Removing old gossip encryption key", "fingerprint", common.GossipKeyFingerprint(k))
+			if err := client.Operator().KeyringRemove(k, nil); err != nil {
+				return fmt.Errorf("removing old key: %s", err)
+			}
+			removed[k] = true
+		}
+	}
+	log.Info("Removed old gossip encryption keys", "count", len(removed))
+	return nil
+}
+
+// rotationPlan returns the operations installKey would perform to rotate to
+// key, given the current keyrings, in the order they would be performed.
+// Operations that the keyrings do not need are left out. Keys are only
+// referred to by their fingerprint.
+func rotationPlan(keyrings []*api.KeyringResponse, key string) []string {
+	installed, primary := true, true
+	oldKeys := make(map[string]bool)
+	for _, keyring := range keyrings {
+		if keyring.Keys[key] < keyring.NumNodes {
+			installed = false
+		}
+		if keyring.PrimaryKeys[key] < keyring.NumNodes {
+			primary = false
+		}
+		for k := range keyring.Keys {
+			if k != key {
+				oldKeys[common.GossipKeyFingerprint(k)] = true
+			}
+		}
+	}
+
+	var plan []string
+	fingerprint := common.GossipKeyFingerprint(key)
+	if !installed {
+		plan = append(plan, fmt.Sprintf("install key %s", fingerprint))
+	}
+	if !primary {
+		plan = append(plan, fmt.Sprintf("set key %s as primary", fingerprint))
+	}
+	var removals []string
+	for k := range oldKeys {
+		removals = append(removals, fmt.Sprintf("remove key %s", k))
+	}
+	sort.Strings(removals)
+	return append(plan, removals...)
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Rotate the gossip encryption key."
+const help = `
+Usage: consul-k8s-control-plane gossip rotate [options]
+
+  Installs a new gossip encryption key, sets it as the primary key and
+  removes all other keys from the keyring.
+
+`
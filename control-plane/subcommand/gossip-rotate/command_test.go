@@ -0,0 +1,203 @@
+package gossiprotate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oldKey = "Ib6wrnOmO/5kV1Px5O5DXqcoa0Il/3AR7aZSIk0hUAE="
+	newKey = "8UkJdcYzwbl1OpW3aAbI6Lwt9pRwNqbK1PUXX0Udb+Y="
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		flags  []string
+		expErr string
+	}{
+		{
+			flags:  []string{},
+			expErr: "one of -key or -key-file must be set",
+		},
+		{
+			flags:  []string{"-key", newKey, "-key-file", "/tmp/key"},
+			expErr: "only one of -key or -key-file may be set",
+		},
+		{
+			flags:  []string{"-key", newKey, "-log-level", "oak"},
+			expErr: "unknown log level",
+		},
+		{
+			flags:  []string{"-key-file", "/this/does/not/exist"},
+			expErr: "unable to read -key-file",
+		},
+		{
+			flags:  []string{"-key", "not-a-key"},
+			expErr: "Invalid gossip key: gossip key is not valid base64",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI: ui,
+			}
+			code := cmd.Run(c.flags)
+			require.Equal(t, 1, code)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_RotatesKey(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]func(t *testing.T) []string{
+		"key": func(t *testing.T) []string {
+			return []string{"-key", newKey}
+		},
+		"key-file": func(t *testing.T) []string {
+			tmpDir, err := ioutil.TempDir("", "gossip")
+			require.NoError(t, err)
+			t.Cleanup(func() { os.RemoveAll(tmpDir) })
+			keyFile := filepath.Join(tmpDir, "key")
+			require.NoError(t, ioutil.WriteFile(keyFile, []byte(newKey+"\n"), 0600))
+			return []string{"-key-file", keyFile}
+		},
+	}
+
+	for name, keyFlags := range cases {
+		t.Run(name, func(t *testing.T) {
+			server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+				c.Encrypt = oldKey
+			})
+			require.NoError(t, err)
+			defer server.Stop()
+			server.WaitForLeader(t)
+
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI: ui,
+			}
+			args := append([]string{"-http-addr", server.HTTPAddr}, keyFlags(t)...)
+			code := cmd.Run(args)
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			require.NotContains(t, ui.OutputWriter.String(), newKey)
+
+			client, err := api.NewClient(&api.Config{Address: server.HTTPAddr})
+			require.NoError(t, err)
+			keyrings, err := client.Operator().KeyringList(nil)
+			require.NoError(t, err)
+			for _, keyring := range keyrings {
+				require.Len(t, keyring.Keys, 1)
+				require.Contains(t, keyring.Keys, newKey)
+				require.Contains(t, keyring.PrimaryKeys, newKey)
+			}
+		})
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	t.Parallel()
+
+	server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.Encrypt = oldKey
+	})
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI: ui,
+	}
+	code := cmd.Run([]string{"-http-addr", server.HTTPAddr, "-key", newKey, "-dry-run"})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	output := ui.OutputWriter.String()
+	require.Contains(t, output, "install key "+common.GossipKeyFingerprint(newKey))
+	require.Contains(t, output, "set key "+common.GossipKeyFingerprint(newKey)+" as primary")
+	require.Contains(t, output, "remove key "+common.GossipKeyFingerprint(oldKey))
+	require.NotContains(t, output, newKey)
+	require.NotContains(t, output, oldKey)
+
+	// The keyring must not have changed.
+	client, err := api.NewClient(&api.Config{Address: server.HTTPAddr})
+	require.NoError(t, err)
+	keyrings, err := client.Operator().KeyringList(nil)
+	require.NoError(t, err)
+	for _, keyring := range keyrings {
+		require.Len(t, keyring.Keys, 1)
+		require.Contains(t, keyring.Keys, oldKey)
+	}
+}
+
+// Test that an invalid key is rejected before the keyring is touched. The nil
+// client would panic if it were used.
+func TestInstallKey_InvalidKey(t *testing.T) {
+	t.Parallel()
+	err := installKey(nil, "AAECAwQFBgcICQoLDA0ODxA=", primaryKeyRetry, hclog.NewNullLogger())
+	require.EqualError(t, err, "gossip key must be 16, 24 or 32 bytes, got 17 bytes")
+}
+
+func TestRotationPlan(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		keyrings []*api.KeyringResponse
+		expPlan  []string
+	}{
+		"new key not installed": {
+			keyrings: []*api.KeyringResponse{
+				{NumNodes: 3, Keys: map[string]int{oldKey: 3}, PrimaryKeys: map[string]int{oldKey: 3}},
+			},
+			expPlan: []string{
+				"install key " + common.GossipKeyFingerprint(newKey),
+				"set key " + common.GossipKeyFingerprint(newKey) + " as primary",
+				"remove key " + common.GossipKeyFingerprint(oldKey),
+			},
+		},
+		"new key installed but not primary": {
+			keyrings: []*api.KeyringResponse{
+				{NumNodes: 3, Keys: map[string]int{oldKey: 3, newKey: 3}, PrimaryKeys: map[string]int{oldKey: 3}},
+			},
+			expPlan: []string{
+				"set key " + common.GossipKeyFingerprint(newKey) + " as primary",
+				"remove key " + common.GossipKeyFingerprint(oldKey),
+			},
+		},
+		"new key missing from one keyring": {
+			keyrings: []*api.KeyringResponse{
+				{NumNodes: 3, Keys: map[string]int{newKey: 3}, PrimaryKeys: map[string]int{newKey: 3}},
+				{WAN: true, NumNodes: 1, Keys: map[string]int{oldKey: 1}, PrimaryKeys: map[string]int{oldKey: 1}},
+			},
+			expPlan: []string{
+				"install key " + common.GossipKeyFingerprint(newKey),
+				"set key " + common.GossipKeyFingerprint(newKey) + " as primary",
+				"remove key " + common.GossipKeyFingerprint(oldKey),
+			},
+		},
+		"already rotated": {
+			keyrings: []*api.KeyringResponse{
+				{NumNodes: 3, Keys: map[string]int{newKey: 3}, PrimaryKeys: map[string]int{newKey: 3}},
+			},
+			expPlan: nil,
+		},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.expPlan, rotationPlan(c.keyrings, newKey))
+		})
+	}
+}
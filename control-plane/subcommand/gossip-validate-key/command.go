@@ -0,0 +1,99 @@
+package gossipvalidatekey
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/common"
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/mitchellh/cli"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+
+	flagKey     string
+	flagKeyFile string
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagKey, "key", "",
+		"The base64-encoded gossip encryption key to validate. Either -key or -key-file must be set.")
+	c.flags.StringVar(&c.flagKeyFile, "key-file", "",
+		"Path to a file containing the base64-encoded gossip encryption key to validate.")
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run validates that the gossip key is the base64 encoding of 16, 24 or 32 bytes.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) > 0 {
+		c.UI.Error("Should have no non-flag arguments.")
+		return 1
+	}
+	if c.flagKey == "" && c.flagKeyFile == "" {
+		c.UI.Error("one of -key or -key-file must be set")
+		return 1
+	}
+	if c.flagKey != "" && c.flagKeyFile != "" {
+		c.UI.Error("only one of -key or -key-file may be set")
+		return 1
+	}
+
+	key, err := c.readKey()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if err := common.ValidateGossipKey(key); err != nil {
+		c.UI.Error(fmt.Sprintf("Invalid gossip key: %s", err))
+		return 1
+	}
+	c.UI.Info(fmt.Sprintf("Gossip key %s is valid.", common.GossipKeyFingerprint(key)))
+	return 0
+}
+
+// readKey returns the gossip key from either the -key or the -key-file flag.
+func (c *Command) readKey() (string, error) {
+	if c.flagKey != "" {
+		return c.flagKey, nil
+	}
+	data, err := ioutil.ReadFile(c.flagKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read -key-file %q: %s", c.flagKeyFile, err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("-key-file %q is empty", c.flagKeyFile)
+	}
+	return key, nil
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Validate a gossip encryption key."
+const help = `
+Usage: consul-k8s-control-plane gossip validate-key [options]
+
+  Validates that a gossip encryption key is the base64 encoding of 16, 24
+  or 32 bytes, as Consul requires. The key is only ever printed by its
+  fingerprint.
+
+`
@@ -0,0 +1,87 @@
+package gossipvalidatekey
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		flags  []string
+		expErr string
+	}{
+		{
+			flags:  []string{},
+			expErr: "one of -key or -key-file must be set",
+		},
+		{
+			flags:  []string{"-key", "key", "-key-file", "/tmp/key"},
+			expErr: "only one of -key or -key-file may be set",
+		},
+		{
+			flags:  []string{"-key-file", "/this/does/not/exist"},
+			expErr: "unable to read -key-file",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			code := cmd.Run(c.flags)
+			require.Equal(t, 1, code)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	keyFile, err := ioutil.TempFile("", "gossip-key")
+	require.NoError(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.WriteString("Ib6wrnOmO/5kV1Px5O5DXqcoa0Il/3AR7aZSIk0hUAE=\n")
+	require.NoError(t, err)
+	require.NoError(t, keyFile.Close())
+
+	cases := map[string]struct {
+		flags   []string
+		expCode int
+		expOut  string
+	}{
+		"valid key": {
+			flags:   []string{"-key", "AAECAwQFBgcICQoLDA0ODw=="},
+			expCode: 0,
+			expOut:  "is valid",
+		},
+		"valid key file": {
+			flags:   []string{"-key-file", keyFile.Name()},
+			expCode: 0,
+			expOut:  "is valid",
+		},
+		"not base64": {
+			flags:   []string{"-key", "not a key"},
+			expCode: 1,
+			expOut:  "Invalid gossip key: gossip key is not valid base64",
+		},
+		"wrong length": {
+			flags:   []string{"-key", "AAECAwQFBgcICQoLDA0ODxA="},
+			expCode: 1,
+			expOut:  "Invalid gossip key: gossip key must be 16, 24 or 32 bytes, got 17 bytes",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			code := cmd.Run(c.flags)
+			require.Equal(t, c.expCode, code)
+			require.Contains(t, ui.OutputWriter.String()+ui.ErrorWriter.String(), c.expOut)
+		})
+	}
+}
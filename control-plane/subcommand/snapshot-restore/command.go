@@ -0,0 +1,79 @@
+package snapshotrestore
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/mitchellh/cli"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run restores the Consul servers' state from the snapshot file given as the
+// only argument.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) != 1 {
+		c.UI.Error("Should have exactly one non-flag argument, the file to restore the snapshot from.")
+		return 1
+	}
+	file := c.flags.Args()[0]
+
+	snapshot, err := os.Open(file)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error opening snapshot: %s", err))
+		return 1
+	}
+	defer snapshot.Close()
+
+	consulClient, err := c.http.NamedAPIClient("snapshot-restore")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating Consul client: %s", err))
+		return 1
+	}
+	if err := consulClient.Snapshot().Restore(nil, snapshot); err != nil {
+		c.UI.Error(fmt.Sprintf("Error restoring snapshot: %s", err))
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("Restored snapshot from %s", file))
+	return 0
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Restore the Consul servers' state from a snapshot."
+const help = `
+Usage: consul-k8s-control-plane snapshot restore [options] <file>
+
+  Restores the state of the Consul servers from a snapshot saved with
+  snapshot save. The restore replaces the servers' current state and is
+  not reversible, so save a new snapshot first if it may be needed. When
+  ACLs are enabled, a token with management privileges is required.
+
+`
@@ -0,0 +1,67 @@
+package snapshotrestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	snapshotsave "github.com/hashicorp/consul-k8s/control-plane/subcommand/snapshot-save"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), "Should have exactly one non-flag argument")
+
+	ui = cli.NewMockUi()
+	cmd = Command{UI: ui}
+	code = cmd.Run([]string{"/nonexistent/backup.snap"})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), "Error opening snapshot")
+}
+
+// TestRun checks that a snapshot saved with snapshot save restores the state
+// of the servers at the time it was saved.
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+	client, err := api.NewClient(&api.Config{Address: server.HTTPAddr})
+	require.NoError(t, err)
+
+	_, err = client.KV().Put(&api.KVPair{Key: "key", Value: []byte("saved")}, nil)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "backup.snap")
+	ui := cli.NewMockUi()
+	save := snapshotsave.Command{UI: ui}
+	code := save.Run([]string{"-http-addr", server.HTTPAddr, file})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	_, err = client.KV().Put(&api.KVPair{Key: "key", Value: []byte("changed")}, nil)
+	require.NoError(t, err)
+
+	ui = cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code = cmd.Run([]string{"-http-addr", server.HTTPAddr, file})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Contains(t, ui.OutputWriter.String(), "Restored snapshot from "+file)
+
+	pair, _, err := client.KV().Get("key", nil)
+	require.NoError(t, err)
+	require.NotNil(t, pair)
+	require.Equal(t, "saved", string(pair.Value))
+}
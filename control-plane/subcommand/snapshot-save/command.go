@@ -0,0 +1,108 @@
+package snapshotsave
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/control-plane/subcommand/flags"
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+
+	flagStale bool
+
+	once sync.Once
+	help string
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.BoolVar(&c.flagStale, "stale", false,
+		"Allow any Consul server to serve the snapshot, rather than only the leader.")
+
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run saves a snapshot of the Consul servers' state to the file given as the
+// only argument.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.flags.Parse(args); err != nil {
+		return 1
+	}
+	if len(c.flags.Args()) != 1 {
+		c.UI.Error("Should have exactly one non-flag argument, the file to save the snapshot to.")
+		return 1
+	}
+	file := c.flags.Args()[0]
+
+	consulClient, err := c.http.NamedAPIClient("snapshot-save")
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error creating Consul client: %s", err))
+		return 1
+	}
+
+	snapshot, meta, err := consulClient.Snapshot().Save(&api.QueryOptions{AllowStale: c.flagStale})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error saving snapshot: %s", err))
+		return 1
+	}
+	defer snapshot.Close()
+
+	if err := writeFile(file, snapshot); err != nil {
+		c.UI.Error(fmt.Sprintf("Error writing snapshot to %s: %s", file, err))
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("Saved snapshot at index %d to %s", meta.LastIndex, file))
+	return 0
+}
+
+// writeFile writes r to a temporary file next to file and renames it to file
+// once it is complete, so that a failed save never leaves a partial snapshot
+// behind or replaces an existing one.
+func writeFile(file string, r io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Save a snapshot of the Consul servers' state."
+const help = `
+Usage: consul-k8s-control-plane snapshot save [options] <file>
+
+  Saves a point-in-time snapshot of the state of the Consul servers,
+  including the catalog, KV store, ACLs and Connect CA, to file. The
+  snapshot can be restored with snapshot restore. When ACLs are enabled,
+  a token with management privileges is required.
+
+`
@@ -0,0 +1,67 @@
+package snapshotsave
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{{}, {"a.snap", "b.snap"}} {
+		ui := cli.NewMockUi()
+		cmd := Command{UI: ui}
+		code := cmd.Run(args)
+		require.Equal(t, 1, code)
+		require.Contains(t, ui.ErrorWriter.String(), "Should have exactly one non-flag argument")
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "backup.snap")
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-http-addr", server.HTTPAddr, file})
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+	require.Contains(t, ui.OutputWriter.String(), "to "+file)
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	require.NotZero(t, info.Size())
+	// Only the snapshot is left in the directory.
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+// TestRun_Error checks that a failed save does not create the file.
+func TestRun_Error(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "backup.snap")
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	code := cmd.Run([]string{"-http-addr", "127.0.0.1:1", file})
+	require.Equal(t, 1, code)
+	require.Contains(t, ui.ErrorWriter.String(), "Error saving snapshot")
+	_, err = os.Stat(file)
+	require.True(t, os.IsNotExist(err))
+}
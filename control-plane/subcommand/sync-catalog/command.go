@@ -66,6 +66,10 @@ type Command struct {
 	consulClient *api.Client
 	clientset    kubernetes.Interface
 
+	// controllers are the running sync controllers. Sync is only ready
+	// once their informer caches have synced.
+	controllers []*controller.Controller
+
 	once   sync.Once
 	sigCh  chan os.Signal
 	help   string
@@ -193,7 +197,7 @@ func (c *Command) Run(args []string) int {
 	// Setup Consul client
 	if c.consulClient == nil {
 		var err error
-		c.consulClient, err = c.http.APIClient()
+		c.consulClient, err = c.http.NamedAPIClient("sync-catalog")
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("Error connecting to Consul agent: %s", err))
 			return 1
@@ -280,6 +284,7 @@ func (c *Command) Run(args []string) int {
 			},
 		}
 
+		c.controllers = append(c.controllers, ctl)
 		toConsulCh = make(chan struct{})
 		go func() {
 			defer close(toConsulCh)
@@ -313,6 +318,7 @@ func (c *Command) Run(args []string) int {
 			Resource: sink,
 		}
 
+		c.controllers = append(c.controllers, ctl)
 		toK8SCh = make(chan struct{})
 		go func() {
 			defer close(toK8SCh)
@@ -364,6 +370,16 @@ func (c *Command) Run(args []string) int {
 }
 
 func (c *Command) handleReady(rw http.ResponseWriter, req *http.Request) {
+	// Until the informer caches have synced, the controllers haven't
+	// seen all the existing resources so sync isn't ready.
+	for _, ctl := range c.controllers {
+		if !ctl.HasSynced() {
+			c.UI.Error("[GET /health/ready] Informer caches have not synced")
+			rw.WriteHeader(500)
+			return
+		}
+	}
+
 	// The main readiness check is whether sync can talk to
 	// the consul cluster, in this case querying for the leader
 	_, err := c.consulClient.Status().Leader()
@@ -2,11 +2,13 @@ package synccatalog
 
 import (
 	"context"
+	"net/http/httptest"
 	"os"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/consul-k8s/control-plane/helper/controller"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/hashicorp/consul/sdk/testutil/retry"
@@ -15,7 +17,10 @@ import (
 	"github.com/stretchr/testify/require"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 )
 
 // Test flag validation
@@ -634,3 +639,62 @@ func lbService(name, lbIP string) *apiv1.Service {
 		},
 	}
 }
+
+// Test that the readiness check fails until the controllers' informer caches
+// have synced.
+func TestHandleReady_CachesNotSynced(t *testing.T) {
+	t.Parallel()
+
+	k8s, testServer := completeSetup(t)
+	defer testServer.Stop()
+
+	consulClient, err := api.NewClient(&api.Config{Address: testServer.HTTPAddr})
+	require.NoError(t, err)
+
+	ctl := &controller.Controller{
+		Log: hclog.New(&hclog.LoggerOptions{Name: t.Name()}),
+		Resource: controller.NewResource(
+			cache.NewSharedIndexInformer(
+				&cache.ListWatch{
+					ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+						return k8s.CoreV1().Services(metav1.NamespaceAll).List(context.Background(), options)
+					},
+					WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+						return k8s.CoreV1().Services(metav1.NamespaceAll).Watch(context.Background(), options)
+					},
+				},
+				&apiv1.Service{}, 0, cache.Indexers{}),
+			func(string, interface{}) error { return nil },
+			func(string, interface{}) error { return nil },
+		),
+	}
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:           ui,
+		consulClient: consulClient,
+		controllers:  []*controller.Controller{ctl},
+	}
+
+	// The controller hasn't started so its cache hasn't synced.
+	rec := httptest.NewRecorder()
+	cmd.handleReady(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	require.Equal(t, 500, rec.Code)
+	require.Contains(t, ui.ErrorWriter.String(), "Informer caches have not synced")
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		ctl.Run(stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
+
+	retry.Run(t, func(r *retry.R) {
+		rec := httptest.NewRecorder()
+		cmd.handleReady(rec, httptest.NewRequest("GET", "/health/ready", nil))
+		require.Equal(r, 204, rec.Code)
+	})
+}
@@ -0,0 +1,30 @@
+package version
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/cli"
+)
+
+// FlagCommand wraps a subcommand so that running it with -version or
+// --version prints the version and exits before the subcommand does any work,
+// e.g. to find out which version a sidecar image runs.
+type FlagCommand struct {
+	cli.Command
+	UI      cli.Ui
+	Version string
+}
+
+func (c *FlagCommand) Run(args []string) int {
+	for _, arg := range args {
+		// Arguments after "--" are not flags.
+		if arg == "--" {
+			break
+		}
+		if arg == "-version" || arg == "--version" {
+			c.UI.Output(fmt.Sprintf("consul-k8s-control-plane %s", c.Version))
+			return 0
+		}
+	}
+	return c.Command.Run(args)
+}
@@ -0,0 +1,41 @@
+package version
+
+import (
+	"testing"
+
+	consulsidecar "github.com/hashicorp/consul-k8s/control-plane/subcommand/consul-sidecar"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagCommand_Version(t *testing.T) {
+	for _, flag := range []string{"-version", "--version"} {
+		t.Run(flag, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := &FlagCommand{
+				Command: &consulsidecar.Command{UI: ui},
+				UI:      ui,
+				Version: "1.2.3-dev (abcdef)",
+			}
+			// The consul sidecar requires -service-config, which is not set.
+			code := cmd.Run([]string{flag})
+			require.Equal(t, 0, code)
+			require.Equal(t, "consul-k8s-control-plane 1.2.3-dev (abcdef)\n", ui.OutputWriter.String())
+			require.Empty(t, ui.ErrorWriter.String())
+		})
+	}
+}
+
+func TestFlagCommand_RunsCommand(t *testing.T) {
+	ui := cli.NewMockUi()
+	cmd := &FlagCommand{
+		Command: &consulsidecar.Command{UI: ui},
+		UI:      ui,
+		Version: "1.2.3",
+	}
+	// Without -version the wrapped command runs and fails validation.
+	code := cmd.Run([]string{"-consul-binary="})
+	require.Equal(t, 1, code)
+	require.NotContains(t, ui.OutputWriter.String(), "1.2.3")
+	require.Contains(t, ui.ErrorWriter.String(), "-service-config must be set")
+}